@@ -0,0 +1,212 @@
+package main
+
+// archive module provides on the fly generation of zip and tar archives
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrArchiveTooLarge represents error of archive which exceeds configured limits
+var ErrArchiveTooLarge = errors.New("archive exceeds size limits")
+
+// manifestName defines name of manifest file within archive
+const manifestName = "MANIFEST.json"
+
+// archiveFormats defines supported archive formats and their file extensions
+var archiveFormats = map[string]string{
+	"zip":     ".zip",
+	"tar":     ".tar",
+	"tar.gz":  ".tar.gz",
+	"tgz":     ".tar.gz",
+	"tar.zst": ".tar.zst",
+}
+
+// ManifestEntry represents archived file in archive manifest
+type ManifestEntry struct {
+	Name        string            `json:"name"`
+	Size        int64             `json:"size"`
+	ModTime     time.Time         `json:"mod_time"`
+	ContentType string            `json:"content_type,omitempty"`
+	Checksums   map[string]string `json:"checksums"`
+}
+
+// Manifest represents manifest of archive, it is stored as last file of the
+// archive since checksums of files are computed while files are archived
+type Manifest struct {
+	Source    string          `json:"source"` // source of archived files, e.g. DID or storage area
+	Created   time.Time       `json:"created"`
+	TotalSize int64           `json:"total_size"`
+	Files     []ManifestEntry `json:"files"`
+}
+
+// archiveWriter represents generic writer of archive entries
+type archiveWriter interface {
+	Create(name string, size int64, modTime time.Time) (io.Writer, error)
+	Close() error
+}
+
+// zipArchiveWriter writes zip archive
+type zipArchiveWriter struct {
+	writer *zip.Writer
+}
+
+// Create implements archiveWriter interface
+func (z *zipArchiveWriter) Create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+	header.UncompressedSize64 = uint64(size)
+	return z.writer.CreateHeader(header)
+}
+
+// Close implements archiveWriter interface
+func (z *zipArchiveWriter) Close() error {
+	return z.writer.Close()
+}
+
+// tarArchiveWriter writes tar archive with optional compression
+type tarArchiveWriter struct {
+	writer     *tar.Writer
+	compressor io.WriteCloser
+}
+
+// Create implements archiveWriter interface
+func (t *tarArchiveWriter) Create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	header := &tar.Header{
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatPAX,
+	}
+	if err := t.writer.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	return t.writer, nil
+}
+
+// Close implements archiveWriter interface
+func (t *tarArchiveWriter) Close() error {
+	if err := t.writer.Close(); err != nil {
+		return err
+	}
+	if t.compressor != nil {
+		return t.compressor.Close()
+	}
+	return nil
+}
+
+// newArchiveWriter creates archive writer of given format
+func newArchiveWriter(w io.Writer, format string) (archiveWriter, error) {
+	switch format {
+	case "zip":
+		return &zipArchiveWriter{writer: zip.NewWriter(w)}, nil
+	case "tar":
+		return &tarArchiveWriter{writer: tar.NewWriter(w)}, nil
+	case "tar.gz", "tgz":
+		gz := gzip.NewWriter(w)
+		return &tarArchiveWriter{writer: tar.NewWriter(gz), compressor: gz}, nil
+	case "tar.zst":
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("[DataManagement.main.newArchiveWriter] zstd.NewWriter error: %w", err)
+		}
+		return &tarArchiveWriter{writer: tar.NewWriter(zw), compressor: zw}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive format '%s', supported formats: zip, tar, tar.gz, tar.zst", format)
+}
+
+// archiveEntries selects files to archive and checks them against configured
+// archive limits
+func archiveEntries(entries []Metadata) ([]Metadata, error) {
+	var files []Metadata
+	var totalSize int64
+	for _, entry := range entries {
+		if entry.IsDirectory {
+			continue
+		}
+		files = append(files, entry)
+		totalSize += entry.Size
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no files to archive")
+	}
+	if limit := dmConfig.Archives.MaxFiles; limit > 0 && len(files) > limit {
+		return nil, fmt.Errorf("%w: archive contains %d files, limit is %d files", ErrArchiveTooLarge, len(files), limit)
+	}
+	if limit := dmConfig.Archives.MaxSize; limit > 0 && totalSize > limit {
+		return nil, fmt.Errorf("%w: archive size is %d bytes, limit is %d bytes", ErrArchiveTooLarge, totalSize, limit)
+	}
+	return files, nil
+}
+
+// writeArchive streams archive of given files of storage backend directory
+// into given writer. The files are read one at a time and their checksums
+// are computed on the fly and stored in archive manifest.
+func writeArchive(w io.Writer, format, source string, backend StorageBackend, dir string, files []Metadata) error {
+	aw, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+	manifest := Manifest{Source: source, Created: time.Now()}
+	for _, file := range files {
+		entry, err := archiveFile(aw, backend, dir, file.Name)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, entry)
+		manifest.TotalSize += entry.Size
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.writeArchive] json.Marshal error: %w", err)
+	}
+	mw, err := aw.Create(manifestName, int64(len(data)), manifest.Created)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.writeArchive] Create error: %w", err)
+	}
+	if _, err := mw.Write(data); err != nil {
+		return fmt.Errorf("[DataManagement.main.writeArchive] Write error: %w", err)
+	}
+	if err := aw.Close(); err != nil {
+		return fmt.Errorf("[DataManagement.main.writeArchive] Close error: %w", err)
+	}
+	return nil
+}
+
+// helper function to add single file to the archive
+func archiveFile(aw archiveWriter, backend StorageBackend, dir, name string) (ManifestEntry, error) {
+	entry := ManifestEntry{Name: name}
+	reader, meta, err := backend.Open(dir, name)
+	if err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.archiveFile] Open error: %w", err)
+	}
+	defer reader.Close()
+	entry.Size = meta.Size
+	entry.ModTime = meta.ModTime
+	entry.ContentType = meta.ContentType
+	fw, err := aw.Create(strings.TrimPrefix(path.Clean("/"+name), "/"), meta.Size, meta.ModTime)
+	if err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.archiveFile] Create error: %w", err)
+	}
+	summer := NewChecksummer(checksumAlgorithms(nil)...)
+	// the file may change while we archive it, but tar archive requires
+	// exact size of the file, therefore we copy exactly its size
+	if _, err := io.CopyN(io.MultiWriter(fw, summer), reader, meta.Size); err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.archiveFile] io.CopyN error for %s: %w", name, err)
+	}
+	entry.Checksums = summer.Sums()
+	return entry, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+// archive handlers module provides end-points which stream archives of data
+// locations of DIDs and directories of storage areas
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// archiveContentTypes defines content types of archive formats
+var archiveContentTypes = map[string]string{
+	"zip":     "application/zip",
+	"tar":     "application/x-tar",
+	"tar.gz":  "application/gzip",
+	"tgz":     "application/gzip",
+	"tar.zst": "application/zstd",
+}
+
+// archiveNamePattern matches characters which are not allowed in archive name
+var archiveNamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// helper function to parse archive format of HTTP request, zip is default format
+func archiveFormat(c *gin.Context) (string, error) {
+	format := c.DefaultQuery("format", "zip")
+	if _, ok := archiveFormats[format]; !ok {
+		return "", fmt.Errorf("unsupported archive format '%s', supported formats: zip, tar, tar.gz, tar.zst", format)
+	}
+	return format, nil
+}
+
+// helper function to stream archive of given files to HTTP client
+func streamArchive(c *gin.Context, name, format, source string, backend StorageBackend, dir string, entries []Metadata) {
+	files, err := archiveEntries(entries)
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, ErrArchiveTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	name = strings.Trim(archiveNamePattern.ReplaceAllString(name, "_"), "_")
+	if name == "" {
+		name = "archive"
+	}
+	header := fmt.Sprintf("attachment; filename=%s%s", name, archiveFormats[format])
+	c.Header("Content-Disposition", header)
+	c.Header("Content-Type", archiveContentTypes[format])
+	c.Status(http.StatusOK)
+	// the archive is generated on the fly, therefore once we start streaming
+	// we can't report an error to the client and the archive is truncated
+	if err := writeArchive(c.Writer, format, source, backend, dir, files); err != nil {
+		log.Printf("ERROR: unable to stream archive of %s, error %v", source, err)
+	}
+}
+
+// ArchiveHandler provides access to GET /archive end-point
+/*
+```
+# get zip archive of data location of given DID
+curl -o data.zip "http://localhost:8340/archive?did=/beamline=3a/btr=123/cycle=2024-3/sample_name=bla"
+# get tar.gz archive of sub-path of data location
+curl -o data.tar.gz "http://localhost:8340/archive?did=<did>&path=scan1&format=tar.gz"
+# get tar.zst archive of files of data location matching given pattern
+curl -o data.tar.zst "http://localhost:8340/archive?did=<did>&pattern=.*.h5&format=tar.zst"
+```
+*/
+func ArchiveHandler(c *gin.Context) {
+	did := c.Query("did")
+	if did == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": "missing did parameter"})
+		return
+	}
+	if val, err := url.QueryUnescape(did); err == nil {
+		did = val
+	}
+	format, err := archiveFormat(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	// pattern has the same semantics as in /files end-point, i.e. it is
+	// regular expression of file names and 'all' matches all files
+	var re *regexp.Regexp
+	if pattern := c.Query("pattern"); pattern != "" && pattern != "all" {
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": fmt.Sprintf("invalid regex pattern: %v", err)})
+			return
+		}
+	}
+	spath := c.Query("path")
+
+	// Find metadata record for given DID
+	meta, err := findMetaDataRecord(did)
+	if err != nil {
+		metaDataError(c, err)
+		return
+	}
+	// archive the first data location which contains requested path
+	attrs, ok := locationAttributes(c)
+	if !ok {
+		return
+	}
+	for _, loc := range dataLocations(meta, attrs) {
+		location := loc.Path
+		if path, err := resolvePath(location, spath); err != nil {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+			return
+		} else if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		client := NewLocalFsClient(location)
+		entries, truncated, err := client.ListContext(c.Request.Context(), spath, -1)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusNotFound), gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+		if truncated {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"status": "fail", "error": ErrArchiveTooLarge.Error() + ": listing of files is truncated"})
+			return
+		}
+		if re != nil {
+			var matched []Metadata
+			for _, entry := range entries {
+				if re.MatchString(filepath.Base(entry.Name)) {
+					matched = append(matched, entry)
+				}
+			}
+			entries = matched
+		}
+		name := filepath.Base(location)
+		if spath != "" {
+			name = fmt.Sprintf("%s_%s", name, filepath.Base(filepath.Clean(spath)))
+		}
+		streamArchive(c, name, format, did, client, spath, entries)
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"status": "fail", "error": "data location not found"})
+}
+
+// ArchiveStorageHandler provides access to GET /archive/:area/:dir end-point
+/*
+```
+# get zip archive of dir (S3 bucket) of storage area
+curl -o bucket.zip http://localhost:8340/archive/derived/bucket
+# get tar.gz archive of files (S3 objects) with given prefix
+curl -o scan1.tar.gz "http://localhost:8340/archive/derived/bucket?prefix=scan1/&format=tar.gz"
+```
+*/
+func ArchiveStorageHandler(c *gin.Context) {
+	var params StorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	backend, ok := areaBackend(c)
+	if !ok {
+		return
+	}
+	format, err := archiveFormat(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	entries, truncated, err := listContext(c.Request.Context(), backend, params.Dir, -1)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusNotFound), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if truncated {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"status": "fail", "error": ErrArchiveTooLarge.Error() + ": listing of files is truncated"})
+		return
+	}
+	name := params.Dir
+	if prefix := c.Query("prefix"); prefix != "" {
+		var matched []Metadata
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name, prefix) {
+				matched = append(matched, entry)
+			}
+		}
+		entries = matched
+		name = fmt.Sprintf("%s_%s", name, prefix)
+	}
+	source := fmt.Sprintf("%s/%s", params.Area, params.Dir)
+	streamArchive(c, name, format, source, backend, params.Dir, entries)
+}
@@ -0,0 +1,167 @@
+package main
+
+// archive tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// helper function to read content of archive files
+func readArchive(t *testing.T, format string, data []byte) ([]string, map[string]string) {
+	t.Helper()
+	var names []string
+	files := make(map[string]string)
+	if format == "zip" {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range zr.File {
+			reader, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, file.Name)
+			files[file.Name] = string(content)
+		}
+		return names, files
+	}
+	var reader io.Reader = bytes.NewReader(data)
+	switch format {
+	case "tar.gz":
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = gz
+	case "tar.zst":
+		zr, err := zstd.NewReader(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		reader = zr
+	}
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+		files[header.Name] = string(content)
+	}
+	return names, files
+}
+
+// TestWriteArchive tests that archives of all formats contain files and
+// their manifest as the last file
+func TestWriteArchive(t *testing.T) {
+	client := NewLocalFsClient(t.TempDir())
+	content := map[string]string{"a.txt": "hello world", "sub/b.txt": "sub-directory file"}
+	var files []Metadata
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		files = append(files, uploadContent(t, client, "data", name, content[name]))
+		files[len(files)-1].Name = name
+	}
+	for _, format := range []string{"zip", "tar", "tar.gz", "tar.zst"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeArchive(&buf, format, "/beamline=3a", client, "data", files); err != nil {
+				t.Fatal(err)
+			}
+			names, archived := readArchive(t, format, buf.Bytes())
+			if len(names) != 3 || names[2] != manifestName {
+				t.Fatalf("expected archived files followed by manifest, got %v", names)
+			}
+			for name, data := range content {
+				if archived[name] != data {
+					t.Fatalf("expected content %q of %s, got %q", data, name, archived[name])
+				}
+			}
+			var manifest Manifest
+			if err := json.Unmarshal([]byte(archived[manifestName]), &manifest); err != nil {
+				t.Fatal(err)
+			}
+			if manifest.Source != "/beamline=3a" || len(manifest.Files) != 2 {
+				t.Fatalf("unexpected manifest %+v", manifest)
+			}
+			if manifest.TotalSize != int64(len(content["a.txt"])+len(content["sub/b.txt"])) {
+				t.Fatalf("unexpected total size of manifest %d", manifest.TotalSize)
+			}
+			if sums := manifest.Files[0].Checksums; !maps.Equal(sums, map[string]string{ChecksumSHA256: helloSums[ChecksumSHA256]}) {
+				t.Fatalf("unexpected checksums of %s: %v", manifest.Files[0].Name, sums)
+			}
+		})
+	}
+	if _, err := newArchiveWriter(io.Discard, "rar"); err == nil {
+		t.Fatal("expected error of unsupported format")
+	}
+}
+
+// TestArchiveEntries tests selection of archived files and archive limits
+func TestArchiveEntries(t *testing.T) {
+	defer func(limits ArchivesConfig) { dmConfig.Archives = limits }(dmConfig.Archives)
+	entries := []Metadata{
+		{Name: "dir", IsDirectory: true},
+		{Name: "dir/a.h5", Size: 100},
+		{Name: "dir/b.h5", Size: 200},
+	}
+	tests := []struct {
+		name     string
+		maxFiles int
+		maxSize  int64
+		err      bool
+	}{
+		{"no limits", 0, 0, false},
+		{"within limits", 2, 300, false},
+		{"too many files", 1, 0, true},
+		{"too large", 0, 299, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dmConfig.Archives.MaxFiles = tt.maxFiles
+			dmConfig.Archives.MaxSize = tt.maxSize
+			files, err := archiveEntries(entries)
+			if tt.err {
+				if !errors.Is(err, ErrArchiveTooLarge) {
+					t.Fatalf("expected error %v, got %v", ErrArchiveTooLarge, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 2 || files[0].Name != "dir/a.h5" || files[1].Name != "dir/b.h5" {
+				t.Fatalf("expected archived files without directories, got %+v", files)
+			}
+		})
+	}
+	if _, err := archiveEntries(entries[:1]); err == nil {
+		t.Fatal("expected error of archive without files")
+	}
+}
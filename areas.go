@@ -0,0 +1,116 @@
+package main
+
+// areas module provides registry of named storage areas
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	srvConfig "github.com/CHESSComputing/golib/config"
+)
+
+// ErrAreaNotFound represents error of unknown storage area
+var ErrAreaNotFound = errors.New("storage area not found")
+
+// areaNamePattern represents pattern of storage area names
+var areaNamePattern = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9_.-]*$")
+
+// StorageArea represents named storage area served by storage backend
+type StorageArea struct {
+	Name         string         `json:"name"`
+	Type         string         `json:"type"` // type of storage backend, e.g. fs or s3
+	Kind         string         `json:"kind"` // kind of storage backend, e.g. local, minio, aws
+	Capabilities []string       `json:"capabilities"`
+	Backend      StorageBackend `json:"-"`
+}
+
+// storageAreas keeps all storage areas of the service
+var storageAreas = make(map[string]*StorageArea)
+
+// storageArea returns storage area for given name
+func storageArea(name string) (*StorageArea, error) {
+	if area, ok := storageAreas[name]; ok {
+		return area, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrAreaNotFound, name)
+}
+
+// listStorageAreas returns list of storage areas ordered by their names
+func listStorageAreas() []*StorageArea {
+	var areas []*StorageArea
+	for _, area := range storageAreas {
+		areas = append(areas, area)
+	}
+	sort.Slice(areas, func(i, j int) bool { return areas[i].Name < areas[j].Name })
+	return areas
+}
+
+// helper function to provide configuration of storage areas. If storage
+// areas are not explicitly configured we fall back to DataManagement S3 and
+// FS sections of FOXDEN configuration which define s3 and fs areas,
+// respectively
+func areasConfig() []BackendConfig {
+	if len(dmConfig.StorageAreas) > 0 {
+		return dmConfig.StorageAreas
+	}
+	var configs []BackendConfig
+	if kind := srvConfig.Config.DataManagement.S3.Name; kind != "" {
+		configs = append(configs, BackendConfig{Name: "s3", Kind: kind})
+	}
+	if fs := srvConfig.Config.DataManagement.FS; fs.Storage != "" {
+		name := fs.Name
+		if name == "" {
+			name = "fs"
+		}
+		kind := fs.Kind
+		if kind == "" {
+			kind = "local"
+		}
+		configs = append(configs, BackendConfig{Name: name, Kind: kind, Storage: fs.Storage})
+	}
+	return configs
+}
+
+// storageInfo provides information about configured storage areas
+func storageInfo() string {
+	var out []string
+	for _, config := range areasConfig() {
+		out = append(out, fmt.Sprintf("storage area: %s", config))
+	}
+	return strings.Join(out, "\n")
+}
+
+// initStorageAreas initializes storage backends of all configured storage areas
+func initStorageAreas() error {
+	configs := areasConfig()
+	if len(configs) == 0 {
+		return errors.New("no storage areas are configured")
+	}
+	for _, config := range configs {
+		if !areaNamePattern.MatchString(config.Name) {
+			return fmt.Errorf("invalid storage area name '%s'", config.Name)
+		}
+		if _, ok := storageAreas[config.Name]; ok {
+			return fmt.Errorf("duplicate storage area '%s'", config.Name)
+		}
+		backend, err := NewStorageBackend(config)
+		if err != nil {
+			return fmt.Errorf("[DataManagement.main.initStorageAreas] storage area %s error: %w", config.Name, err)
+		}
+		storageAreas[config.Name] = &StorageArea{
+			Name:         config.Name,
+			Type:         backend.Type(),
+			Kind:         config.Kind,
+			Capabilities: backend.Capabilities(),
+			Backend:      backend,
+		}
+		log.Printf("INFO: storage area %s is served by %s backend: %s", config.Name, backend.Type(), config)
+	}
+	return nil
+}
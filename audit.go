@@ -0,0 +1,578 @@
+package main
+
+// audit module provides append-only audit log of storage mutations and
+// sensitive reads. Every audited request produces structured record with
+// authenticated user, operation, storage path, client IP and outcome of the
+// request which is written into pluggable audit sink.
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	authz "github.com/CHESSComputing/golib/authz"
+	srvConfig "github.com/CHESSComputing/golib/config"
+	server "github.com/CHESSComputing/golib/server"
+	"github.com/gin-gonic/gin"
+)
+
+// audit outcomes
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditRecord represents audit record of storage operation
+type AuditRecord struct {
+	Time      time.Time         `json:"time"`
+	Subject   string            `json:"subject"`   // user of access token
+	Operation string            `json:"operation"` // e.g. storage.upload, storage.delete
+	Method    string            `json:"method,omitempty"`
+	Route     string            `json:"route,omitempty"`
+	Area      string            `json:"area,omitempty"`   // storage area
+	Path      string            `json:"path,omitempty"`   // path within storage area
+	Target    string            `json:"target,omitempty"` // destination of copied or moved file
+	Size      int64             `json:"size,omitempty"`
+	Checksums map[string]string `json:"checksums,omitempty"`
+	ClientIP  string            `json:"client_ip,omitempty"`
+	Status    int               `json:"status,omitempty"` // HTTP status code
+	Outcome   string            `json:"outcome"`          // success or failure
+	Error     string            `json:"error,omitempty"`
+	Duration  float64           `json:"duration"` // duration of the operation in seconds
+}
+
+// AuditQuery represents query of audit records
+type AuditQuery struct {
+	Subject   string    `form:"subject"`
+	Operation string    `form:"operation"`
+	Area      string    `form:"area"`
+	Path      string    `form:"path"` // prefix of path
+	Outcome   string    `form:"outcome"`
+	Since     time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until     time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit     int       `form:"limit"`
+}
+
+// Match checks if audit record matches the query
+func (q AuditQuery) Match(rec AuditRecord) bool {
+	if q.Subject != "" && q.Subject != rec.Subject {
+		return false
+	}
+	if q.Operation != "" && q.Operation != rec.Operation {
+		return false
+	}
+	if q.Area != "" && q.Area != rec.Area {
+		return false
+	}
+	if q.Path != "" && !strings.HasPrefix(rec.Path, q.Path) {
+		return false
+	}
+	if q.Outcome != "" && q.Outcome != rec.Outcome {
+		return false
+	}
+	if !q.Since.IsZero() && rec.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !rec.Time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// AuditSink represents storage of audit records, the records are only
+// appended to the sink
+type AuditSink interface {
+	Write(rec AuditRecord) error
+	Close() error
+}
+
+// AuditQuerier represents audit sink which can be queried
+type AuditQuerier interface {
+	Query(q AuditQuery) ([]AuditRecord, error)
+}
+
+// AuditSinkFactory creates audit sink for given configuration
+type AuditSinkFactory func(config AuditConfig) (AuditSink, error)
+
+// auditFactories keeps factories of all known audit sinks
+var auditFactories = make(map[string]AuditSinkFactory)
+
+// RegisterAuditSink registers audit sink factory for given kind of sink
+func RegisterAuditSink(kind string, factory AuditSinkFactory) {
+	auditFactories[strings.ToLower(kind)] = factory
+}
+
+// NewAuditSink creates audit sink for given configuration
+func NewAuditSink(config AuditConfig) (AuditSink, error) {
+	factory, ok := auditFactories[strings.ToLower(config.Sink)]
+	if !ok {
+		var kinds []string
+		for kind := range auditFactories {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		return nil, fmt.Errorf("unsupported audit sink '%s', supported sinks: %v", config.Sink, kinds)
+	}
+	sink, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewAuditSink] factory error: %w", err)
+	}
+	return sink, nil
+}
+
+func init() {
+	RegisterAuditSink("file", func(config AuditConfig) (AuditSink, error) {
+		return NewFileAuditSink(config.File, config.MaxSize, config.MaxFiles)
+	})
+	RegisterAuditSink("log", func(config AuditConfig) (AuditSink, error) {
+		return &LogAuditSink{}, nil
+	})
+}
+
+// FileAuditSink represents audit sink which appends records to JSON-lines
+// file, the file is rotated once it reaches its maximum size
+type FileAuditSink struct {
+	Path     string // location of audit log file
+	MaxSize  int64  // maximum size of audit log file
+	MaxFiles int    // maximum number of rotated files
+	file     *os.File
+	size     int64
+	mutex    sync.Mutex
+}
+
+// NewFileAuditSink creates new file audit sink
+func NewFileAuditSink(fname string, maxSize int64, maxFiles int) (*FileAuditSink, error) {
+	if fname == "" {
+		return nil, errors.New("audit log file is not provided")
+	}
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewFileAuditSink] os.MkdirAll error: %w", err)
+	}
+	sink := &FileAuditSink{Path: fname, MaxSize: maxSize, MaxFiles: maxFiles}
+	if err := sink.open(); err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewFileAuditSink] open error: %w", err)
+	}
+	return sink, nil
+}
+
+// helper function to open audit log file in append-only mode
+func (s *FileAuditSink) open() error {
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// helper function to return location of rotated audit log file
+func (s *FileAuditSink) rotated(idx int) string {
+	return fmt.Sprintf("%s.%d", s.Path, idx)
+}
+
+// helper function to rotate audit log file, the oldest file is removed
+// once number of rotated files exceeds its maximum
+func (s *FileAuditSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(s.rotated(s.MaxFiles))
+	for idx := s.MaxFiles - 1; idx > 0; idx-- {
+		os.Rename(s.rotated(idx), s.rotated(idx+1))
+	}
+	if s.MaxFiles > 0 {
+		if err := os.Rename(s.Path, s.rotated(1)); err != nil {
+			return err
+		}
+	} else {
+		os.Remove(s.Path)
+	}
+	return s.open()
+}
+
+// Write implements AuditSink interface
+func (s *FileAuditSink) Write(rec AuditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.FileAuditSink.Write] json.Marshal error: %w", err)
+	}
+	data = append(data, '\n')
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return errors.New("audit log is closed")
+	}
+	if s.MaxSize > 0 && s.size > 0 && s.size+int64(len(data)) > s.MaxSize {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("[DataManagement.main.FileAuditSink.Write] rotate error: %w", err)
+		}
+	}
+	nbytes, err := s.file.Write(data)
+	s.size += int64(nbytes)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.FileAuditSink.Write] file.Write error: %w", err)
+	}
+	return nil
+}
+
+// Query implements AuditQuerier interface, it provides matched records of
+// audit log and its rotated files from the latest to the oldest one
+func (s *FileAuditSink) Query(q AuditQuery) ([]AuditRecord, error) {
+	s.mutex.Lock()
+	files := []string{}
+	for idx := s.MaxFiles; idx > 0; idx-- {
+		files = append(files, s.rotated(idx))
+	}
+	files = append(files, s.Path)
+	s.mutex.Unlock()
+
+	records := []AuditRecord{}
+	for _, fname := range files {
+		file, err := os.Open(fname)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("[DataManagement.main.FileAuditSink.Query] os.Open error: %w", err)
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var rec AuditRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || !q.Match(rec) {
+				continue
+			}
+			records = append(records, rec)
+			// keep only latest records within the limit
+			if q.Limit > 0 && len(records) > 2*q.Limit {
+				records = append(records[:0], records[len(records)-q.Limit:]...)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("[DataManagement.main.FileAuditSink.Query] scanner error: %w", err)
+		}
+	}
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[len(records)-q.Limit:]
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.After(records[j].Time) })
+	return records, nil
+}
+
+// Close implements AuditSink interface
+func (s *FileAuditSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// LogAuditSink represents audit sink which writes records to service log,
+// e.g. to be collected by log aggregation of containers
+type LogAuditSink struct{}
+
+// Write implements AuditSink interface
+func (s *LogAuditSink) Write(rec AuditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.LogAuditSink.Write] json.Marshal error: %w", err)
+	}
+	log.Printf("AUDIT: %s", data)
+	return nil
+}
+
+// Close implements AuditSink interface
+func (s *LogAuditSink) Close() error {
+	return nil
+}
+
+// auditSink keeps audit sink of the service, nil sink disables audit log
+var auditSink AuditSink
+
+// initAudit initializes audit sink of the service according to configuration
+func initAudit() error {
+	if strings.ToLower(dmConfig.Audit.Sink) == "none" {
+		return nil
+	}
+	sink, err := NewAuditSink(dmConfig.Audit)
+	if err != nil {
+		return err
+	}
+	auditSink = sink
+	return nil
+}
+
+// writeAudit writes audit record to audit sink of the service
+func writeAudit(rec AuditRecord) {
+	if auditSink == nil {
+		return
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	if err := auditSink.Write(rec); err != nil {
+		log.Printf("ERROR: unable to write audit record %+v: %v", rec, err)
+	}
+}
+
+// auditSystem writes audit record of operation performed by the service
+// itself, e.g. by lifecycle rules
+func auditSystem(operation, area, fpath string, size int64, err error) {
+	rec := AuditRecord{Subject: "system", Operation: operation, Area: area, Path: fpath, Size: size, Outcome: AuditSuccess}
+	if err != nil {
+		rec.Outcome = AuditFailure
+		rec.Error = err.Error()
+	}
+	writeAudit(rec)
+}
+
+// auditReads represents routes of sensitive reads which are audited along
+// with all routes which modify storage areas
+var auditReads = map[string]bool{
+	"/data":                     true,
+	"/archive":                  true,
+	"/archive/:area/:dir":       true,
+	"/storage/:area/:dir/:file": true,
+	"/presign/:area/:dir/:file": true,
+	"/signed/:area/:dir/:file":  true,
+	"/audit":                    true,
+}
+
+// auditOperations represents names of audited operations which differ from
+// default resource.action names derived from their routes
+var auditOperations = map[string]string{
+	"GET /storage/:area/:dir/:file":      "storage.download",
+	"POST /storage/:area/:dir":           "storage.create",
+	"POST /storage/:area/:dir/:file":     "storage.upload",
+	"GET /data":                          "data.read",
+	"GET /archive":                       "archive.download",
+	"GET /archive/:area/:dir":            "archive.download",
+	"GET /signed/:area/:dir/:file":       "signed.download",
+	"PUT /signed/:area/:dir/:file":       "signed.upload",
+	"POST /versions/:area/:dir/:file":    "versions.restore",
+	"POST /trash/:area/:id":              "trash.restore",
+	"DELETE /trash/:area/:id":            "trash.purge",
+	"POST /uploads":                      "uploads.create",
+	"PUT /uploads/:id/:chunk":            "uploads.chunk",
+	"POST /uploads/:id":                  "uploads.complete",
+	"DELETE /uploads/:id":                "uploads.abort",
+	"GET /uploads/:id":                   "uploads.status",
+	"POST /copy":                         "copy",
+	"POST /move":                         "move",
+	"GET /audit":                         "audit.query",
+	"DELETE /metadata/cache":             "metadata.cache.delete",
+	"DELETE /retention/:area/:dir/:file": "retention.release",
+}
+
+// auditOperation provides name of audited operation of given route
+func auditOperation(method, route string) string {
+	if op, ok := auditOperations[method+" "+route]; ok {
+		return op
+	}
+	resource := strings.Split(strings.TrimPrefix(route, "/"), "/")[0]
+	switch method {
+	case "GET":
+		return resource + ".read"
+	case "POST":
+		return resource + ".create"
+	case "PUT":
+		return resource + ".update"
+	case "DELETE":
+		return resource + ".delete"
+	}
+	return resource + "." + strings.ToLower(method)
+}
+
+// auditRoutes splits routes into routes which are not audited and audited
+// routes which modify storage areas or provide sensitive reads
+func auditRoutes(routes []server.Route) ([]server.Route, []server.Route) {
+	var plain, audited []server.Route
+	for _, route := range routes {
+		if route.Method == "GET" && !auditReads[route.Path] {
+			plain = append(plain, route)
+			continue
+		}
+		audited = append(audited, route)
+	}
+	return plain, audited
+}
+
+// registerAuditRoutes registers audited routes within groups of their scopes
+// where audit middleware precedes authorization middleware, i.e. requests
+// rejected due to missing or invalid access token are audited as well
+func registerAuditRoutes(r *gin.Engine, routes []server.Route, verbose int) {
+	groups := make(map[string]*gin.RouterGroup)
+	for _, route := range routes {
+		scope := route.Scope
+		if scope == "" {
+			scope = "read"
+		}
+		if !route.Authorized {
+			scope = ""
+		}
+		group, ok := groups[scope]
+		if !ok {
+			group = r.Group("/")
+			group.Use(auditMiddleware())
+			if scope != "" {
+				group.Use(authz.ScopeTokenMiddleware(scope, srvConfig.Config.Authz.ClientID, verbose))
+			}
+			groups[scope] = group
+		}
+		log.Printf("method %s path %s auth %v scope '%s' audited", route.Method, route.Path, route.Authorized, scope)
+		group.Handle(route.Method, route.Path, route.Handler)
+	}
+}
+
+// maxAuditBody represents maximum size of response body kept to extract
+// error of failed request
+const maxAuditBody = 4096
+
+// auditWriter keeps response body of failed requests
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write implements io.Writer interface
+func (w *auditWriter) Write(data []byte) (int, error) {
+	if w.Status() >= http.StatusBadRequest && w.body.Len() < maxAuditBody {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString implements io.StringWriter interface
+func (w *auditWriter) WriteString(data string) (int, error) {
+	if w.Status() >= http.StatusBadRequest && w.body.Len() < maxAuditBody {
+		w.body.WriteString(data)
+	}
+	return w.ResponseWriter.WriteString(data)
+}
+
+// auditKey represents key of audit record within gin context
+const auditKey = "audit"
+
+// helper function to provide user of access token of HTTP request
+func auditSubject(r *http.Request) string {
+	if user := tokenUser(r); user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// auditMiddleware provides middleware which writes audit record of every
+// request of audited route along with its outcome
+func auditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if auditSink == nil {
+			c.Next()
+			return
+		}
+		method, route := c.Request.Method, c.FullPath()
+		start := time.Now()
+		rec := &AuditRecord{
+			Time:      start,
+			Subject:   auditSubject(c.Request),
+			Operation: auditOperation(method, route),
+			Method:    method,
+			Route:     route,
+			Area:      c.Param("area"),
+			Path:      strings.Trim(path.Join(c.Param("dir"), c.Param("file")), "/"),
+			ClientIP:  c.ClientIP(),
+		}
+		c.Set(auditKey, rec)
+		writer := &auditWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		rec.Duration = time.Since(start).Seconds()
+		rec.Status = writer.Status()
+		rec.Outcome = AuditSuccess
+		if rec.Status >= http.StatusBadRequest {
+			rec.Outcome = AuditFailure
+			var resp struct {
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(writer.body.Bytes(), &resp); err == nil {
+				rec.Error = resp.Error
+			}
+			// errors of authorization middleware may contain access token
+			if token := authz.RequestToken(c.Request); token != "" {
+				rec.Error = strings.ReplaceAll(rec.Error, token, "<token>")
+			}
+		}
+		if rec.Size == 0 && method == "GET" && rec.Outcome == AuditSuccess && writer.Size() > 0 {
+			rec.Size = int64(writer.Size())
+		}
+		writeAudit(*rec)
+	}
+}
+
+// helper function to provide audit record of HTTP request
+func auditRecord(c *gin.Context) *AuditRecord {
+	if val, ok := c.Get(auditKey); ok {
+		if rec, ok := val.(*AuditRecord); ok {
+			return rec
+		}
+	}
+	return nil
+}
+
+// auditPath records storage area and path of audited request
+func auditPath(c *gin.Context, area, dir, file string) {
+	if rec := auditRecord(c); rec != nil {
+		rec.Area = area
+		rec.Path = strings.Trim(path.Join(dir, file), "/")
+	}
+}
+
+// auditMeta records size and checksums of file of audited request
+func auditMeta(c *gin.Context, size int64, checksums map[string]string) {
+	if rec := auditRecord(c); rec != nil {
+		rec.Size = size
+		rec.Checksums = checksums
+	}
+}
+
+// auditData records file of DID data location which is downloaded by
+// audited request
+func auditData(c *gin.Context, fname string) {
+	if rec := auditRecord(c); rec != nil {
+		rec.Operation = "data.download"
+		rec.Path = fname
+	}
+}
+
+// auditTarget records destination of copied or moved file of audited request
+func auditTarget(c *gin.Context, target string) {
+	if rec := auditRecord(c); rec != nil {
+		rec.Target = target
+	}
+}
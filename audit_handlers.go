@@ -0,0 +1,54 @@
+package main
+
+// audit handlers module provides access to audit log of storage mutations
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditRecords represents maximum number of audit records of single query
+const maxAuditRecords = 10000
+
+// AuditHandler provides access to GET /audit end-point which requires
+// admin scope of access token
+/*
+```
+# get latest 100 audit records
+curl "http://localhost:8340/audit?limit=100"
+# get failed deletions of raw storage area since given time
+curl "http://localhost:8340/audit?area=raw&operation=storage.delete&outcome=failure&since=2024-01-01T00:00:00Z"
+# get operations of given user within dir
+curl "http://localhost:8340/audit?subject=user&path=dir/"
+```
+*/
+func AuditHandler(c *gin.Context) {
+	querier, ok := auditSink.(AuditQuerier)
+	if !ok {
+		err := fmt.Errorf("%w: query of audit log", ErrNotSupported)
+		c.JSON(http.StatusNotImplemented, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	var query AuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if query.Limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": "limit should not be negative"})
+		return
+	}
+	if query.Limit == 0 || query.Limit > maxAuditRecords {
+		query.Limit = maxAuditRecords
+	}
+	records, err := querier.Query(query)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": records})
+}
@@ -0,0 +1,249 @@
+package main
+
+// backend module provides generic storage backend interface
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StorageBackend represents generic interface of storage backends, e.g. local
+// file-system or S3. The storage is organized as set of top-level directories
+// (S3 buckets) which contain files (S3 objects). The List method lists
+// top-level directories if dir is empty, otherwise it lists entries of given
+// directory up to given depth (negative depth means unlimited depth).
+type StorageBackend interface {
+	Type() string
+	Capabilities() []string
+	List(dir string, depth int) ([]Metadata, error)
+	Open(dir, file string) (io.ReadSeekCloser, Metadata, error)
+	Stat(dir, file string) (Metadata, error)
+	Create(dir string) error
+	Upload(dir, file, ctype string, reader io.Reader, size int64, expect map[string]string) (Metadata, error)
+	Delete(dir, file string) error
+	Copy(srcDir, srcFile, dstDir, dstFile string) (Metadata, error)
+}
+
+// ContextLister represents storage backend which supports cancellable and
+// bounded listings, the truncated flag reports partial listing
+type ContextLister interface {
+	ListContext(ctx context.Context, dir string, depth int) ([]Metadata, bool, error)
+}
+
+// PageLister represents storage backend which streams entries of directory
+// in ascending order of their names, the names of directories are ordered
+// with trailing slash (like S3 common prefixes). The listing starts after
+// given name (cursor), it stops when fn returns false and truncated flag
+// reports partial listing.
+type PageLister interface {
+	ListAfter(ctx context.Context, dir string, depth int, after string, fn func(Metadata) bool) (bool, error)
+}
+
+// listContext lists directory of storage backend using given context if
+// backend supports it
+func listContext(ctx context.Context, backend StorageBackend, dir string, depth int) ([]Metadata, bool, error) {
+	if lister, ok := backend.(ContextLister); ok {
+		return lister.ListContext(ctx, dir, depth)
+	}
+	entries, err := backend.List(dir, depth)
+	return entries, false, err
+}
+
+// Mover represents storage backend which can rename files within the
+// backend, files of other backends are moved via copy and delete
+type Mover interface {
+	Move(srcDir, srcFile, dstDir, dstFile string) (Metadata, error)
+}
+
+// Presigner represents storage backend which can issue presigned URLs, i.e.
+// clients may download (GET) or upload (PUT) files directly to the storage
+type Presigner interface {
+	Presign(method, dir, file string, expires time.Duration) (string, error)
+}
+
+// Version represents version of a file (S3 object)
+type Version struct {
+	VersionID      string            `json:"version_id"`
+	Size           int64             `json:"size"`
+	ModTime        time.Time         `json:"mod_time"`
+	IsLatest       bool              `json:"is_latest"`
+	IsDeleteMarker bool              `json:"is_delete_marker,omitempty"`
+	ContentType    string            `json:"content_type,omitempty"`
+	ETag           string            `json:"etag,omitempty"`
+	Checksums      map[string]string `json:"checksums,omitempty"`
+}
+
+// Versioner represents storage backend which keeps prior versions of files
+// (S3 objects) within directories (S3 buckets) with enabled versioning.
+// Versions are listed from the latest to the oldest one.
+type Versioner interface {
+	Versioning(dir string) (bool, error)
+	SetVersioning(dir string, enabled bool) error
+	Versions(dir, file string) ([]Version, error)
+	OpenVersion(dir, file, versionID string) (io.ReadSeekCloser, Metadata, error)
+	DeleteVersion(dir, file, versionID string) error
+	RestoreVersion(dir, file, versionID string) (Metadata, error)
+}
+
+// sortVersions orders versions from the latest to the oldest one
+func sortVersions(versions []Version) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].IsLatest != versions[j].IsLatest {
+			return versions[i].IsLatest
+		}
+		return versions[i].ModTime.After(versions[j].ModTime)
+	})
+}
+
+// LifecycleRule represents lifecycle rule of files (S3 objects) within
+// directory (S3 bucket), the ages of files are counted in days since their
+// last modification
+type LifecycleRule struct {
+	ID               string `json:"id" mapstructure:"ID"`
+	Prefix           string `json:"prefix,omitempty" mapstructure:"Prefix"`                       // prefix of files the rule applies to
+	Disabled         bool   `json:"disabled,omitempty" mapstructure:"Disabled"`                   // rule is kept but not applied
+	ExpireDays       int    `json:"expire_days,omitempty" mapstructure:"ExpireDays"`              // delete files older than given number of days
+	TransitionDays   int    `json:"transition_days,omitempty" mapstructure:"TransitionDays"`      // archive files older than given number of days
+	TransitionTarget string `json:"transition_target,omitempty" mapstructure:"TransitionTarget"`  // S3 storage class or storage area of archived files
+	AbortUploadsDays int    `json:"abort_uploads_days,omitempty" mapstructure:"AbortUploadsDays"` // abort incomplete uploads older than given number of days
+}
+
+// LifecycleManager represents storage backend which keeps lifecycle rules
+// of directories (S3 buckets), the rules of S3 buckets are applied by S3
+// storage while rules of other backends are applied by DataManagement service
+type LifecycleManager interface {
+	Lifecycle(dir string) ([]LifecycleRule, error)
+	SetLifecycle(dir string, rules []LifecycleRule) error
+}
+
+// retention modes, the governance retention can be removed by clients with
+// delete scope while the compliance retention can only be extended
+const (
+	RetentionGovernance = "governance"
+	RetentionCompliance = "compliance"
+)
+
+// Retention represents retention (object lock) and legal hold of a file (S3
+// object), the file can not be deleted or replaced until its retention ends
+// and its legal hold is removed
+type Retention struct {
+	Mode        string    `json:"mode,omitempty"`
+	RetainUntil time.Time `json:"retain_until,omitzero"`
+	LegalHold   bool      `json:"legal_hold"`
+}
+
+// Active reports if retention of the file is in effect at given time
+func (r Retention) Active(t time.Time) bool {
+	return r.LegalHold || t.Before(r.RetainUntil)
+}
+
+// RetentionManager represents storage backend which keeps retention and
+// legal hold of files (S3 objects)
+type RetentionManager interface {
+	Retention(dir, file string) (Retention, error)
+	SetRetention(dir, file string, retention Retention) error
+}
+
+// TrashEntry represents deleted file (S3 object) or directory (S3 bucket)
+// kept in trash area of storage backend
+type TrashEntry struct {
+	ID          string    `json:"id"`
+	Dir         string    `json:"dir"`
+	File        string    `json:"file,omitempty"`
+	IsDirectory bool      `json:"is_directory"`
+	Size        int64     `json:"size"`  // total size of deleted files
+	Files       int       `json:"files"` // number of deleted files
+	Deleted     time.Time `json:"deleted"`
+}
+
+// Trasher represents storage backend which moves deleted files and
+// directories to recoverable trash area
+type Trasher interface {
+	Trash(dir, file string) (TrashEntry, error)
+	TrashList() ([]TrashEntry, error)
+	Undelete(id string) (TrashEntry, error)
+	Purge(id string) error
+}
+
+// BackendConfig represents configuration of storage backend
+type BackendConfig struct {
+	Name         string `mapstructure:"Name"`         // name of storage area served by the backend
+	Kind         string `mapstructure:"Kind"`         // kind of storage backend, e.g. local, minio, aws
+	Storage      string `mapstructure:"Storage"`      // root directory of file-system storage
+	ReadOnly     bool   `mapstructure:"ReadOnly"`     // file-system storage is read-only
+	Umask        string `mapstructure:"Umask"`        // umask of new files and directories, e.g. 022
+	Owner        string `mapstructure:"Owner"`        // owner of new files and directories
+	Group        string `mapstructure:"Group"`        // group of new files and directories
+	Endpoint     string `mapstructure:"Endpoint"`     // S3 endpoint
+	AccessKey    string `mapstructure:"AccessKey"`    // S3 access key
+	AccessSecret string `mapstructure:"AccessSecret"` // S3 access secret
+	UseSSL       bool   `mapstructure:"UseSSL"`       // use SSL to access S3 endpoint
+	Region       string `mapstructure:"Region"`       // S3 region
+	TrashBucket  string `mapstructure:"TrashBucket"`  // S3 bucket of deleted objects, deletions are permanent without it
+}
+
+// String provides human readable representation of backend configuration
+// without S3 credentials
+func (c BackendConfig) String() string {
+	if c.Endpoint != "" {
+		return fmt.Sprintf("name=%s kind=%s endpoint=%s ssl=%v region=%s", c.Name, c.Kind, c.Endpoint, c.UseSSL, c.Region)
+	}
+	if c.Storage == "" {
+		return fmt.Sprintf("name=%s kind=%s", c.Name, c.Kind)
+	}
+	umask := c.Umask
+	if umask == "" {
+		umask = fmt.Sprintf("%04o", defaultUmask)
+	}
+	return fmt.Sprintf("name=%s kind=%s root=%s read-only=%v umask=%s owner=%s group=%s",
+		c.Name, c.Kind, c.Storage, c.ReadOnly, umask, c.Owner, c.Group)
+}
+
+// BackendFactory creates storage backend for given configuration
+type BackendFactory func(config BackendConfig) (StorageBackend, error)
+
+// backendFactories keeps factories of all known storage backends
+var backendFactories = make(map[string]BackendFactory)
+
+// RegisterBackend registers storage backend factory for given kind of storage
+func RegisterBackend(kind string, factory BackendFactory) {
+	backendFactories[strings.ToLower(kind)] = factory
+}
+
+// NewStorageBackend creates storage backend for given configuration
+func NewStorageBackend(config BackendConfig) (StorageBackend, error) {
+	factory, ok := backendFactories[strings.ToLower(config.Kind)]
+	if !ok {
+		var kinds []string
+		for kind := range backendFactories {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		return nil, fmt.Errorf("unsupported storage backend '%s', supported backends: %v", config.Kind, kinds)
+	}
+	backend, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewStorageBackend] factory error: %w", err)
+	}
+	return backend, nil
+}
+
+func init() {
+	localFactory := func(config BackendConfig) (StorageBackend, error) {
+		return NewLocalFsClientFromConfig(config)
+	}
+	RegisterBackend("local", localFactory)
+	RegisterBackend("posix", localFactory)
+	RegisterBackend("nfs", localFactory)
+	s3Factory := func(config BackendConfig) (StorageBackend, error) {
+		return NewS3Backend(config)
+	}
+	RegisterBackend("minio", s3Factory)
+	RegisterBackend("aws", s3Factory)
+}
@@ -0,0 +1,607 @@
+package main
+
+// catalog module provides persistent index of files of DID data locations
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// catalog buckets, every data location has its own bucket with nested
+// buckets of files and directories
+var (
+	catalogFiles = []byte("files")
+	catalogDirs  = []byte("dirs")
+	catalogInfo  = []byte("info")
+)
+
+// CatalogEntry represents indexed file or directory
+type CatalogEntry struct {
+	Size        int64             `json:"size"`
+	ModTime     time.Time         `json:"mod_time"`
+	IsDirectory bool              `json:"is_dir,omitempty"`
+	Extension   string            `json:"ext,omitempty"`
+	ContentType string            `json:"ctype,omitempty"`
+	Checksums   map[string]string `json:"checksums,omitempty"`
+}
+
+// catalogDir represents indexed directory, its modification time changes
+// when entries of the directory are created, renamed or removed and therefore
+// entries of directory are read again only if its modification time differs
+// from the indexed one
+type catalogDir struct {
+	ModTime time.Time `json:"mod_time"`
+	Entries int       `json:"entries"`
+	Subdirs []string  `json:"subdirs,omitempty"`
+}
+
+// catalogRacyTime defines how long after its modification the directory is
+// read again on next refresh, since entries created within resolution of
+// file-system timestamps do not change modification time of the directory
+const catalogRacyTime = time.Second
+
+// catalogRefresh represents in-flight refresh of data location index
+type catalogRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// Catalog represents persistent index of files of data locations. The index
+// is populated on demand, i.e. when data location is queried for the first
+// time, and it is refreshed incrementally in background: only directories
+// whose modification time has changed are read again and only their new,
+// changed (by size or modification time) and removed entries are updated.
+// Modifications of existing files do not change modification time of their
+// directories, they are applied by file-system watcher via Touch.
+type Catalog struct {
+	DB      *bolt.DB      // embedded key-value store
+	Refresh time.Duration // interval between refreshes of data location index
+
+	mu        sync.Mutex
+	refreshed map[string]time.Time
+	truncated map[string]bool // data locations with partial index
+	inflight  map[string]*catalogRefresh
+}
+
+// fileCatalog represents file catalog of the service, nil value means that
+// catalog is disabled and file-system is walked directly
+var fileCatalog *Catalog
+
+// NewCatalog opens file catalog stored in given file
+func NewCatalog(fname string, refresh time.Duration) (*Catalog, error) {
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewCatalog] os.MkdirAll error: %w", err)
+	}
+	db, err := bolt.Open(fname, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewCatalog] bolt.Open error: %w", err)
+	}
+	catalog := &Catalog{
+		DB:        db,
+		Refresh:   refresh,
+		refreshed: make(map[string]time.Time),
+		truncated: make(map[string]bool),
+		inflight:  make(map[string]*catalogRefresh),
+	}
+	return catalog, nil
+}
+
+// Close closes file catalog
+func (c *Catalog) Close() error {
+	return c.DB.Close()
+}
+
+// List returns indexed entries of sub-path of data location up to given
+// depth (negative depth means unlimited depth), names of entries are
+// relative to given sub-path. The truncated flag is set if the index of
+// data location is partial due to walk limits.
+func (c *Catalog) List(ctx context.Context, root, spath string, depth int) ([]Metadata, bool, error) {
+	truncated, err := c.ensure(ctx, root)
+	if err != nil {
+		return nil, false, err
+	}
+	prefix := catalogPrefix(spath)
+	var entries []Metadata
+	err = c.DB.View(func(tx *bolt.Tx) error {
+		files := catalogBucket(tx, root, catalogFiles)
+		if files == nil {
+			return nil
+		}
+		cur := files.Cursor()
+		for k, v := cur.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = cur.Next() {
+			rel := string(k[len(prefix):])
+			if depth > 0 && strings.Count(rel, "/")+1 > depth {
+				continue
+			}
+			var entry CatalogEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, Metadata{
+				Name:        rel,
+				Size:        entry.Size,
+				ModTime:     entry.ModTime,
+				IsDirectory: entry.IsDirectory,
+				ContentType: entry.ContentType,
+				ETag:        fileETag(entry.ModTime, entry.Size),
+				Checksums:   entry.Checksums,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("[DataManagement.main.Catalog.List] DB.View error: %w", err)
+	}
+	return entries, truncated, nil
+}
+
+// Extensions returns unique extensions of indexed files of sub-path of data location
+func (c *Catalog) Extensions(ctx context.Context, root, spath string) ([]string, error) {
+	entries, _, err := c.List(ctx, root, spath, -1)
+	if err != nil {
+		return nil, err
+	}
+	extMap := make(map[string]bool)
+	for _, entry := range entries {
+		if ext := path.Ext(entry.Name); !entry.IsDirectory && ext != "" {
+			extMap[ext] = true
+		}
+	}
+	var extensions []string
+	for ext := range extMap {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+	return extensions, nil
+}
+
+// Touch updates index entry of given file (relative path) of data location
+// which was created, modified or removed. It is used by file-system watcher
+// since modification of existing file does not change modification time of
+// its directory. Created and removed entries change modification time of
+// the parent directory, i.e. it is read again on next refresh of the index.
+func (c *Catalog) Touch(root, rel string) error {
+	root = filepath.Clean(root)
+	rel = strings.TrimSuffix(catalogPrefix(rel), "/")
+	if rel == "" {
+		return nil
+	}
+	err := c.DB.Update(func(tx *bolt.Tx) error {
+		files := catalogBucket(tx, root, catalogFiles)
+		dirs := catalogBucket(tx, root, catalogDirs)
+		if files == nil || dirs == nil {
+			// data location is not indexed yet
+			return nil
+		}
+		idx := catalogIndex{client: NewLocalFsClient(root), files: files, dirs: dirs}
+		fname := filepath.Join(root, filepath.FromSlash(rel))
+		if info, err := os.Lstat(fname); err == nil {
+			return idx.put(rel, fname, info)
+		}
+		return idx.remove(rel)
+	})
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.Catalog.Touch] DB.Update error: %w", err)
+	}
+	return nil
+}
+
+// helper function to ensure that index of data location is fresh, the
+// refresh of data location is performed only once for concurrent queries
+// and it is not interrupted when the query context is cancelled. Queries
+// wait for the refresh only until the index is built, afterwards they are
+// served from the index while it is refreshed in background. It returns
+// truncated flag if the index is partial due to walk limits.
+func (c *Catalog) ensure(ctx context.Context, root string) (bool, error) {
+	root = filepath.Clean(root)
+	c.mu.Lock()
+	ts, built := c.refreshed[root]
+	if !built {
+		// the index may be built by previous run of the service
+		var truncated bool
+		if truncated, built = c.indexed(root); built {
+			c.refreshed[root] = time.Time{}
+			c.truncated[root] = truncated
+		}
+	}
+	if built && time.Since(ts) < c.Refresh {
+		truncated := c.truncated[root]
+		c.mu.Unlock()
+		return truncated, nil
+	}
+	call, ok := c.inflight[root]
+	if !ok {
+		call = &catalogRefresh{done: make(chan struct{})}
+		c.inflight[root] = call
+		go func() {
+			start := time.Now()
+			truncated, err := c.refresh(root)
+			if err != nil {
+				log.Printf("WARNING: catalog refresh of %s failed: %v", root, err)
+			}
+			call.err = err
+			c.mu.Lock()
+			delete(c.inflight, root)
+			if err == nil {
+				c.refreshed[root] = start
+				c.truncated[root] = truncated
+			}
+			c.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	truncated := c.truncated[root]
+	c.mu.Unlock()
+	if built {
+		return truncated, nil
+	}
+	select {
+	case <-call.done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.truncated[root], call.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// helper function to check if index of data location is built, it returns
+// truncated flag of the index
+func (c *Catalog) indexed(root string) (bool, bool) {
+	var truncated, built bool
+	c.DB.View(func(tx *bolt.Tx) error {
+		if info := catalogBucket(tx, root, catalogInfo); info != nil {
+			built = info.Get([]byte("refreshed")) != nil
+			truncated = string(info.Get([]byte("truncated"))) == "true"
+		}
+		return nil
+	})
+	return truncated, built
+}
+
+// helper function to read indexed directory of data location
+func (c *Catalog) indexedDir(root, rel string) (catalogDir, bool) {
+	var dir catalogDir
+	var found bool
+	c.DB.View(func(tx *bolt.Tx) error {
+		dirs := catalogBucket(tx, root, catalogDirs)
+		if dirs == nil {
+			return nil
+		}
+		if data := dirs.Get(catalogDirKey(rel)); data != nil {
+			found = json.Unmarshal(data, &dir) == nil
+		}
+		return nil
+	})
+	return dir, found
+}
+
+// helper function to refresh index of data location, directories which are
+// not modified since their last refresh are not read and every modified
+// directory is synchronized within its own transaction to keep write lock of
+// the catalog short. The refresh is bounded by configured walk limits and it
+// returns truncated flag if the limits are reached.
+func (c *Catalog) refresh(root string) (bool, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return false, fmt.Errorf("[DataManagement.main.Catalog.refresh] os.Stat error: %w", err)
+	}
+	if !info.IsDir() {
+		return false, fmt.Errorf("[DataManagement.main.Catalog.refresh] %s is not a directory", root)
+	}
+	err = c.DB.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(root))
+		if err != nil {
+			return err
+		}
+		for _, name := range [][]byte{catalogFiles, catalogDirs, catalogInfo} {
+			if _, err := bucket.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("[DataManagement.main.Catalog.refresh] DB.Update error: %w", err)
+	}
+
+	start := time.Now()
+	var deadline time.Time
+	if dmConfig.Walk.Timeout > 0 {
+		deadline = start.Add(time.Duration(dmConfig.Walk.Timeout) * time.Second)
+	}
+	client := NewLocalFsClient(root)
+	var count, updated, skipped int
+	var truncated bool
+	queue := []string{""}
+	for len(queue) > 0 {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			truncated = true
+			break
+		}
+		rel := queue[0]
+		queue = queue[1:]
+		dpath := filepath.Join(root, filepath.FromSlash(rel))
+		info, err := os.Stat(dpath)
+		if err != nil || !info.IsDir() {
+			// directory was removed while we were scanning
+			continue
+		}
+		if stored, ok := c.indexedDir(root, rel); ok && stored.ModTime.Equal(info.ModTime()) {
+			if limit := dmConfig.Walk.MaxEntries; limit > 0 && count+stored.Entries > limit {
+				truncated = true
+				break
+			}
+			count += stored.Entries
+			skipped++
+			for _, sub := range stored.Subdirs {
+				queue = append(queue, path.Join(rel, sub))
+			}
+			continue
+		}
+		dir, ok := readCatalogDir(root, rel, dpath, info)
+		if !ok {
+			continue
+		}
+		if start.Sub(dir.ModTime) < catalogRacyTime {
+			dir.ModTime = time.Time{}
+		}
+		if limit := dmConfig.Walk.MaxEntries; limit > 0 && count+len(dir.entries) > limit {
+			truncated = true
+			break
+		}
+		count += len(dir.entries)
+		err = c.DB.Update(func(tx *bolt.Tx) error {
+			files := catalogBucket(tx, root, catalogFiles)
+			dirs := catalogBucket(tx, root, catalogDirs)
+			if files == nil || dirs == nil {
+				return fmt.Errorf("index of %s is removed", root)
+			}
+			idx := catalogIndex{client: client, files: files, dirs: dirs}
+			if err := idx.sync(rel, dir); err != nil {
+				return err
+			}
+			updated += idx.updated
+			return nil
+		})
+		if err != nil {
+			return false, fmt.Errorf("[DataManagement.main.Catalog.refresh] DB.Update error: %w", err)
+		}
+		for _, sub := range dir.Subdirs {
+			queue = append(queue, path.Join(rel, sub))
+		}
+	}
+	if truncated {
+		log.Printf("WARNING: catalog refresh of %s is truncated after %d entries", root, count)
+	}
+	err = c.DB.Update(func(tx *bolt.Tx) error {
+		info := catalogBucket(tx, root, catalogInfo)
+		if info == nil {
+			return nil
+		}
+		if err := info.Put([]byte("truncated"), []byte(fmt.Sprint(truncated))); err != nil {
+			return err
+		}
+		return info.Put([]byte("refreshed"), []byte(start.Format(time.RFC3339)))
+	})
+	if err != nil {
+		return truncated, fmt.Errorf("[DataManagement.main.Catalog.refresh] DB.Update error: %w", err)
+	}
+	log.Printf("catalog: refreshed %s, %d entries of %d are updated, %d directories are unchanged, in %v", root, updated, count, skipped, time.Since(start))
+	return truncated, nil
+}
+
+// catalogDirEntries represents directory of data location read from
+// file-system along with information about its entries
+type catalogDirEntries struct {
+	catalogDir
+	path    string
+	info    os.FileInfo
+	entries []os.FileInfo
+}
+
+// helper function to read directory of data location, the directory is
+// skipped if it can't be read. The directory information should be obtained
+// before its entries are read to detect modifications made while reading.
+func readCatalogDir(root, rel, dpath string, info os.FileInfo) (catalogDirEntries, bool) {
+	dir := catalogDirEntries{path: dpath, info: info}
+	dir.ModTime = info.ModTime()
+	entries, err := os.ReadDir(dir.path)
+	if err != nil {
+		log.Printf("WARNING: catalog unable to read %s: %v", dir.path, err)
+		return dir, false
+	}
+	for _, entry := range entries {
+		if rel == "" && entry.Name() == metaArea {
+			continue
+		}
+		finfo, err := entry.Info()
+		if err != nil {
+			// entry was removed while we were reading the directory
+			continue
+		}
+		dir.entries = append(dir.entries, finfo)
+		dir.Entries++
+		if finfo.IsDir() {
+			dir.Subdirs = append(dir.Subdirs, finfo.Name())
+		}
+	}
+	return dir, true
+}
+
+// catalogIndex represents update of data location index within single transaction
+type catalogIndex struct {
+	client  *LocalFsClient
+	files   *bolt.Bucket
+	dirs    *bolt.Bucket
+	updated int // number of updated entries
+}
+
+// helper function to synchronize index of directory with its entries read
+// from file-system, only new entries and entries whose size or modification
+// time has changed are updated and stale entries are removed along with
+// their sub-trees. The entry of directory itself is updated too since its
+// parent directory may not be read.
+func (idx *catalogIndex) sync(rel string, dir catalogDirEntries) error {
+	if rel != "" {
+		if err := idx.put(rel, dir.path, dir.info); err != nil {
+			return err
+		}
+	}
+	prefix := catalogPrefix(rel)
+	seen := make(map[string]bool)
+	for _, info := range dir.entries {
+		seen[info.Name()] = true
+		name := prefix + info.Name()
+		if data := idx.files.Get([]byte(name)); data != nil {
+			var entry CatalogEntry
+			if err := json.Unmarshal(data, &entry); err == nil && entry.IsDirectory == info.IsDir() &&
+				entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+				continue
+			}
+		}
+		if err := idx.put(name, filepath.Join(dir.path, info.Name()), info); err != nil {
+			return err
+		}
+		idx.updated++
+	}
+
+	// find stale direct children of the directory, the sub-trees of children
+	// are skipped by seeking the key which follows all keys of the sub-tree
+	stale := make(map[string]bool)
+	cur := idx.files.Cursor()
+	for k, _ := cur.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); {
+		child, _, nested := strings.Cut(string(k[len(prefix):]), "/")
+		if !seen[child] {
+			stale[child] = true
+		}
+		if nested {
+			k, _ = cur.Seek([]byte(prefix + child + "0"))
+		} else {
+			k, _ = cur.Next()
+		}
+	}
+	for child := range stale {
+		if err := idx.remove(prefix + child); err != nil {
+			return err
+		}
+		idx.updated++
+	}
+
+	data, err := json.Marshal(dir.catalogDir)
+	if err != nil {
+		return err
+	}
+	return idx.dirs.Put(catalogDirKey(rel), data)
+}
+
+// helper function to remove entry along with its sub-tree from the index
+func (idx *catalogIndex) remove(rel string) error {
+	keys := [][]byte{[]byte(rel)}
+	prefix := []byte(rel + "/")
+	cur := idx.files.Cursor()
+	for k, _ := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cur.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := idx.files.Delete(k); err != nil {
+			return err
+		}
+		if err := idx.dirs.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper function to put file or directory into the index
+func (idx *catalogIndex) put(name, fname string, info os.FileInfo) error {
+	meta := idx.client.fileMetadata(fname, info)
+	entry := CatalogEntry{
+		Size:        meta.Size,
+		ModTime:     meta.ModTime,
+		IsDirectory: meta.IsDirectory,
+		ContentType: meta.ContentType,
+		Checksums:   meta.Checksums,
+	}
+	if !entry.IsDirectory {
+		entry.Extension = strings.ToLower(filepath.Ext(name))
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return idx.files.Put([]byte(name), data)
+}
+
+// helper function to get nested bucket of data location
+func catalogBucket(tx *bolt.Tx, root string, name []byte) *bolt.Bucket {
+	bucket := tx.Bucket([]byte(filepath.Clean(root)))
+	if bucket == nil {
+		return nil
+	}
+	return bucket.Bucket(name)
+}
+
+// helper function to build key of indexed directory
+func catalogDirKey(rel string) []byte {
+	if rel == "" {
+		return []byte(".")
+	}
+	return []byte(rel)
+}
+
+// helper function to build key prefix of entries of given sub-path
+func catalogPrefix(spath string) string {
+	spath = path.Clean("/" + filepath.ToSlash(spath))
+	if spath == "/" {
+		return ""
+	}
+	return strings.TrimPrefix(spath, "/") + "/"
+}
+
+// listLocation lists entries of sub-path of data location up to given depth,
+// it uses file catalog if it is enabled and walks file-system otherwise
+func listLocation(ctx context.Context, location, spath string, depth int) ([]Metadata, bool, error) {
+	client := NewLocalFsClient(location)
+	if fsWatcher != nil {
+		// keep index of data location fresh and notify clients about its changes
+		fsWatcher.WatchLocation(location)
+	}
+	if fileCatalog == nil {
+		return client.ListContext(ctx, spath, depth)
+	}
+	// user supplied path should stay within data location
+	if _, err := client.resolve(spath); err != nil {
+		return nil, false, fmt.Errorf("[DataManagement.main.listLocation] resolve error: %w", err)
+	}
+	return fileCatalog.List(ctx, location, spath, depth)
+}
+
+// initCatalog initializes file catalog of the service according to configuration
+func initCatalog() error {
+	if dmConfig.Catalog.Path == "" {
+		return nil
+	}
+	refresh := time.Duration(dmConfig.Catalog.Refresh) * time.Second
+	catalog, err := NewCatalog(dmConfig.Catalog.Path, refresh)
+	if err != nil {
+		return err
+	}
+	fileCatalog = catalog
+	return nil
+}
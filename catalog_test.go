@@ -0,0 +1,217 @@
+package main
+
+// catalog tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// helper function to create catalog stored in temporary directory
+func testCatalog(t *testing.T) *Catalog {
+	t.Helper()
+	catalog, err := NewCatalog(filepath.Join(t.TempDir(), "catalog.db"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { catalog.Close() })
+	return catalog
+}
+
+// helper function to create files with given content in root directory,
+// modification time of files and just modified directories is set in the
+// past to avoid re-reading of racy directories
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	mtime := time.Now().Add(-time.Hour)
+	for name, content := range files {
+		fname := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && time.Since(info.ModTime()) < time.Minute {
+			os.Chtimes(path, mtime, mtime)
+		}
+		return nil
+	})
+}
+
+// helper function to read indexed entries of data location
+func indexedEntries(t *testing.T, catalog *Catalog, root string) map[string]CatalogEntry {
+	t.Helper()
+	entries := make(map[string]CatalogEntry)
+	err := catalog.DB.View(func(tx *bolt.Tx) error {
+		files := catalogBucket(tx, root, catalogFiles)
+		if files == nil {
+			return nil
+		}
+		return files.ForEach(func(k, v []byte) error {
+			var entry CatalogEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries[string(k)] = entry
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// helper function to refresh index of data location
+func refreshCatalog(t *testing.T, catalog *Catalog, root string) {
+	t.Helper()
+	if truncated, err := catalog.refresh(root); err != nil || truncated {
+		t.Fatalf("unexpected refresh result, truncated %v error %v", truncated, err)
+	}
+}
+
+// helper function to check that entries are (not) indexed
+func checkIndexed(t *testing.T, entries map[string]CatalogEntry, indexed bool, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, ok := entries[name]; ok != indexed {
+			t.Fatalf("expected %s indexed %v, entries %v", name, indexed, entries)
+		}
+	}
+}
+
+// TestCatalogIncrementalRefresh tests that only modified directories are
+// read on refresh of the index
+func TestCatalogIncrementalRefresh(t *testing.T) {
+	root := t.TempDir()
+	catalog := testCatalog(t)
+	writeFiles(t, root, map[string]string{"a/f1": "1", "b/f2": "2", "b/c/f3": "3"})
+	refreshCatalog(t, catalog, root)
+	checkIndexed(t, indexedEntries(t, catalog, root), true, "a", "a/f1", "b", "b/f2", "b/c", "b/c/f3")
+
+	// new file of directory a is indexed while directory b whose
+	// modification time is restored is not read again
+	bdir := filepath.Join(root, "b")
+	info, err := os.Stat(bdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(bdir, "f2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(bdir, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, root, map[string]string{"a/f4": "4", "b/c/f5": "5"})
+	refreshCatalog(t, catalog, root)
+	entries := indexedEntries(t, catalog, root)
+	checkIndexed(t, entries, true, "a/f1", "a/f4", "b/f2", "b/c/f5")
+
+	// modified directory is read again
+	now := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(bdir, now, now); err != nil {
+		t.Fatal(err)
+	}
+	refreshCatalog(t, catalog, root)
+	entries = indexedEntries(t, catalog, root)
+	checkIndexed(t, entries, false, "b/f2")
+	checkIndexed(t, entries, true, "b/c/f3", "b/c/f5")
+	if !entries["b"].ModTime.Equal(now) {
+		t.Fatalf("expected modification time of directory %v, got %v", now, entries["b"].ModTime)
+	}
+}
+
+// TestCatalogStaleEntries tests that removed and renamed entries are removed
+// from the index along with their sub-trees
+func TestCatalogStaleEntries(t *testing.T) {
+	root := t.TempDir()
+	catalog := testCatalog(t)
+	writeFiles(t, root, map[string]string{"a/b/c/f1": "1", "a/f2": "2", "d/f3": "3"})
+	refreshCatalog(t, catalog, root)
+	checkIndexed(t, indexedEntries(t, catalog, root), true, "a/b", "a/b/c", "a/b/c/f1", "a/f2", "d/f3")
+
+	if err := os.RemoveAll(filepath.Join(root, "a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(root, "d"), filepath.Join(root, "e")); err != nil {
+		t.Fatal(err)
+	}
+	refreshCatalog(t, catalog, root)
+	entries := indexedEntries(t, catalog, root)
+	checkIndexed(t, entries, false, "a/b", "a/b/c", "a/b/c/f1", "d", "d/f3")
+	checkIndexed(t, entries, true, "a", "a/f2", "e", "e/f3")
+	for _, rel := range []string{"a/b", "a/b/c", "d"} {
+		if _, ok := catalog.indexedDir(root, rel); ok {
+			t.Fatalf("expected removed directory %s from the index", rel)
+		}
+	}
+}
+
+// TestCatalogTouch tests that single entry is updated by file-system watcher
+func TestCatalogTouch(t *testing.T) {
+	root := t.TempDir()
+	catalog := testCatalog(t)
+	writeFiles(t, root, map[string]string{"a/f1": "1"})
+	refreshCatalog(t, catalog, root)
+
+	// modification of file does not change modification time of its directory
+	if err := os.WriteFile(filepath.Join(root, "a", "f1"), []byte("123"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	refreshCatalog(t, catalog, root)
+	if size := indexedEntries(t, catalog, root)["a/f1"].Size; size != 1 {
+		t.Fatalf("expected size of unchanged directory entry 1, got %d", size)
+	}
+	if err := catalog.Touch(root, "a/f1"); err != nil {
+		t.Fatal(err)
+	}
+	if size := indexedEntries(t, catalog, root)["a/f1"].Size; size != 3 {
+		t.Fatalf("expected size of touched entry 3, got %d", size)
+	}
+
+	if err := os.Remove(filepath.Join(root, "a", "f1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := catalog.Touch(root, "a/f1"); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexed(t, indexedEntries(t, catalog, root), false, "a/f1")
+}
+
+// TestCatalogServesBuiltIndex tests that queries do not wait for refresh of
+// already built index
+func TestCatalogServesBuiltIndex(t *testing.T) {
+	root := t.TempDir()
+	catalog := testCatalog(t)
+	writeFiles(t, root, map[string]string{"a/f1": "1"})
+	refreshCatalog(t, catalog, root)
+
+	// cancelled query would fail if it waited for the refresh
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	entries, _, err := catalog.List(ctx, root, "a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "f1" {
+		t.Fatalf("expected indexed entry f1, got %+v", entries)
+	}
+	// wait for background refresh before the catalog is closed
+	catalog.mu.Lock()
+	call := catalog.inflight[filepath.Clean(root)]
+	catalog.mu.Unlock()
+	if call != nil {
+		<-call.done
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+// checksum module provides computation and verification of file checksums
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// supported checksum algorithms
+const (
+	ChecksumSHA256  = "sha256"
+	ChecksumMD5     = "md5"
+	ChecksumAdler32 = "adler32"
+	ChecksumCRC32C  = "crc32c"
+)
+
+// Checksummer computes checksums of all data written into it using
+// multiple algorithms at once
+type Checksummer struct {
+	hashes map[string]hash.Hash
+}
+
+// NewChecksummer creates new checksummer for given list of algorithms,
+// the unknown algorithms are ignored
+func NewChecksummer(algorithms ...string) *Checksummer {
+	hashes := make(map[string]hash.Hash)
+	for _, alg := range algorithms {
+		switch alg {
+		case ChecksumSHA256:
+			hashes[alg] = sha256.New()
+		case ChecksumMD5:
+			hashes[alg] = md5.New()
+		case ChecksumAdler32:
+			hashes[alg] = adler32.New()
+		case ChecksumCRC32C:
+			hashes[alg] = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+		}
+	}
+	return &Checksummer{hashes: hashes}
+}
+
+// Write implements io.Writer interface
+func (c *Checksummer) Write(p []byte) (int, error) {
+	for _, h := range c.hashes {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// Sums returns hex encoded checksums of written data
+func (c *Checksummer) Sums() map[string]string {
+	sums := make(map[string]string)
+	for alg, h := range c.hashes {
+		sums[alg] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums
+}
+
+// Verify verifies checksums of written data against expected values
+func (c *Checksummer) Verify(expect map[string]string) error {
+	sums := c.Sums()
+	for alg, value := range expect {
+		if sum, ok := sums[alg]; ok && sum != value {
+			return fmt.Errorf("%w: %s checksum is %s, expect %s", ErrChecksumMismatch, alg, sum, value)
+		}
+	}
+	return nil
+}
+
+// checksumAlgorithms returns list of algorithms used for stored files along
+// with algorithms of expected checksums. The SHA-256 is always computed,
+// additional algorithms can be enabled via configuration.
+func checksumAlgorithms(expect map[string]string) []string {
+	algs := map[string]bool{ChecksumSHA256: true}
+	for _, alg := range dmConfig.Checksums {
+		algs[strings.ToLower(alg)] = true
+	}
+	for alg := range expect {
+		algs[alg] = true
+	}
+	var out []string
+	for alg := range algs {
+		out = append(out, alg)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// storedChecksums returns checksums which should be kept along with the file,
+// i.e. it excludes checksums which were only used for verification
+func storedChecksums(sums map[string]string) map[string]string {
+	out := make(map[string]string)
+	for _, alg := range checksumAlgorithms(nil) {
+		if sum, ok := sums[alg]; ok {
+			out[alg] = sum
+		}
+	}
+	return out
+}
+
+// expectedChecksums extracts expected checksums from HTTP request headers,
+// it supports the following headers:
+// - Content-MD5: base64 encoded MD5 digest (RFC 1864)
+// - Digest: list of algorithm=value pairs (RFC 3230), e.g. sha-256=<base64>
+// - X-Checksum-SHA256: hex encoded SHA-256 digest
+// All checksums are returned as hex encoded strings.
+func expectedChecksums(r *http.Request) (map[string]string, error) {
+	expect := make(map[string]string)
+	if val := r.Header.Get("Content-MD5"); val != "" {
+		sum, err := base64ToHex(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Content-MD5 header: %w", err)
+		}
+		expect[ChecksumMD5] = sum
+	}
+	if val := r.Header.Get("Digest"); val != "" {
+		for _, item := range strings.Split(val, ",") {
+			alg, value, found := strings.Cut(strings.TrimSpace(item), "=")
+			if !found {
+				return nil, fmt.Errorf("invalid Digest header item '%s'", item)
+			}
+			var err error
+			var sum string
+			switch strings.ToLower(alg) {
+			case "sha-256":
+				alg = ChecksumSHA256
+				sum, err = base64ToHex(value)
+			case "md5":
+				alg = ChecksumMD5
+				sum, err = base64ToHex(value)
+			case "crc32c":
+				alg = ChecksumCRC32C
+				sum, err = base64ToHex(value)
+			case "adler32":
+				// adler32 digest is represented as hex value (RFC 3230)
+				alg = ChecksumAdler32
+				sum = strings.ToLower(value)
+			default:
+				// skip digest algorithms we do not support
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value of Digest header: %w", alg, err)
+			}
+			expect[alg] = sum
+		}
+	}
+	if val := r.Header.Get("X-Checksum-SHA256"); val != "" {
+		if !sha256Pattern.MatchString(val) {
+			return nil, fmt.Errorf("invalid X-Checksum-SHA256 header, it should contain SHA-256 hex digest")
+		}
+		expect[ChecksumSHA256] = strings.ToLower(val)
+	}
+	return expect, nil
+}
+
+// digestHeader represents hex encoded checksums as value of Digest HTTP
+// header (RFC 3230), e.g. sha-256=<base64>,md5=<base64>
+func digestHeader(sums map[string]string) string {
+	var items []string
+	for _, alg := range []string{ChecksumSHA256, ChecksumMD5, ChecksumCRC32C, ChecksumAdler32} {
+		sum, ok := sums[alg]
+		if !ok {
+			continue
+		}
+		switch alg {
+		case ChecksumSHA256:
+			if val, err := hexToBase64(sum); err == nil {
+				items = append(items, "sha-256="+val)
+			}
+		case ChecksumMD5, ChecksumCRC32C:
+			if val, err := hexToBase64(sum); err == nil {
+				items = append(items, alg+"="+val)
+			}
+		case ChecksumAdler32:
+			// adler32 digest is represented as hex value (RFC 3230)
+			items = append(items, alg+"="+sum)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// helper function to convert hex encoded digest to base64 representation
+func hexToBase64(val string) (string, error) {
+	data, err := hex.DecodeString(val)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// helper function to convert base64 encoded digest to hex representation
+func base64ToHex(val string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(val))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+// checksum tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"errors"
+	"maps"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// checksums of "hello world" content
+var helloSums = map[string]string{
+	ChecksumSHA256:  "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+	ChecksumMD5:     "5eb63bbbe01eeed093cb22bb8f5acdc3",
+	ChecksumAdler32: "1a0b045d",
+	ChecksumCRC32C:  "c99465aa",
+}
+
+// TestChecksummer tests computation and verification of checksums
+func TestChecksummer(t *testing.T) {
+	summer := NewChecksummer(ChecksumSHA256, ChecksumMD5, ChecksumAdler32, ChecksumCRC32C, "unknown")
+	summer.Write([]byte("hello "))
+	summer.Write([]byte("world"))
+	if sums := summer.Sums(); !maps.Equal(sums, helloSums) {
+		t.Fatalf("expected checksums %v, got %v", helloSums, sums)
+	}
+	if err := summer.Verify(helloSums); err != nil {
+		t.Fatal(err)
+	}
+	// checksums of unknown algorithms are not verified
+	if err := summer.Verify(map[string]string{"sha512": "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	err := summer.Verify(map[string]string{ChecksumMD5: strings.Repeat("0", 32)})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+// TestChecksumAlgorithms tests algorithms of computed and stored checksums
+func TestChecksumAlgorithms(t *testing.T) {
+	defer func(algs []string) { dmConfig.Checksums = algs }(dmConfig.Checksums)
+	dmConfig.Checksums = []string{"ADLER32"}
+	algs := checksumAlgorithms(map[string]string{ChecksumMD5: helloSums[ChecksumMD5]})
+	if expect := []string{ChecksumAdler32, ChecksumMD5, ChecksumSHA256}; !slices.Equal(algs, expect) {
+		t.Fatalf("expected algorithms %v, got %v", expect, algs)
+	}
+	// checksums used only for verification are not stored
+	stored := storedChecksums(helloSums)
+	expect := map[string]string{ChecksumSHA256: helloSums[ChecksumSHA256], ChecksumAdler32: helloSums[ChecksumAdler32]}
+	if !maps.Equal(stored, expect) {
+		t.Fatalf("expected stored checksums %v, got %v", expect, stored)
+	}
+}
+
+// TestExpectedChecksums tests parsing of checksum HTTP headers
+func TestExpectedChecksums(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		expect  map[string]string
+		fail    bool
+	}{
+		{"no headers", nil, map[string]string{}, false},
+		{"content md5", map[string]string{"Content-MD5": "XrY7u+Ae7tCTyyK7j1rNww=="}, map[string]string{ChecksumMD5: helloSums[ChecksumMD5]}, false},
+		{"digest", map[string]string{"Digest": "sha-256=uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=, adler32=1A0B045D, crc32c=yZRlqg==, sha-512=abc"},
+			map[string]string{ChecksumSHA256: helloSums[ChecksumSHA256], ChecksumAdler32: helloSums[ChecksumAdler32], ChecksumCRC32C: helloSums[ChecksumCRC32C]}, false},
+		{"sha256 header", map[string]string{"X-Checksum-SHA256": strings.ToUpper(helloSums[ChecksumSHA256])}, map[string]string{ChecksumSHA256: helloSums[ChecksumSHA256]}, false},
+		{"invalid content md5", map[string]string{"Content-MD5": "not base64"}, nil, true},
+		{"invalid digest item", map[string]string{"Digest": "sha-256"}, nil, true},
+		{"invalid digest value", map[string]string{"Digest": "md5=not base64"}, nil, true},
+		{"invalid sha256 header", map[string]string{"X-Checksum-SHA256": "abc"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/storage/raw/data/file.txt", nil)
+			for key, val := range tt.headers {
+				r.Header.Set(key, val)
+			}
+			expect, err := expectedChecksums(r)
+			if tt.fail {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !maps.Equal(expect, tt.expect) {
+				t.Fatalf("expected checksums %v, got %v", tt.expect, expect)
+			}
+		})
+	}
+}
+
+// TestDigestHeader tests that Digest header represents checksums which are
+// parsed back
+func TestDigestHeader(t *testing.T) {
+	header := digestHeader(helloSums)
+	r := httptest.NewRequest("GET", "/storage/raw/data/file.txt", nil)
+	r.Header.Set("Digest", header)
+	sums, err := expectedChecksums(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(sums, helloSums) {
+		t.Fatalf("expected checksums %v from header %s, got %v", helloSums, header, sums)
+	}
+}
+
+// TestUploadVerifiesChecksums tests that uploaded file is verified against
+// expected checksums and it is not stored if verification fails
+func TestUploadVerifiesChecksums(t *testing.T) {
+	client := NewLocalFsClient(t.TempDir())
+	content := "hello world"
+	expect := map[string]string{ChecksumMD5: strings.Repeat("0", 32)}
+	_, err := client.Upload("data", "file.txt", "text/plain", strings.NewReader(content), int64(len(content)), expect)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	if _, err := client.Stat("data", "file.txt"); err == nil {
+		t.Fatal("expected no stored file")
+	}
+	expect = map[string]string{ChecksumMD5: helloSums[ChecksumMD5]}
+	meta, err := client.Upload("data", "file.txt", "text/plain", strings.NewReader(content), int64(len(content)), expect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// verification only checksums are not kept
+	if meta.Checksums[ChecksumSHA256] != helloSums[ChecksumSHA256] || meta.Checksums[ChecksumMD5] != "" {
+		t.Fatalf("expected stored sha256 checksum only, got %v", meta.Checksums)
+	}
+}
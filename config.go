@@ -0,0 +1,272 @@
+package main
+
+// config module provides DataManagement specific configuration
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// UploadsConfig represents configuration of resumable (chunked) uploads
+type UploadsConfig struct {
+	StagingArea  string `mapstructure:"StagingArea"`  // directory to keep upload sessions and their chunks
+	Expire       int    `mapstructure:"Expire"`       // expiration time of abandoned upload sessions in seconds
+	MaxChunkSize int64  `mapstructure:"MaxChunkSize"` // maximum size of upload chunk in bytes
+}
+
+// ArchivesConfig represents configuration of archive downloads
+type ArchivesConfig struct {
+	MaxSize  int64 `mapstructure:"MaxSize"`  // maximum total size of archived files in bytes
+	MaxFiles int   `mapstructure:"MaxFiles"` // maximum number of archived files
+}
+
+// MetaDataConfig represents configuration of meta-data records lookup
+type MetaDataConfig struct {
+	File      string `mapstructure:"File"`      // JSON file with meta-data records used instead of MetaData service
+	CacheTTL  int    `mapstructure:"CacheTTL"`  // time to keep cached meta-data records in seconds, negative value disables the cache
+	CacheSize int    `mapstructure:"CacheSize"` // maximum number of DIDs in the cache
+	Timeout   int    `mapstructure:"Timeout"`   // timeout of MetaData service requests in seconds
+}
+
+// WalkConfig represents limits of file-system traversals, e.g. recursive
+// listings and searches
+type WalkConfig struct {
+	Timeout    int `mapstructure:"Timeout"`    // maximum time of traversal in seconds
+	MaxEntries int `mapstructure:"MaxEntries"` // maximum number of visited entries
+}
+
+// CatalogConfig represents configuration of file catalog of DID data locations
+type CatalogConfig struct {
+	Path    string `mapstructure:"Path"`    // file of catalog database
+	Refresh int    `mapstructure:"Refresh"` // interval between refreshes of data location index in seconds
+}
+
+// WatcherConfig represents configuration of file-system watcher
+type WatcherConfig struct {
+	Enabled    bool `mapstructure:"Enabled"`    // enable file-system change notifications
+	MaxWatches int  `mapstructure:"MaxWatches"` // maximum number of watched directories
+}
+
+// PresignConfig represents configuration of presigned URLs, the S3 URLs are
+// presigned by S3 backend while URLs of other storage backends are served by
+// DataManagement service and signed with HMAC secret
+type PresignConfig struct {
+	Secret     string `mapstructure:"Secret"`     // HMAC secret, random secret is used if it is not provided
+	URL        string `mapstructure:"URL"`        // public URL of DataManagement service used in signed URLs
+	Expires    int    `mapstructure:"Expires"`    // default expiration of URLs in seconds
+	MaxExpires int    `mapstructure:"MaxExpires"` // maximum expiration of URLs in seconds
+}
+
+// LifecyclePolicy represents lifecycle rule of directory (S3 bucket) of
+// storage area which is applied at start-up of the service
+type LifecyclePolicy struct {
+	Area          string `mapstructure:"Area"` // name of storage area
+	Dir           string `mapstructure:"Dir"`  // directory or S3 bucket
+	LifecycleRule `mapstructure:",squash"`
+}
+
+// RetentionPolicy represents retention of files (S3 objects) within
+// directory (S3 bucket) of storage area, e.g. published DOI datasets, the
+// files are retained for given number of days since their last modification
+type RetentionPolicy struct {
+	Area   string `mapstructure:"Area"`   // name of storage area
+	Dir    string `mapstructure:"Dir"`    // directory or S3 bucket, empty value matches all directories
+	Prefix string `mapstructure:"Prefix"` // prefix of files the policy applies to
+	Mode   string `mapstructure:"Mode"`   // retention mode, governance or compliance
+	Days   int    `mapstructure:"Days"`   // retention period in days
+}
+
+// LifecycleConfig represents configuration of lifecycle rules and retention
+// policies of storage areas
+type LifecycleConfig struct {
+	Interval     int               `mapstructure:"Interval"`     // interval between lifecycle runs in seconds
+	Rules        []LifecyclePolicy `mapstructure:"Rules"`        // lifecycle rules of storage areas
+	Retention    []RetentionPolicy `mapstructure:"Retention"`    // retention policies of storage areas
+	ReleaseScope string            `mapstructure:"ReleaseScope"` // token scope required to release retention of files
+}
+
+// TrashConfig represents configuration of trash areas of deleted files
+type TrashConfig struct {
+	Retention int `mapstructure:"Retention"` // time to keep deleted files in seconds, negative value disables the trash
+}
+
+// AuditConfig represents configuration of audit log of storage mutations
+type AuditConfig struct {
+	Sink     string `mapstructure:"Sink"`     // kind of audit sink, e.g. file or log, none disables audit log
+	File     string `mapstructure:"File"`     // file of JSON-lines audit log
+	MaxSize  int64  `mapstructure:"MaxSize"`  // maximum size of audit log file in bytes before its rotation
+	MaxFiles int    `mapstructure:"MaxFiles"` // maximum number of rotated audit log files
+	Scope    string `mapstructure:"Scope"`    // token scope required to query audit log
+}
+
+// Configuration represents DataManagement configuration which extends
+// DataManagement section of FOXDEN configuration, e.g.
+/*
+```
+DataManagement:
+  StorageAreas:
+    - Name: raw
+      Kind: local
+      Storage: /data/raw
+    - Name: derived
+      Kind: minio
+      Endpoint: localhost:8330
+      AccessKey: <access_key>
+      AccessSecret: <access_secret>
+      TrashBucket: trash
+  Uploads:
+    StagingArea: /data/uploads
+    Expire: 86400
+    MaxChunkSize: 1073741824
+  MetaData:
+    CacheTTL: 300
+    CacheSize: 1000
+    Timeout: 30
+  Walk:
+    Timeout: 30
+    MaxEntries: 1000000
+  Catalog:
+    Path: /data/catalog.db
+    Refresh: 60
+  Watcher:
+    Enabled: true
+    MaxWatches: 8192
+  Presign:
+    Secret: <hmac_secret>
+    URL: https://foxden.example.com/datamanagement
+    Expires: 3600
+    MaxExpires: 604800
+  Lifecycle:
+    Interval: 3600
+    Rules:
+      - Area: raw
+        Dir: scratch
+        ID: expire-scratch
+        ExpireDays: 30
+        AbortUploadsDays: 7
+      - Area: raw
+        Dir: dir
+        ID: archive-scans
+        Prefix: scans/
+        TransitionDays: 90
+        TransitionTarget: tape
+    Retention:
+      - Area: doi
+        Mode: compliance
+        Days: 3650
+    ReleaseScope: admin
+  Trash:
+    Retention: 604800
+  Audit:
+    Sink: file
+    File: /data/audit/audit.log
+    MaxSize: 104857600
+    MaxFiles: 10
+    Scope: admin
+  Archives:
+    MaxSize: 107374182400
+    MaxFiles: 100000
+  Checksums: [adler32, crc32c]
+```
+*/
+type Configuration struct {
+	StorageAreas []BackendConfig `mapstructure:"StorageAreas"` // named storage areas
+	Uploads      UploadsConfig   `mapstructure:"Uploads"`
+	Archives     ArchivesConfig  `mapstructure:"Archives"`
+	MetaData     MetaDataConfig  `mapstructure:"MetaData"`
+	Walk         WalkConfig      `mapstructure:"Walk"`
+	Catalog      CatalogConfig   `mapstructure:"Catalog"`
+	Watcher      WatcherConfig   `mapstructure:"Watcher"`
+	Presign      PresignConfig   `mapstructure:"Presign"`
+	Lifecycle    LifecycleConfig `mapstructure:"Lifecycle"`
+	Trash        TrashConfig     `mapstructure:"Trash"`
+	Audit        AuditConfig     `mapstructure:"Audit"`
+	Checksums    []string        `mapstructure:"Checksums"` // additional checksums to compute, e.g. adler32, crc32c
+}
+
+// dmConfig represents our DataManagement configuration
+var dmConfig Configuration
+
+// parseConfig reads DataManagement section of FOXDEN configuration file
+// which should be already loaded by srvConfig.ParseConfig
+func parseConfig() error {
+	if err := viper.UnmarshalKey("DataManagement", &dmConfig); err != nil {
+		return fmt.Errorf("[DataManagement.main.parseConfig] viper.UnmarshalKey error: %w", err)
+	}
+	// set defaults
+	if dmConfig.Uploads.StagingArea == "" {
+		dmConfig.Uploads.StagingArea = filepath.Join(os.TempDir(), "DataManagement", "uploads")
+	}
+	if dmConfig.Uploads.Expire == 0 {
+		dmConfig.Uploads.Expire = 86400 // abandoned upload sessions expire in 1 day
+	}
+	if dmConfig.Uploads.MaxChunkSize == 0 {
+		dmConfig.Uploads.MaxChunkSize = 1024 * 1024 * 1024 // 1GB
+	}
+	if dmConfig.Archives.MaxSize == 0 {
+		dmConfig.Archives.MaxSize = 100 * 1024 * 1024 * 1024 // 100GB
+	}
+	if dmConfig.Archives.MaxFiles == 0 {
+		dmConfig.Archives.MaxFiles = 100000
+	}
+	if dmConfig.MetaData.CacheTTL == 0 {
+		dmConfig.MetaData.CacheTTL = 300 // 5 minutes
+	}
+	if dmConfig.MetaData.CacheSize == 0 {
+		dmConfig.MetaData.CacheSize = 1000
+	}
+	if dmConfig.MetaData.Timeout == 0 {
+		dmConfig.MetaData.Timeout = 30
+	}
+	if dmConfig.Walk.Timeout == 0 {
+		dmConfig.Walk.Timeout = 30
+	}
+	if dmConfig.Walk.MaxEntries == 0 {
+		dmConfig.Walk.MaxEntries = 1000000
+	}
+	if dmConfig.Catalog.Path == "" {
+		dmConfig.Catalog.Path = filepath.Join(os.TempDir(), "DataManagement", "catalog.db")
+	}
+	if dmConfig.Catalog.Refresh == 0 {
+		dmConfig.Catalog.Refresh = 60
+	}
+	if dmConfig.Watcher.MaxWatches == 0 {
+		dmConfig.Watcher.MaxWatches = 8192
+	}
+	if dmConfig.Presign.Expires == 0 {
+		dmConfig.Presign.Expires = 3600 // 1 hour
+	}
+	if dmConfig.Presign.MaxExpires == 0 {
+		dmConfig.Presign.MaxExpires = 7 * 86400 // 7 days, the limit of S3 presigned URLs
+	}
+	if dmConfig.Trash.Retention == 0 {
+		dmConfig.Trash.Retention = 7 * 86400 // 7 days
+	}
+	if dmConfig.Audit.Sink == "" {
+		dmConfig.Audit.Sink = "file"
+	}
+	if dmConfig.Audit.File == "" {
+		dmConfig.Audit.File = filepath.Join(os.TempDir(), "DataManagement", "audit.log")
+	}
+	if dmConfig.Audit.MaxSize == 0 {
+		dmConfig.Audit.MaxSize = 100 * 1024 * 1024 // 100MB
+	}
+	if dmConfig.Audit.MaxFiles == 0 {
+		dmConfig.Audit.MaxFiles = 10
+	}
+	if dmConfig.Audit.Scope == "" {
+		dmConfig.Audit.Scope = "admin"
+	}
+	if dmConfig.Lifecycle.Interval == 0 {
+		dmConfig.Lifecycle.Interval = 3600 // 1 hour
+	}
+	if dmConfig.Lifecycle.ReleaseScope == "" {
+		dmConfig.Lifecycle.ReleaseScope = "admin"
+	}
+	return nil
+}
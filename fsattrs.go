@@ -0,0 +1,93 @@
+package main
+
+// fsattrs module provides persistent attributes of files stored by LocalFsClient
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// metaArea defines hidden area within storage root which is used by
+// DataManagement service to keep its own data, e.g. file attributes
+const metaArea = ".datamanagement"
+
+// FileAttributes represents attributes of stored file which are kept in
+// sidecar file within metadata area of the storage
+type FileAttributes struct {
+	Size        int64             `json:"size"`
+	ModTime     time.Time         `json:"mod_time"`
+	Checksums   map[string]string `json:"checksums,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+}
+
+// resolve resolves given path elements within storage root, it rejects paths
+// which escape storage root or point to storage metadata area
+func (l *LocalFsClient) resolve(elems ...string) (string, error) {
+	path, err := resolvePath(l.Storage, elems...)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(filepath.Clean(l.Storage), path)
+	if err == nil && (rel == metaArea || strings.HasPrefix(rel, metaArea+string(filepath.Separator))) {
+		return "", &ForbiddenPathError{Path: rel, Reason: "reserved area"}
+	}
+	return path, nil
+}
+
+// helper function to return location of sidecar file for given path
+func (l *LocalFsClient) attrsPath(path string) string {
+	root := filepath.Clean(l.Storage)
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	return filepath.Join(root, metaArea, "attrs", rel+".json")
+}
+
+// helper function to return location of attributes of given file or of all
+// files of given directory
+func (l *LocalFsClient) attrsLocation(path string, isDir bool) string {
+	fname := l.attrsPath(path)
+	if isDir {
+		return strings.TrimSuffix(fname, ".json")
+	}
+	return fname
+}
+
+// readAttrs reads attributes of given file, it returns false if attributes
+// are not available or they are stale, i.e. file was modified outside of
+// DataManagement service
+func (l *LocalFsClient) readAttrs(path string, info os.FileInfo) (FileAttributes, bool) {
+	var attrs FileAttributes
+	data, err := os.ReadFile(l.attrsPath(path))
+	if err != nil {
+		return attrs, false
+	}
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return attrs, false
+	}
+	if attrs.Size != info.Size() || !attrs.ModTime.Equal(info.ModTime()) {
+		return attrs, false
+	}
+	return attrs, true
+}
+
+// writeAttrs persists attributes of given file
+func (l *LocalFsClient) writeAttrs(path string, attrs FileAttributes) error {
+	if err := l.writeJSON(l.attrsPath(path), attrs); err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.writeAttrs] writeJSON error: %w", err)
+	}
+	return nil
+}
+
+// removeAttrs removes attributes of given file or of all files within
+// given directory
+func (l *LocalFsClient) removeAttrs(path string, isDir bool) {
+	os.RemoveAll(l.attrsLocation(path, isDir))
+}
@@ -1,54 +1,82 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 )
 
 // Metadata represents file metadata information
 type Metadata struct {
-	Name        string    `json:"name"`
-	Size        int64     `json:"size"`
-	ModTime     time.Time `json:"mod_time"`
-	IsDirectory bool      `json:"is_directory"`
+	Name        string            `json:"name"`
+	Size        int64             `json:"size"`
+	ModTime     time.Time         `json:"mod_time"`
+	IsDirectory bool              `json:"is_directory"`
+	ContentType string            `json:"content_type,omitempty"`
+	ETag        string            `json:"etag,omitempty"`
+	Checksums   map[string]string `json:"checksums,omitempty"`
 }
 
 // FsClient represents generic interface to communicate with FileSystem instances
 type FsClient interface {
+	StorageBackend
 	Get(dir, file string) ([]byte, error)
-	List(dir string) ([]Metadata, error)
-	Create(dir string) error
-	Upload(dir, file, ctype string, reader io.Reader, size int64) error
-	Delete(dir, file string) error
+	Assemble(dir, file, ctype string, chunks []string, expect map[string]string) (Metadata, error)
 }
 
 // LocalFsClient provides local file system implementation of FsClient
 type LocalFsClient struct {
-	Storage string
-	Logger  *log.Logger
+	Storage  string
+	ReadOnly bool        // reject all write operations
+	Umask    os.FileMode // umask of new files and directories
+	UID      int         // owner of new files and directories, -1 to keep default one
+	GID      int         // group of new files and directories, -1 to keep default one
+	Logger   *log.Logger
 }
 
 // NewLocalFsClient creates a new LocalFsClient with logging enabled
 func NewLocalFsClient(storage string) *LocalFsClient {
 	return &LocalFsClient{
 		Storage: storage,
+		Umask:   defaultUmask,
+		UID:     -1,
+		GID:     -1,
 		Logger:  log.New(os.Stdout, "FsClient: ", log.LstdFlags),
 	}
 }
 
+// Type implements StorageBackend interface
+func (l *LocalFsClient) Type() string {
+	return "fs"
+}
+
+// Capabilities implements StorageBackend interface
+func (l *LocalFsClient) Capabilities() []string {
+	if l.ReadOnly {
+		return []string{"list", "read", "range", "stat", "checksums", "versions", "lifecycle", "retention"}
+	}
+	return []string{"list", "read", "range", "write", "delete", "stat", "copy", "move", "checksums", "versions", "uploads", "lifecycle", "retention", "trash"}
+}
+
 // Get retrieves a file's content or lists directory contents if file is empty
 func (l *LocalFsClient) Get(dir, file string) ([]byte, error) {
-	path := filepath.Join(l.Storage, dir)
+	path, err := l.resolve(dir, file)
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.LocalFsClient.Get] resolve error: %w", err)
+	}
 
 	// If file is empty, return directory metadata
 	if file == "" {
-		files, err := l.List(dir)
+		files, err := l.List(dir, 1)
 		if err != nil {
 			l.Logger.Printf("Error listing directory %s: %v", dir, err)
 			return nil, fmt.Errorf("[DataManagement.main.LocalFsClient.Get] l.List error: %w", err)
@@ -58,7 +86,6 @@ func (l *LocalFsClient) Get(dir, file string) ([]byte, error) {
 	}
 
 	// Otherwise, read the file
-	path = filepath.Join(path, file)
 	data, err := os.ReadFile(path)
 	if err != nil {
 		l.Logger.Printf("Error reading file %s: %v", path, err)
@@ -68,91 +95,444 @@ func (l *LocalFsClient) Get(dir, file string) ([]byte, error) {
 	return data, nil
 }
 
-// List retrieves metadata for all files in a given directory
-func (l *LocalFsClient) List(dir string) ([]Metadata, error) {
-	path := filepath.Join(l.Storage, dir)
-	files, err := ioutil.ReadDir(path)
+// Open provides streaming access to a file content along with its metadata,
+// the caller is responsible to close returned reader
+func (l *LocalFsClient) Open(dir, file string) (io.ReadSeekCloser, Metadata, error) {
+	var meta Metadata
+	path, err := l.resolve(dir, file)
 	if err != nil {
-		l.Logger.Printf("Failed to list directory %s: %v", path, err)
-		return nil, fmt.Errorf("[DataManagement.main.LocalFsClient.List] os.ReadDir error: %w", err)
+		return nil, meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Open] resolve error: %w", err)
 	}
+	fobj, err := os.Open(path)
+	if err != nil {
+		l.Logger.Printf("Error opening file %s: %v", path, err)
+		return nil, meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Open] os.Open error: %w", err)
+	}
+	info, err := fobj.Stat()
+	if err != nil {
+		fobj.Close()
+		l.Logger.Printf("Error reading file info %s: %v", path, err)
+		return nil, meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Open] fobj.Stat error: %w", err)
+	}
+	if info.IsDir() {
+		fobj.Close()
+		return nil, meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Open] %s is a directory", path)
+	}
+	meta = l.fileMetadata(path, info)
+	return fobj, meta, nil
+}
 
+// helper function to provide metadata of given file along with its
+// persistent attributes
+func (l *LocalFsClient) fileMetadata(path string, info os.FileInfo) Metadata {
+	meta := Metadata{
+		Name:        info.Name(),
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		IsDirectory: info.IsDir(),
+	}
+	if info.IsDir() {
+		return meta
+	}
+	meta.ETag = fileETag(info.ModTime(), info.Size())
+	meta.ContentType = contentTypeByExtension(info.Name())
+	if attrs, ok := l.readAttrs(path, info); ok {
+		meta.Checksums = attrs.Checksums
+		if attrs.ContentType != "" {
+			meta.ContentType = attrs.ContentType
+		}
+	}
+	return meta
+}
+
+// Stat retrieves metadata of a file or a directory
+func (l *LocalFsClient) Stat(dir, file string) (Metadata, error) {
+	var meta Metadata
+	path, err := l.resolve(dir, file)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Stat] resolve error: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Stat] os.Stat error: %w", err)
+	}
+	return l.fileMetadata(path, info), nil
+}
+
+// List retrieves metadata for all files in a given directory, the depth
+// defines how many levels of sub-directories to list (1 lists only direct
+// entries of the directory, negative depth means unlimited depth) and names
+// of nested entries are relative to given directory
+func (l *LocalFsClient) List(dir string, depth int) ([]Metadata, error) {
+	metadataList, _, err := l.ListContext(context.Background(), dir, depth)
+	return metadataList, err
+}
+
+// ListContext implements ContextLister interface, it lists given directory
+// until context is cancelled or walk limits are reached and reports whether
+// the listing is truncated
+func (l *LocalFsClient) ListContext(ctx context.Context, dir string, depth int) ([]Metadata, bool, error) {
+	path, err := l.resolve(dir)
+	if err != nil {
+		return nil, false, fmt.Errorf("[DataManagement.main.LocalFsClient.List] resolve error: %w", err)
+	}
+	root := filepath.Clean(l.Storage)
 	var metadataList []Metadata
-	for _, file := range files {
-		metadataList = append(metadataList, Metadata{
-			Name:        file.Name(),
-			Size:        file.Size(),
-			ModTime:     file.ModTime(),
-			IsDirectory: file.IsDir(),
-		})
+	truncated, err := walkDir(ctx, path, depth, func(fname, rel string, entry fs.DirEntry) error {
+		if filepath.Dir(fname) == root && entry.Name() == metaArea {
+			return filepath.SkipDir
+		}
+		file, err := entry.Info()
+		if err != nil {
+			// entry was removed while we were listing the directory
+			return nil
+		}
+		meta := l.fileMetadata(fname, file)
+		meta.Name = filepath.ToSlash(rel)
+		metadataList = append(metadataList, meta)
+		return nil
+	})
+	if err != nil {
+		l.Logger.Printf("Failed to list directory %s: %v", path, err)
+		return nil, false, fmt.Errorf("[DataManagement.main.LocalFsClient.List] walkDir error: %w", err)
 	}
 	l.Logger.Printf("Listed directory %s", path)
-	return metadataList, nil
+	return metadataList, truncated, nil
+}
+
+// ListAfter implements PageLister interface, it lists entries of given
+// directory which follow given name in ascending order of their names until
+// fn returns false, context is cancelled or walk limits are reached
+func (l *LocalFsClient) ListAfter(ctx context.Context, dir string, depth int, after string, fn func(Metadata) bool) (bool, error) {
+	path, err := l.resolve(dir)
+	if err != nil {
+		return false, fmt.Errorf("[DataManagement.main.LocalFsClient.List] resolve error: %w", err)
+	}
+	reserved := filepath.Join(filepath.Clean(l.Storage), metaArea)
+	truncated, err := walkAfter(ctx, path, depth, after, func(fname, rel string, entry fs.DirEntry) error {
+		if fname == reserved || strings.HasPrefix(fname, reserved+string(filepath.Separator)) {
+			return filepath.SkipDir
+		}
+		file, err := entry.Info()
+		if err != nil {
+			// entry was removed while we were listing the directory
+			return nil
+		}
+		meta := l.fileMetadata(fname, file)
+		meta.Name = filepath.ToSlash(rel)
+		if !fn(meta) {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		l.Logger.Printf("Failed to list directory %s: %v", path, err)
+		return false, fmt.Errorf("[DataManagement.main.LocalFsClient.List] walkAfter error: %w", err)
+	}
+	l.Logger.Printf("Listed directory %s", path)
+	return truncated, nil
 }
 
 // Create creates a new directory
 func (l *LocalFsClient) Create(dir string) error {
-	path := filepath.Join(l.Storage, dir)
-	err := os.MkdirAll(path, os.ModePerm)
+	path, err := l.resolve(dir)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.Create] resolve error: %w", err)
+	}
+	if err := l.writable(); err != nil {
+		return err
+	}
+	err = l.mkdirAll(path)
 	if err != nil {
 		l.Logger.Printf("Failed to create directory %s: %v", path, err)
-		return fmt.Errorf("[DataManagement.main.LocalFsClient.Create] os.MkdirAll error: %w", err)
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.Create] mkdirAll error: %w", err)
 	}
 	l.Logger.Printf("Created directory %s", path)
 	return nil
 }
 
-// Upload writes data to a file in chunks to handle large files efficiently
-func (l *LocalFsClient) Upload(dir, file, ctype string, reader io.Reader, size int64) error {
-	path := filepath.Join(l.Storage, dir, file)
+// Upload writes data to a file in chunks to handle large files efficiently.
+// The data is written into temporary file which is renamed upon successful
+// verification of its size and expected checksums.
+func (l *LocalFsClient) Upload(dir, file, ctype string, reader io.Reader, size int64, expect map[string]string) (Metadata, error) {
+	var meta Metadata
+	path, err := l.resolve(dir, file)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Upload] resolve error: %w", err)
+	}
+	meta, err = l.writeFile(path, ctype, reader, size, expect)
+	if err != nil {
+		l.Logger.Printf("Failed to upload file %s: %v", path, err)
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Upload] writeFile error: %w", err)
+	}
+	l.Logger.Printf("Uploaded file %s successfully", path)
+	return meta, nil
+}
+
+// Assemble concatenates given chunk files into a file, the file is written
+// into temporary location first and atomically renamed upon completion
+func (l *LocalFsClient) Assemble(dir, file, ctype string, chunks []string, expect map[string]string) (Metadata, error) {
+	var meta Metadata
+	path, err := l.resolve(dir, file)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Assemble] resolve error: %w", err)
+	}
+	reader := &chunksReader{chunks: chunks}
+	defer reader.Close()
+	meta, err = l.writeFile(path, ctype, reader, 0, expect)
+	if err != nil {
+		l.Logger.Printf("Failed to assemble file %s: %v", path, err)
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Assemble] writeFile error: %w", err)
+	}
+	l.Logger.Printf("Assembled file %s from %d chunks", path, len(chunks))
+	return meta, nil
+}
+
+// helper function to write content of given reader to a file. The content
+// is written into temporary file which is atomically renamed to the final
+// path once its size and checksums are verified. The computed checksums
+// and content type of the file are persisted along with the file.
+func (l *LocalFsClient) writeFile(path, ctype string, reader io.Reader, size int64, expect map[string]string) (Metadata, error) {
+	var meta Metadata
+	if err := l.writable(); err != nil {
+		return meta, err
+	}
 
 	// Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
-		l.Logger.Printf("Failed to create directory for file %s: %v", path, err)
-		return fmt.Errorf("[DataManagement.main.LocalFsClient.Upload] os.MkdirAll error: %w", err)
+	if err := l.mkdirAll(filepath.Dir(path)); err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.writeFile] mkdirAll error: %w", err)
 	}
 
-	// Open the file for writing
-	outFile, err := os.Create(path)
+	// Open temporary file for writing
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".upload-*")
 	if err != nil {
-		l.Logger.Printf("Failed to create file %s: %v", path, err)
-		return fmt.Errorf("[DataManagement.main.LocalFsClient.Upload] os.Create error: %w", err)
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.writeFile] os.CreateTemp error: %w", err)
 	}
-	defer outFile.Close()
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
 
-	// Copy data from reader to file using buffer
-	buffer := make([]byte, 4096) // 4KB buffer
-	_, err = io.CopyBuffer(outFile, reader, buffer)
+	// Copy data from reader to file using buffer, compute its checksums and
+	// keep leading bytes to detect its content type
+	summer := NewChecksummer(checksumAlgorithms(expect)...)
+	head := &headWriter{}
+	buffer := make([]byte, 1024*1024) // 1MB buffer
+	written, err := io.CopyBuffer(io.MultiWriter(tmp, summer, head), reader, buffer)
 	if err != nil {
-		l.Logger.Printf("Failed to upload file %s: %v", path, err)
-		return fmt.Errorf("[DataManagement.main.LocalFsClient.Create] os.CopyBuffer error: %w", err)
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.writeFile] io.CopyBuffer error: %w", err)
+	}
+	if size > 0 && written != size {
+		return meta, fmt.Errorf("incomplete file, received %d bytes, expect %d", written, size)
+	}
+	if err := summer.Verify(expect); err != nil {
+		return meta, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.writeFile] tmp.Sync error: %w", err)
+	}
+	if err := tmp.Chmod(l.fileMode()); err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.writeFile] tmp.Chmod error: %w", err)
+	}
+	if err := l.setOwner(tmp.Name()); err != nil {
+		return meta, err
+	}
+	// retained file can not be replaced
+	if err := l.retained(path, false); err != nil {
+		return meta, err
+	}
+	if err := l.preserve(path); err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.writeFile] preserve error: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.writeFile] os.Rename error: %w", err)
+	}
+	l.removeRetention(path, false)
+
+	// persist file attributes
+	info, err := os.Stat(path)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.writeFile] os.Stat error: %w", err)
+	}
+	attrs := FileAttributes{
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		Checksums:   storedChecksums(summer.Sums()),
+		ContentType: detectContentType(ctype, path, head.head),
+	}
+	if err := l.writeAttrs(path, attrs); err != nil {
+		l.Logger.Printf("Failed to write attributes of file %s: %v", path, err)
+	}
+	meta = Metadata{
+		Name:        info.Name(),
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		ContentType: attrs.ContentType,
+		ETag:        fileETag(info.ModTime(), info.Size()),
+		Checksums:   attrs.Checksums,
+	}
+	return meta, nil
+}
+
+// Copy copies a file to a new location, the content of the copy is verified
+// against known checksums of the source file
+func (l *LocalFsClient) Copy(srcDir, srcFile, dstDir, dstFile string) (Metadata, error) {
+	var meta Metadata
+	path, err := l.resolve(dstDir, dstFile)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Copy] resolve error: %w", err)
+	}
+	reader, src, err := l.Open(srcDir, srcFile)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Copy] Open error: %w", err)
+	}
+	defer reader.Close()
+	meta, err = l.writeFile(path, src.ContentType, reader, src.Size, src.Checksums)
+	if err != nil {
+		l.Logger.Printf("Failed to copy file %s/%s to %s: %v", srcDir, srcFile, path, err)
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Copy] writeFile error: %w", err)
+	}
+	l.Logger.Printf("Copied file %s/%s to %s", srcDir, srcFile, path)
+	return meta, nil
+}
+
+// Move implements Mover interface, it renames a file along with its
+// attributes. If the file can not be renamed since source and destination
+// reside on different devices the file is copied and deleted.
+func (l *LocalFsClient) Move(srcDir, srcFile, dstDir, dstFile string) (Metadata, error) {
+	var meta Metadata
+	src, err := l.resolve(srcDir, srcFile)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Move] resolve error: %w", err)
+	}
+	dst, err := l.resolve(dstDir, dstFile)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Move] resolve error: %w", err)
+	}
+	if err := l.writable(); err != nil {
+		return meta, err
+	}
+	if err := l.mkdirAll(filepath.Dir(dst)); err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Move] mkdirAll error: %w", err)
+	}
+	// retained files can not be moved or replaced, and we keep revisions
+	// of replaced and moved files if versioning is enabled
+	for _, path := range []string{dst, src} {
+		if err := l.retained(path, false); err != nil {
+			return meta, err
+		}
+	}
+	for _, path := range []string{dst, src} {
+		if err := l.preserve(path); err != nil {
+			return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Move] preserve error: %w", err)
+		}
+	}
+	if err := os.Rename(src, dst); err != nil {
+		if !errors.Is(err, syscall.EXDEV) {
+			return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.Move] os.Rename error: %w", err)
+		}
+		if meta, err = l.Copy(srcDir, srcFile, dstDir, dstFile); err != nil {
+			return meta, err
+		}
+		return meta, l.Delete(srcDir, srcFile)
+	}
+	// rename keeps size and modification time of the file, therefore its
+	// attributes stay valid
+	l.removeAttrs(dst, false)
+	l.removeRetention(dst, false)
+	l.removeRetention(src, false)
+	attrs := l.attrsPath(dst)
+	if err := l.mkdirAll(filepath.Dir(attrs)); err == nil {
+		os.Rename(l.attrsPath(src), attrs)
+	}
+	l.Logger.Printf("Moved file %s to %s", src, dst)
+	return l.Stat(dstDir, dstFile)
+}
+
+// chunksReader reads content of given list of files sequentially, files are
+// opened one at a time
+type chunksReader struct {
+	chunks []string
+	file   *os.File
+}
+
+// Read implements io.Reader interface
+func (r *chunksReader) Read(p []byte) (int, error) {
+	for {
+		if r.file == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			fobj, err := os.Open(r.chunks[0])
+			if err != nil {
+				return 0, err
+			}
+			r.file = fobj
+			r.chunks = r.chunks[1:]
+		}
+		n, err := r.file.Read(p)
+		if err == io.EOF {
+			r.file.Close()
+			r.file = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close implements io.Closer interface
+func (r *chunksReader) Close() error {
+	if r.file != nil {
+		return r.file.Close()
 	}
-	l.Logger.Printf("Uploaded file %s successfully", path)
 	return nil
 }
 
 // Delete removes a file or an entire directory if file is empty
 func (l *LocalFsClient) Delete(dir, file string) error {
-	path := filepath.Join(l.Storage, dir)
+	path, err := l.resolve(dir, file)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.Delete] resolve error: %w", err)
+	}
+	if path == filepath.Clean(l.Storage) {
+		return &ForbiddenPathError{Path: dir, Reason: "storage root can not be deleted"}
+	}
+	if err := l.writable(); err != nil {
+		return err
+	}
 
-	// If file is empty, delete the entire directory
+	// If file is empty, delete the entire directory unless it contains
+	// retained files
 	if file == "" {
+		if err := l.retained(path, true); err != nil {
+			return err
+		}
 		err := os.RemoveAll(path)
 		if err != nil {
 			l.Logger.Printf("Failed to delete directory %s: %v", path, err)
 			return fmt.Errorf("[DataManagement.main.LocalFsClient.Delete] os.RemoveAll error: %w", err)
 		}
+		l.removeAttrs(path, true)
+		l.removeRetention(path, true)
 		l.Logger.Printf("Deleted directory %s", path)
 		return nil
 	}
 
-	// Otherwise, delete the specific file
-	path = filepath.Join(path, file)
-	err := os.Remove(path)
+	// Otherwise, delete the specific file keeping its revision if versioning is enabled
+	if err := l.retained(path, false); err != nil {
+		return err
+	}
+	if err := l.preserve(path); err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.Delete] preserve error: %w", err)
+	}
+	err = os.Remove(path)
 	if err != nil {
 		l.Logger.Printf("Failed to delete file %s: %v", path, err)
-		return fmt.Errorf("[DataManagement.main.LocalFsClient.Delete] os.MkdirAll error: %w", err)
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.Delete] os.Remove error: %w", err)
 	}
+	l.removeAttrs(path, false)
+	l.removeRetention(path, false)
 	l.Logger.Printf("Deleted file %s", path)
 	return nil
 }
@@ -170,7 +550,7 @@ func main() {
 
 	// Upload file
 	content := bytes.NewReader([]byte("Hello, World!"))
-	err = client.Upload("testdir", "hello.txt", "text/plain", content, int64(content.Len()))
+	_, err = client.Upload("testdir", "hello.txt", "text/plain", content, int64(content.Len()), nil)
 	if err != nil {
 		fmt.Println("Error uploading file:", err)
 	}
@@ -0,0 +1,213 @@
+package main
+
+// fsconfig module provides configuration and validation of LocalFsClient
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// ErrReadOnly represents error of write operation on read-only storage
+var ErrReadOnly = errors.New("storage area is read-only")
+
+// defaultUmask defines umask of new files and directories if it is not
+// provided by configuration
+const defaultUmask = 0022
+
+// NewLocalFsClientFromConfig creates LocalFsClient for given backend
+// configuration and validates that its storage root is usable, i.e. it
+// exists, it is a directory and it is writable unless storage is read-only
+func NewLocalFsClientFromConfig(config BackendConfig) (*LocalFsClient, error) {
+	if config.Storage == "" {
+		return nil, fmt.Errorf("storage root is not provided for '%s' backend", config.Kind)
+	}
+	root, err := filepath.Abs(config.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewLocalFsClientFromConfig] filepath.Abs error: %w", err)
+	}
+	client := NewLocalFsClient(root)
+	client.ReadOnly = config.ReadOnly
+	client.Umask = defaultUmask
+	if config.Umask != "" {
+		umask, err := strconv.ParseUint(config.Umask, 8, 32)
+		if err != nil || umask > 0777 {
+			return nil, fmt.Errorf("invalid umask '%s', it should be octal number, e.g. 022", config.Umask)
+		}
+		client.Umask = os.FileMode(umask)
+	}
+	if client.UID, err = lookupOwner(config.Owner); err != nil {
+		return nil, err
+	}
+	if client.GID, err = lookupGroup(config.Group); err != nil {
+		return nil, err
+	}
+	if err := client.validate(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// helper function to lookup user id of given owner, it returns -1 if owner
+// is not provided
+func lookupOwner(owner string) (int, error) {
+	if owner == "" {
+		return -1, nil
+	}
+	if uid, err := strconv.Atoi(owner); err == nil {
+		return uid, nil
+	}
+	usr, err := user.Lookup(owner)
+	if err != nil {
+		return -1, fmt.Errorf("[DataManagement.main.lookupOwner] user.Lookup error: %w", err)
+	}
+	return strconv.Atoi(usr.Uid)
+}
+
+// helper function to lookup group id of given group, it returns -1 if group
+// is not provided
+func lookupGroup(group string) (int, error) {
+	if group == "" {
+		return -1, nil
+	}
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	grp, err := user.LookupGroup(group)
+	if err != nil {
+		return -1, fmt.Errorf("[DataManagement.main.lookupGroup] user.LookupGroup error: %w", err)
+	}
+	return strconv.Atoi(grp.Gid)
+}
+
+// helper function to validate storage root of the client
+func (l *LocalFsClient) validate() error {
+	info, err := os.Stat(l.Storage)
+	if err != nil {
+		return fmt.Errorf("storage root %s is not accessible: %w", l.Storage, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("storage root %s is not a directory", l.Storage)
+	}
+	if l.ReadOnly {
+		return nil
+	}
+	// make sure we can create files with requested ownership in storage root
+	tmp, err := os.CreateTemp(l.Storage, ".datamanagement-check-*")
+	if err != nil {
+		return fmt.Errorf("storage root %s is not writable: %w", l.Storage, err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := l.setOwner(tmp.Name()); err != nil {
+		return fmt.Errorf("unable to set ownership of files in storage root %s: %w", l.Storage, err)
+	}
+	return nil
+}
+
+// helper function to check if client allows write operations
+func (l *LocalFsClient) writable() error {
+	if l.ReadOnly {
+		return fmt.Errorf("%w: %s", ErrReadOnly, l.Storage)
+	}
+	return nil
+}
+
+// helper function to return permissions of new files
+func (l *LocalFsClient) fileMode() os.FileMode {
+	return 0666 &^ l.Umask
+}
+
+// helper function to return permissions of new directories
+func (l *LocalFsClient) dirMode() os.FileMode {
+	return 0777 &^ l.Umask
+}
+
+// helper function to set configured owner and group of given path
+func (l *LocalFsClient) setOwner(path string) error {
+	if l.UID < 0 && l.GID < 0 {
+		return nil
+	}
+	if err := os.Lchown(path, l.UID, l.GID); err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.setOwner] os.Lchown error: %w", err)
+	}
+	return nil
+}
+
+// helper function to create directory along with all its missing parents,
+// new directories get configured permissions and ownership
+func (l *LocalFsClient) mkdirAll(path string) error {
+	var missing []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		dir := missing[i]
+		if err := os.Mkdir(dir, l.dirMode()); err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+			return fmt.Errorf("[DataManagement.main.LocalFsClient.mkdirAll] os.Mkdir error: %w", err)
+		}
+		// permissions of os.Mkdir are subject to process umask
+		if err := os.Chmod(dir, l.dirMode()); err != nil {
+			return fmt.Errorf("[DataManagement.main.LocalFsClient.mkdirAll] os.Chmod error: %w", err)
+		}
+		if err := l.setOwner(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper function to atomically write JSON representation of given value
+// into a file of metadata area, the file and its missing directories get
+// configured permissions and ownership
+func (l *LocalFsClient) writeJSON(fname string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := l.mkdirAll(filepath.Dir(fname)); err != nil {
+		return err
+	}
+	tmp := fname + ".tmp"
+	if err := os.WriteFile(tmp, data, l.fileMode()); err != nil {
+		return err
+	}
+	if err := l.setMode(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, fname); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// helper function to set configured permissions and ownership of new file
+func (l *LocalFsClient) setMode(fname string) error {
+	// permissions of os.WriteFile are subject to process umask
+	if err := os.Chmod(fname, l.fileMode()); err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.setMode] os.Chmod error: %w", err)
+	}
+	return l.setOwner(fname)
+}
+
+// String provides configuration of the client
+func (l *LocalFsClient) String() string {
+	return fmt.Sprintf("root=%s read-only=%v umask=%04o uid=%d gid=%d", l.Storage, l.ReadOnly, l.Umask, l.UID, l.GID)
+}
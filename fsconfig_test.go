@@ -0,0 +1,59 @@
+package main
+
+// fsconfig tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMetadataFilesMode tests that files and directories of metadata area
+// get permissions according to configured umask
+func TestMetadataFilesMode(t *testing.T) {
+	client := NewLocalFsClient(t.TempDir())
+	client.Umask = 0027
+	if err := client.Create("data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetVersioning("data", true); err != nil {
+		t.Fatal(err)
+	}
+	uploadContent(t, client, "data", "file.txt", "first")
+	uploadContent(t, client, "data", "file.txt", "second revision")
+	retention := Retention{Mode: RetentionGovernance, RetainUntil: time.Now().Add(time.Hour)}
+	if err := client.SetRetention("data", "file.txt", retention); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(client.Storage, "data", "file.txt")
+	vdir := client.versionsPath(path)
+	entries, err := os.ReadDir(vdir)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected prior version and its metadata, got %v (%v)", entries, err)
+	}
+	fnames := []string{client.attrsPath(path), client.retentionPath(path), client.versioningPath()}
+	for _, entry := range entries {
+		fnames = append(fnames, filepath.Join(vdir, entry.Name()))
+	}
+	for _, fname := range fnames {
+		info, err := os.Stat(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0640 {
+			t.Fatalf("expected mode 0640 of %s, got %04o", fname, mode)
+		}
+	}
+	for _, dir := range []string{vdir, filepath.Dir(client.attrsPath(path)), filepath.Dir(client.retentionPath(path))} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0750 {
+			t.Fatalf("expected mode 0750 of %s, got %04o", dir, mode)
+		}
+	}
+}
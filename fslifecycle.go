@@ -0,0 +1,221 @@
+package main
+
+// fslifecycle module provides lifecycle rules and retention of files stored
+// by LocalFsClient. The lifecycle rules are kept per top-level directory
+// similar to S3 buckets and applied by DataManagement service, while
+// retention of files is kept in sidecar files within metadata area and
+// enforced by LocalFsClient itself.
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lifecycleMutex serializes updates of lifecycle rules of storages
+var lifecycleMutex sync.Mutex
+
+// helper function to return location of lifecycle rules of the storage
+func (l *LocalFsClient) lifecyclePath() string {
+	return filepath.Join(filepath.Clean(l.Storage), metaArea, "lifecycle.json")
+}
+
+// helper function to read lifecycle rules of top-level directories
+func (l *LocalFsClient) lifecycleRules() (map[string][]LifecycleRule, error) {
+	rules := make(map[string][]LifecycleRule)
+	data, err := os.ReadFile(l.lifecyclePath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return rules, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// helper function to resolve top-level directory of lifecycle rules
+func (l *LocalFsClient) lifecycleDir(dir string) (string, error) {
+	path, err := l.resolve(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	top := l.topDir(path)
+	if !info.IsDir() || top == "" {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return top, nil
+}
+
+// Lifecycle implements LifecycleManager interface, it provides lifecycle
+// rules of top-level directory
+func (l *LocalFsClient) Lifecycle(dir string) ([]LifecycleRule, error) {
+	top, err := l.lifecycleDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.LocalFsClient.Lifecycle] lifecycleDir error: %w", err)
+	}
+	rules, err := l.lifecycleRules()
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.LocalFsClient.Lifecycle] lifecycleRules error: %w", err)
+	}
+	return rules[top], nil
+}
+
+// SetLifecycle implements LifecycleManager interface, it replaces lifecycle
+// rules of top-level directory, empty list of rules removes them
+func (l *LocalFsClient) SetLifecycle(dir string, rules []LifecycleRule) error {
+	if err := l.writable(); err != nil {
+		return err
+	}
+	if err := validateLifecycle(rules); err != nil {
+		return err
+	}
+	top, err := l.lifecycleDir(dir)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetLifecycle] lifecycleDir error: %w", err)
+	}
+	lifecycleMutex.Lock()
+	defer lifecycleMutex.Unlock()
+	state, err := l.lifecycleRules()
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetLifecycle] lifecycleRules error: %w", err)
+	}
+	if len(rules) == 0 {
+		delete(state, top)
+	} else {
+		state[top] = rules
+	}
+	if err := l.writeJSON(l.lifecyclePath(), state); err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetLifecycle] writeJSON error: %w", err)
+	}
+	l.Logger.Printf("Lifecycle of %s is set to %d rules", top, len(rules))
+	return nil
+}
+
+// helper function to return location of retention sidecar file of given path
+func (l *LocalFsClient) retentionPath(path string) string {
+	root := filepath.Clean(l.Storage)
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	return filepath.Join(root, metaArea, "retention", rel+".json")
+}
+
+// helper function to read retention of given file, the file without
+// retention has zero retention
+func (l *LocalFsClient) readRetention(path string) (Retention, error) {
+	var retention Retention
+	data, err := os.ReadFile(l.retentionPath(path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return retention, nil
+		}
+		return retention, err
+	}
+	err = json.Unmarshal(data, &retention)
+	return retention, err
+}
+
+// helper function to check that given file or any file within given
+// directory is not retained, i.e. it can be deleted or replaced
+func (l *LocalFsClient) retained(path string, isDir bool) error {
+	now := time.Now()
+	if !isDir {
+		retention, err := l.readRetention(path)
+		if err != nil {
+			return err
+		}
+		if retention.Active(now) {
+			return fmt.Errorf("%w: %s", ErrRetained, path)
+		}
+		return nil
+	}
+	root := strings.TrimSuffix(l.retentionPath(path), ".json")
+	err := filepath.WalkDir(root, func(fname string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(fname, ".json") {
+			return nil
+		}
+		var retention Retention
+		if data, err := os.ReadFile(fname); err == nil && json.Unmarshal(data, &retention) == nil && retention.Active(now) {
+			rel, _ := filepath.Rel(root, strings.TrimSuffix(fname, ".json"))
+			return fmt.Errorf("%w: %s", ErrRetained, filepath.Join(path, rel))
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// helper function to remove retention of given file or of all files within
+// given directory
+func (l *LocalFsClient) removeRetention(path string, isDir bool) {
+	fname := l.retentionPath(path)
+	if isDir {
+		os.RemoveAll(strings.TrimSuffix(fname, ".json"))
+		return
+	}
+	os.Remove(fname)
+}
+
+// Retention implements RetentionManager interface, it provides retention
+// and legal hold of a file
+func (l *LocalFsClient) Retention(dir, file string) (Retention, error) {
+	path, err := l.resolve(dir, file)
+	if err != nil {
+		return Retention{}, fmt.Errorf("[DataManagement.main.LocalFsClient.Retention] resolve error: %w", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return Retention{}, fmt.Errorf("[DataManagement.main.LocalFsClient.Retention] os.Stat error: %w", err)
+	}
+	retention, err := l.readRetention(path)
+	if err != nil {
+		return retention, fmt.Errorf("[DataManagement.main.LocalFsClient.Retention] readRetention error: %w", err)
+	}
+	return retention, nil
+}
+
+// SetRetention implements RetentionManager interface, it sets retention and
+// legal hold of a file, zero retention removes them
+func (l *LocalFsClient) SetRetention(dir, file string, retention Retention) error {
+	if err := l.writable(); err != nil {
+		return err
+	}
+	path, err := l.resolve(dir, file)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetRetention] resolve error: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetRetention] os.Stat error: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetRetention] %s/%s is a directory", dir, file)
+	}
+	if retention == (Retention{}) {
+		l.removeRetention(path, false)
+		return nil
+	}
+	if err := l.writeJSON(l.retentionPath(path), retention); err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetRetention] writeJSON error: %w", err)
+	}
+	l.Logger.Printf("Retention of %s is set to mode=%s until=%v legal-hold=%v",
+		path, retention.Mode, retention.RetainUntil.Format(time.RFC3339), retention.LegalHold)
+	return nil
+}
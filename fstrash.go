@@ -0,0 +1,175 @@
+package main
+
+// fstrash module provides trash area of LocalFsClient, deleted files and
+// directories are renamed into trash directory of metadata area along with
+// their attributes and they can be restored until they are purged
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// helper function to return location of trash entry
+func (l *LocalFsClient) trashPath(id string) string {
+	return filepath.Join(filepath.Clean(l.Storage), metaArea, "trash", id)
+}
+
+// helper function to read trash entry
+func (l *LocalFsClient) trashEntry(id string) (TrashEntry, error) {
+	var entry TrashEntry
+	if !trashIdPattern.MatchString(id) {
+		return entry, fmt.Errorf("invalid trash id '%s'", id)
+	}
+	data, err := os.ReadFile(filepath.Join(l.trashPath(id), "entry.json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return entry, fmt.Errorf("trash entry %s: %w", id, fs.ErrNotExist)
+		}
+		return entry, err
+	}
+	err = json.Unmarshal(data, &entry)
+	return entry, err
+}
+
+// Trash implements Trasher interface, it moves a file or an entire
+// directory if file is empty to trash area
+func (l *LocalFsClient) Trash(dir, file string) (TrashEntry, error) {
+	entry := TrashEntry{Dir: dir, File: file}
+	path, err := l.resolve(dir, file)
+	if err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.LocalFsClient.Trash] resolve error: %w", err)
+	}
+	if path == filepath.Clean(l.Storage) {
+		return entry, &ForbiddenPathError{Path: dir, Reason: "storage root can not be deleted"}
+	}
+	if err := l.writable(); err != nil {
+		return entry, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.LocalFsClient.Trash] os.Stat error: %w", err)
+	}
+	entry.IsDirectory = info.IsDir()
+	if err := l.retained(path, entry.IsDirectory); err != nil {
+		return entry, err
+	}
+	if entry.IsDirectory {
+		filepath.WalkDir(path, func(fname string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if finfo, err := d.Info(); err == nil {
+				entry.Size += finfo.Size()
+				entry.Files++
+			}
+			return nil
+		})
+	} else {
+		entry.Size = info.Size()
+		entry.Files = 1
+	}
+	if entry.ID, err = newTrashID(); err != nil {
+		return entry, err
+	}
+	entry.Deleted = time.Now()
+
+	// keep trash entry before we move its data to make sure that trash
+	// area does not have data without entries
+	tdir := l.trashPath(entry.ID)
+	if err := os.MkdirAll(tdir, 0700); err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.LocalFsClient.Trash] os.MkdirAll error: %w", err)
+	}
+	if err := l.writeJSON(filepath.Join(tdir, "entry.json"), entry); err != nil {
+		os.RemoveAll(tdir)
+		return entry, fmt.Errorf("[DataManagement.main.LocalFsClient.Trash] writeJSON error: %w", err)
+	}
+	if err := os.Rename(path, filepath.Join(tdir, "data")); err != nil {
+		os.RemoveAll(tdir)
+		return entry, fmt.Errorf("[DataManagement.main.LocalFsClient.Trash] os.Rename error: %w", err)
+	}
+	os.Rename(l.attrsLocation(path, entry.IsDirectory), filepath.Join(tdir, "attrs"))
+	l.removeRetention(path, entry.IsDirectory)
+	l.Logger.Printf("Moved %s to trash %s", path, entry.ID)
+	return entry, nil
+}
+
+// TrashList implements Trasher interface, it lists trash entries from the
+// latest to the oldest one
+func (l *LocalFsClient) TrashList() ([]TrashEntry, error) {
+	entries := []TrashEntry{}
+	dirs, err := os.ReadDir(filepath.Join(filepath.Clean(l.Storage), metaArea, "trash"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return entries, nil
+		}
+		return nil, fmt.Errorf("[DataManagement.main.LocalFsClient.TrashList] os.ReadDir error: %w", err)
+	}
+	for _, dir := range dirs {
+		entry, err := l.trashEntry(dir.Name())
+		if err != nil {
+			l.Logger.Printf("Failed to read trash entry %s: %v", dir.Name(), err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Deleted.After(entries[j].Deleted) })
+	return entries, nil
+}
+
+// Undelete implements Trasher interface, it restores trash entry at its
+// original location which should not exist
+func (l *LocalFsClient) Undelete(id string) (TrashEntry, error) {
+	if err := l.writable(); err != nil {
+		return TrashEntry{}, err
+	}
+	entry, err := l.trashEntry(id)
+	if err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.LocalFsClient.Undelete] trashEntry error: %w", err)
+	}
+	path, err := l.resolve(entry.Dir, entry.File)
+	if err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.LocalFsClient.Undelete] resolve error: %w", err)
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return entry, fmt.Errorf("%w: %s", ErrTransferConflict, filepath.Join(entry.Dir, entry.File))
+	}
+	if err := l.mkdirAll(filepath.Dir(path)); err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.LocalFsClient.Undelete] mkdirAll error: %w", err)
+	}
+	tdir := l.trashPath(id)
+	if err := os.Rename(filepath.Join(tdir, "data"), path); err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.LocalFsClient.Undelete] os.Rename error: %w", err)
+	}
+	attrs := l.attrsLocation(path, entry.IsDirectory)
+	if err := l.mkdirAll(filepath.Dir(attrs)); err == nil {
+		os.Rename(filepath.Join(tdir, "attrs"), attrs)
+	}
+	if err := os.RemoveAll(tdir); err != nil {
+		l.Logger.Printf("Failed to remove trash entry %s: %v", id, err)
+	}
+	l.Logger.Printf("Restored %s from trash %s", path, id)
+	return entry, nil
+}
+
+// Purge implements Trasher interface, it permanently removes trash entry
+func (l *LocalFsClient) Purge(id string) error {
+	if err := l.writable(); err != nil {
+		return err
+	}
+	if _, err := l.trashEntry(id); err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.Purge] trashEntry error: %w", err)
+	}
+	if err := os.RemoveAll(l.trashPath(id)); err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.Purge] os.RemoveAll error: %w", err)
+	}
+	l.Logger.Printf("Purged trash %s", id)
+	return nil
+}
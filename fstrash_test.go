@@ -0,0 +1,150 @@
+package main
+
+// fstrash tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestTrashUndelete tests that trashed files and directories are restored
+// along with their attributes
+func TestTrashUndelete(t *testing.T) {
+	client := NewLocalFsClient(t.TempDir())
+	meta := uploadContent(t, client, "data", "file.txt", "hello world")
+	uploadContent(t, client, "data", "sub/a.txt", "a")
+	uploadContent(t, client, "data", "sub/b.txt", "bb")
+
+	fentry, err := client.Trash("data", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fentry.IsDirectory || fentry.Files != 1 || fentry.Size != meta.Size {
+		t.Fatalf("unexpected trash entry of file %+v", fentry)
+	}
+	dentry, err := client.Trash("data/sub", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dentry.IsDirectory || dentry.Files != 2 || dentry.Size != 3 {
+		t.Fatalf("unexpected trash entry of directory %+v", dentry)
+	}
+	checkDirFiles(t, client, "data")
+	entries, err := client.TrashList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != dentry.ID || entries[1].ID != fentry.ID {
+		t.Fatalf("expected trash entries from the latest one, got %+v", entries)
+	}
+
+	for _, id := range []string{fentry.ID, dentry.ID} {
+		if _, err := client.Undelete(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data := readContent(t, client, "data", "sub/b.txt"); data != "bb" {
+		t.Fatalf("unexpected content of restored file %q", data)
+	}
+	restored, err := client.Stat("data", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Checksums[ChecksumSHA256] != meta.Checksums[ChecksumSHA256] {
+		t.Fatalf("expected restored checksums %v, got %v", meta.Checksums, restored.Checksums)
+	}
+	if entries, err := client.TrashList(); err != nil || len(entries) != 0 {
+		t.Fatalf("expected empty trash, got %+v (%v)", entries, err)
+	}
+}
+
+// TestUndeleteConflict tests that trash entry is not restored over existing file
+func TestUndeleteConflict(t *testing.T) {
+	client := NewLocalFsClient(t.TempDir())
+	uploadContent(t, client, "data", "file.txt", "old")
+	entry, err := client.Trash("data", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadContent(t, client, "data", "file.txt", "new")
+	if _, err := client.Undelete(entry.ID); !errors.Is(err, ErrTransferConflict) {
+		t.Fatalf("expected error %v, got %v", ErrTransferConflict, err)
+	}
+	if data := readContent(t, client, "data", "file.txt"); data != "new" {
+		t.Fatalf("expected kept content of existing file, got %q", data)
+	}
+	if _, err := client.Undelete("../../etc"); err == nil {
+		t.Fatal("expected error of invalid trash id")
+	}
+	if _, err := client.Trash("", ""); err == nil {
+		t.Fatal("expected error of trashed storage root")
+	}
+}
+
+// TestPurgeTrash tests that trash entries are purged after trash retention
+func TestPurgeTrash(t *testing.T) {
+	defer func(config TrashConfig) { dmConfig.Trash = config }(dmConfig.Trash)
+	dmConfig.Trash.Retention = 3600
+	client := NewLocalFsClient(t.TempDir())
+	area := &StorageArea{Name: "raw", Backend: client, Capabilities: client.Capabilities()}
+	uploadContent(t, client, "data", "file.txt", "content")
+	entry, err := client.Trash("data", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	purgeTrash(area, time.Now())
+	if entries, _ := client.TrashList(); len(entries) != 1 {
+		t.Fatalf("expected kept trash entry, got %+v", entries)
+	}
+	purgeTrash(area, time.Now().Add(2*time.Hour))
+	if entries, _ := client.TrashList(); len(entries) != 0 {
+		t.Fatalf("expected purged trash entry, got %+v", entries)
+	}
+	if _, err := os.Stat(client.trashPath(entry.ID)); !os.IsNotExist(err) {
+		t.Fatalf("expected removed trash directory, got %v", err)
+	}
+	if _, err := client.Undelete(entry.ID); err == nil {
+		t.Fatal("expected error of purged trash entry")
+	}
+}
+
+// TestDeleteNonEmptyDirectory tests that non-empty directory is deleted only
+// if recursive deletion is requested
+func TestDeleteNonEmptyDirectory(t *testing.T) {
+	client := NewLocalFsClient(t.TempDir())
+	area := &StorageArea{Name: "raw", Backend: client, Capabilities: client.Capabilities()}
+	areas := storageAreas
+	defer func() { storageAreas = areas }()
+	storageAreas = map[string]*StorageArea{"raw": area}
+	uploadContent(t, client, "data", "file.txt", "content")
+
+	for _, query := range []string{"", "?recursive=true"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("DELETE", "/storage/raw/data"+query, nil)
+		storageDelete(c, area, "data", "")
+		_, err := os.Stat(filepath.Join(client.Storage, "data", "file.txt"))
+		if query == "" {
+			if w.Code != http.StatusConflict || err != nil {
+				t.Fatalf("expected conflict and kept directory, got %d %s (%v)", w.Code, w.Body.String(), err)
+			}
+			continue
+		}
+		if w.Code != http.StatusOK || !os.IsNotExist(err) {
+			t.Fatalf("expected deleted directory, got %d %s (%v)", w.Code, w.Body.String(), err)
+		}
+	}
+	entries, err := client.TrashList()
+	if err != nil || len(entries) != 1 || entries[0].Files != 1 {
+		t.Fatalf("expected trash entry of deleted directory, got %+v (%v)", entries, err)
+	}
+}
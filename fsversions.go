@@ -0,0 +1,411 @@
+package main
+
+// fsversions module provides versioned-file mode of LocalFsClient, prior
+// revisions of files are kept within versions directory of metadata area
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// versionIdPattern represents pattern of version ids of LocalFsClient
+var versionIdPattern = regexp.MustCompile("^[0-9a-f]+-[0-9a-f]+$")
+
+// versioningMutex serializes updates of versioning state of storages
+var versioningMutex sync.Mutex
+
+// helper function to return version id of a file, it is derived from
+// modification time and size of the file, i.e. it is the same as its ETag
+func versionID(info os.FileInfo) string {
+	return strings.Trim(fileETag(info.ModTime(), info.Size()), "\"")
+}
+
+// helper function to return location of versioning state of the storage
+func (l *LocalFsClient) versioningPath() string {
+	return filepath.Join(filepath.Clean(l.Storage), metaArea, "versioning.json")
+}
+
+// helper function to read versioning state of top-level directories
+func (l *LocalFsClient) versioningState() (map[string]bool, error) {
+	state := make(map[string]bool)
+	data, err := os.ReadFile(l.versioningPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// helper function to return top-level directory of given path, versioning
+// is enabled per top-level directory similar to S3 buckets
+func (l *LocalFsClient) topDir(path string) string {
+	rel, err := filepath.Rel(filepath.Clean(l.Storage), path)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return strings.Split(filepath.ToSlash(rel), "/")[0]
+}
+
+// helper function to check if versioning is enabled for given path
+func (l *LocalFsClient) versioned(path string) bool {
+	if isTransferTemp(filepath.Base(path)) {
+		return false
+	}
+	state, err := l.versioningState()
+	if err != nil {
+		l.Logger.Printf("Failed to read versioning state: %v", err)
+		return false
+	}
+	return state[l.topDir(path)]
+}
+
+// helper function to return location of prior versions of given file
+func (l *LocalFsClient) versionsPath(path string) string {
+	root := filepath.Clean(l.Storage)
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	return filepath.Join(root, metaArea, "versions", rel)
+}
+
+// Versioning implements Versioner interface, it reports if versioning of
+// top-level directory is enabled
+func (l *LocalFsClient) Versioning(dir string) (bool, error) {
+	path, err := l.resolve(dir)
+	if err != nil {
+		return false, fmt.Errorf("[DataManagement.main.LocalFsClient.Versioning] resolve error: %w", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return false, fmt.Errorf("[DataManagement.main.LocalFsClient.Versioning] os.Stat error: %w", err)
+	}
+	return l.versioned(path), nil
+}
+
+// SetVersioning implements Versioner interface, it enables or suspends
+// versioning of top-level directory, the existing versions of files are kept
+func (l *LocalFsClient) SetVersioning(dir string, enabled bool) error {
+	if err := l.writable(); err != nil {
+		return err
+	}
+	path, err := l.resolve(dir)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetVersioning] resolve error: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetVersioning] os.Stat error: %w", err)
+	}
+	top := l.topDir(path)
+	if !info.IsDir() || top == "" {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetVersioning] %s is not a directory", dir)
+	}
+	versioningMutex.Lock()
+	defer versioningMutex.Unlock()
+	state, err := l.versioningState()
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetVersioning] versioningState error: %w", err)
+	}
+	state[top] = enabled
+	if err := l.writeJSON(l.versioningPath(), state); err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.SetVersioning] writeJSON error: %w", err)
+	}
+	l.Logger.Printf("Versioning of %s is set to %v", top, enabled)
+	return nil
+}
+
+// preserve keeps current revision of given file within versions directory
+// if versioning of its top-level directory is enabled. It should be called
+// before the file is replaced or removed. The revision is kept as copy of
+// the file (hard link would share content with in-place modifications of
+// the file) along with its attributes.
+func (l *LocalFsClient) preserve(path string) error {
+	if !l.versioned(path) {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	vid := versionID(info)
+	vdir := l.versionsPath(path)
+	fname := filepath.Join(vdir, vid)
+	if _, err := os.Stat(fname); err == nil {
+		// this revision is already kept
+		return nil
+	}
+	if err := l.mkdirAll(vdir); err != nil {
+		return err
+	}
+	// the copy is renamed once it is complete to keep only complete revisions
+	tmp := fname + ".tmp"
+	if err := copyFile(path, tmp); err != nil {
+		return err
+	}
+	// the copy keeps modification time of the file, i.e. its version id,
+	// since the revision may be promoted back to current one
+	if err := os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := l.setMode(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, fname); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	meta := l.fileMetadata(path, info)
+	version := Version{
+		VersionID:   vid,
+		Size:        meta.Size,
+		ModTime:     meta.ModTime,
+		ContentType: meta.ContentType,
+		ETag:        meta.ETag,
+		Checksums:   meta.Checksums,
+	}
+	return l.writeJSON(fname+".json", version)
+}
+
+// helper function to copy content of a file, on Linux the content is copied
+// within the kernel (via copy_file_range) and it may be cloned by file-systems
+// which support reflinks
+func copyFile(src, dst string) error {
+	reader, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	writer, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.Close()
+		os.Remove(dst)
+		return err
+	}
+	return writer.Close()
+}
+
+// helper function to read prior versions of given file
+func (l *LocalFsClient) priorVersions(path string) ([]Version, error) {
+	var versions []Version
+	vdir := l.versionsPath(path)
+	entries, err := os.ReadDir(vdir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return versions, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(vdir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var version Version
+		if err := json.Unmarshal(data, &version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+// Versions implements Versioner interface, it lists current revision of a
+// file along with its prior versions
+func (l *LocalFsClient) Versions(dir, file string) ([]Version, error) {
+	path, err := l.resolve(dir, file)
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.LocalFsClient.Versions] resolve error: %w", err)
+	}
+	var versions []Version
+	var current string
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		meta := l.fileMetadata(path, info)
+		current = versionID(info)
+		versions = append(versions, Version{
+			VersionID:   current,
+			Size:        meta.Size,
+			ModTime:     meta.ModTime,
+			IsLatest:    true,
+			ContentType: meta.ContentType,
+			ETag:        meta.ETag,
+			Checksums:   meta.Checksums,
+		})
+	}
+	prior, err := l.priorVersions(path)
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.LocalFsClient.Versions] priorVersions error: %w", err)
+	}
+	for _, version := range prior {
+		if version.VersionID != current {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("[DataManagement.main.LocalFsClient.Versions] file %s/%s: %w", dir, file, os.ErrNotExist)
+	}
+	return versions, nil
+}
+
+// helper function to resolve file and check if given version id refers to
+// its current revision
+func (l *LocalFsClient) resolveVersion(dir, file, vid string) (string, bool, error) {
+	if !versionIdPattern.MatchString(vid) {
+		return "", false, fmt.Errorf("invalid version id '%s': %w", vid, os.ErrNotExist)
+	}
+	path, err := l.resolve(dir, file)
+	if err != nil {
+		return "", false, err
+	}
+	info, err := os.Stat(path)
+	current := err == nil && !info.IsDir() && versionID(info) == vid
+	return path, current, nil
+}
+
+// helper function to read record of prior version of given file
+func (l *LocalFsClient) priorVersion(path, vid string) (Version, error) {
+	var version Version
+	data, err := os.ReadFile(filepath.Join(l.versionsPath(path), vid+".json"))
+	if err != nil {
+		return version, err
+	}
+	err = json.Unmarshal(data, &version)
+	return version, err
+}
+
+// OpenVersion implements Versioner interface
+func (l *LocalFsClient) OpenVersion(dir, file, vid string) (io.ReadSeekCloser, Metadata, error) {
+	var meta Metadata
+	path, current, err := l.resolveVersion(dir, file, vid)
+	if err != nil {
+		return nil, meta, fmt.Errorf("[DataManagement.main.LocalFsClient.OpenVersion] resolveVersion error: %w", err)
+	}
+	if current {
+		return l.Open(dir, file)
+	}
+	version, err := l.priorVersion(path, vid)
+	if err != nil {
+		return nil, meta, fmt.Errorf("[DataManagement.main.LocalFsClient.OpenVersion] priorVersion error: %w", err)
+	}
+	fobj, err := os.Open(filepath.Join(l.versionsPath(path), vid))
+	if err != nil {
+		return nil, meta, fmt.Errorf("[DataManagement.main.LocalFsClient.OpenVersion] os.Open error: %w", err)
+	}
+	meta = Metadata{
+		Name:        filepath.Base(path),
+		Size:        version.Size,
+		ModTime:     version.ModTime,
+		ContentType: version.ContentType,
+		ETag:        version.ETag,
+		Checksums:   version.Checksums,
+	}
+	return fobj, meta, nil
+}
+
+// DeleteVersion implements Versioner interface, it permanently removes
+// version of a file. If current revision of the file is removed the latest
+// prior version becomes current one.
+func (l *LocalFsClient) DeleteVersion(dir, file, vid string) error {
+	if err := l.writable(); err != nil {
+		return err
+	}
+	path, current, err := l.resolveVersion(dir, file, vid)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.DeleteVersion] resolveVersion error: %w", err)
+	}
+	vdir := l.versionsPath(path)
+	if current {
+		if err := l.retained(path, false); err != nil {
+			return err
+		}
+	}
+	if !current {
+		if err := os.Remove(filepath.Join(vdir, vid)); err != nil {
+			return fmt.Errorf("[DataManagement.main.LocalFsClient.DeleteVersion] os.Remove error: %w", err)
+		}
+		os.Remove(filepath.Join(vdir, vid+".json"))
+		l.Logger.Printf("Deleted version %s of file %s", vid, path)
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.DeleteVersion] os.Remove error: %w", err)
+	}
+	l.removeAttrs(path, false)
+	l.Logger.Printf("Deleted version %s of file %s", vid, path)
+	prior, err := l.priorVersions(path)
+	if err != nil || len(prior) == 0 {
+		return nil
+	}
+	// promote the latest prior version, the renamed file keeps its
+	// modification time and therefore its version id
+	latest := prior[0]
+	if err := os.Rename(filepath.Join(vdir, latest.VersionID), path); err != nil {
+		return fmt.Errorf("[DataManagement.main.LocalFsClient.DeleteVersion] os.Rename error: %w", err)
+	}
+	os.Remove(filepath.Join(vdir, latest.VersionID+".json"))
+	if info, err := os.Stat(path); err == nil {
+		attrs := FileAttributes{
+			Size:        info.Size(),
+			ModTime:     info.ModTime(),
+			Checksums:   latest.Checksums,
+			ContentType: latest.ContentType,
+		}
+		if err := l.writeAttrs(path, attrs); err != nil {
+			l.Logger.Printf("Failed to write attributes of file %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// RestoreVersion implements Versioner interface, it copies prior version of
+// a file which makes it the current revision of the file while the replaced
+// revision is kept as prior version
+func (l *LocalFsClient) RestoreVersion(dir, file, vid string) (Metadata, error) {
+	path, current, err := l.resolveVersion(dir, file, vid)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("[DataManagement.main.LocalFsClient.RestoreVersion] resolveVersion error: %w", err)
+	}
+	if current {
+		return l.Stat(dir, file)
+	}
+	reader, meta, err := l.OpenVersion(dir, file, vid)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.RestoreVersion] OpenVersion error: %w", err)
+	}
+	defer reader.Close()
+	meta, err = l.writeFile(path, meta.ContentType, reader, meta.Size, meta.Checksums)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.LocalFsClient.RestoreVersion] writeFile error: %w", err)
+	}
+	l.Logger.Printf("Restored version %s of file %s", vid, path)
+	return meta, nil
+}
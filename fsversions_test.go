@@ -0,0 +1,141 @@
+package main
+
+// fsversions tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// helper function to upload given content to a file of file-system storage
+func uploadContent(t *testing.T, client *LocalFsClient, dir, file, content string) Metadata {
+	t.Helper()
+	meta, err := client.Upload(dir, file, "text/plain", strings.NewReader(content), int64(len(content)), nil)
+	if err != nil {
+		t.Fatalf("unable to upload %s/%s: %v", dir, file, err)
+	}
+	return meta
+}
+
+// helper function to read content of a file of file-system storage
+func readContent(t *testing.T, client *LocalFsClient, dir, file string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(client.Storage, dir, file))
+	if err != nil {
+		t.Fatalf("unable to read %s/%s: %v", dir, file, err)
+	}
+	return string(data)
+}
+
+// TestVersionsKeepPriorRevisions tests that replaced and deleted files are
+// kept as prior versions of versioned directories only
+func TestVersionsKeepPriorRevisions(t *testing.T) {
+	client := NewLocalFsClient(t.TempDir())
+	for _, dir := range []string{"versioned", "plain"} {
+		if err := client.Create(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.SetVersioning("versioned", true); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"versioned", "plain"} {
+		uploadContent(t, client, dir, "file.txt", "first")
+		uploadContent(t, client, dir, "file.txt", "second revision")
+	}
+	versions, err := client.Versions("versioned", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || !versions[0].IsLatest || versions[1].IsLatest {
+		t.Fatalf("expected current and prior versions, got %+v", versions)
+	}
+	reader, _, err := client.OpenVersion("versioned", "file.txt", versions[1].VersionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != "first" {
+		t.Fatalf("expected content of prior version, got %q (%v)", data, err)
+	}
+	versions, err = client.Versions("plain", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Fatalf("expected only current version of not versioned file, got %+v", versions)
+	}
+
+	// deleted file keeps its revision
+	if err := client.Delete("versioned", "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	versions, err = client.Versions("versioned", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].IsLatest {
+		t.Fatalf("expected two prior versions of deleted file, got %+v", versions)
+	}
+}
+
+// TestDeleteCurrentVersion tests that the latest prior version becomes
+// current one and keeps its version id once current version is deleted
+func TestDeleteCurrentVersion(t *testing.T) {
+	client := NewLocalFsClient(t.TempDir())
+	if err := client.Create("data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetVersioning("data", true); err != nil {
+		t.Fatal(err)
+	}
+	uploadContent(t, client, "data", "file.txt", "first")
+	// make sure that prior revision has distinct modification time
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filepath.Join(client.Storage, "data", "file.txt"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	uploadContent(t, client, "data", "file.txt", "second")
+	versions, err := client.Versions("data", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("expected two versions, got %+v", versions)
+	}
+	current, prior := versions[0], versions[1]
+	if !prior.ModTime.Equal(mtime) {
+		t.Fatalf("expected prior version modification time %v, got %v", mtime, prior.ModTime)
+	}
+
+	if err := client.DeleteVersion("data", "file.txt", current.VersionID); err != nil {
+		t.Fatal(err)
+	}
+	versions, err = client.Versions("data", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Fatalf("expected single version, got %+v", versions)
+	}
+	if !versions[0].IsLatest || versions[0].VersionID != prior.VersionID {
+		t.Fatalf("expected current version %s, got %+v", prior.VersionID, versions[0])
+	}
+	if content := readContent(t, client, "data", "file.txt"); content != "first" {
+		t.Fatalf("expected content of prior version, got %q", content)
+	}
+	// promoted version is addressable by its version id
+	if err := client.DeleteVersion("data", "file.txt", prior.VersionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(client.Storage, "data", "file.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected deleted file, got %v", err)
+	}
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
-	"log"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
 
 	srvConfig "github.com/CHESSComputing/golib/config"
 	server "github.com/CHESSComputing/golib/server"
@@ -30,122 +34,337 @@ func DataLocationHandler(c *gin.Context) {
 	// Find metadata record for given DID
 	meta, err := findMetaDataRecord(did)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "metadata record not found"})
+		metaDataError(c, err)
 		return
 	}
 
 	// by default use DataLocationAttributes as list of meta-data record attributes to lookup
 	// but if HTTP request provide concrete attribute switch to it
-	locationAttributes := srvConfig.Config.CHESSMetaData.DataLocationAttributes
-	attr := c.Query("attr")
-	if attr != "" {
-		locationAttributes = []string{attr}
-	}
-
-	// Extract data location from metadata record
-	for _, attr := range locationAttributes {
-		if val, ok := meta[attr]; ok {
-			// if location attribute (raw data location) is found redirect to it
-			path := val.(string)
-			// join path from meta-data record with possible spath
-			if spath != "" {
-				path = filepath.Join(path, spath)
-			}
+	attrs, ok := locationAttributes(c)
+	if !ok {
+		return
+	}
+	locations := dataLocations(meta, attrs)
+	if len(locations) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "data location not found in metadata"})
+		return
+	}
+
+	// search requested path across all data locations (e.g. raw, reduced and
+	// processed data) and use the first location where it exists
+	for _, loc := range locations {
+		location := loc.Path
+		// join path from meta-data record with possible spath,
+		// the user supplied path should stay within data location area
+		path, err := resolvePath(location, spath)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+			return
+		}
 
-			// if we have file name we should present it back to upstream caller
-			if fileName != "" {
-				fname := filepath.Join(path, fileName)
-				// Serve file content if it's a file
-				http.ServeFile(c.Writer, c.Request, fname)
+		// if we have file name we should present it back to upstream caller
+		if fileName != "" {
+			fname, err := resolvePath(location, spath, fileName)
+			if err != nil {
+				c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+				return
+			}
+			if _, err := os.Stat(fname); err != nil {
+				continue
+			}
+			if isStatRequest(c) {
+				dataStat(c, location, spath, fileName)
 				return
 			}
+			// Serve file content if it's a file
+			auditData(c, fname)
+			http.ServeFile(c.Writer, c.Request, fname)
+			return
+		}
 
-			// get info about our path
-			info, err := os.Stat(path)
+		// get info about our path
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if isStatRequest(c) {
+			dataStat(c, location, spath, "")
+			return
+		}
+
+		// If requesting JSON, return directory listing in JSON format
+		acceptHeader := c.GetHeader("Accept")
+		if info.IsDir() {
+			opts, err := parseListOptions(c)
 			if err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "path not found"})
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
+			entries, cursor, truncated, err := getFileList(c.Request.Context(), did, location, spath, opts)
+			if err != nil {
+				c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "cannot read directory"})
+				return
+			}
+			if cursor != "" {
+				c.Header("X-Next-Cursor", cursor)
+			}
+			if truncated {
+				c.Header("X-Truncated", "true")
+			}
 
-			// If requesting JSON, return directory listing in JSON format
-			acceptHeader := c.GetHeader("Accept")
-			if info.IsDir() {
-				entries, err := getFileList(did, path, spath)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot read directory"})
-					return
-				}
-
-				if acceptHeader == "application/json" {
-					c.JSON(http.StatusOK, entries)
-					return
-				}
-
-				// Render HTML template
-				tmpl := server.MakeTmpl(StaticFs, "DataManagement")
-				base := srvConfig.Config.DataManagement.WebServer.Base
-				tmpl["Base"] = base
-				tmpl["Area"] = path
-				tmpl["Entries"] = entries
-				tmpl["Did"] = did
-				tmpl["FileExtensions"] = fileExtensions(path)
-				content := server.TmplPage(StaticFs, "fs.tmpl", tmpl)
-				page := server.Header(StaticFs, base) + content + server.FooterEmpty(StaticFs, base)
-				c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+			if acceptHeader == "application/json" {
+				c.JSON(http.StatusOK, entries)
 				return
 			}
 
-			// Serve file content if it's a file
-			http.ServeFile(c.Writer, c.Request, path)
+			// Render HTML template
+			tmpl := server.MakeTmpl(StaticFs, "DataManagement")
+			base := srvConfig.Config.DataManagement.WebServer.Base
+			tmpl["Base"] = base
+			tmpl["Area"] = path
+			tmpl["Entries"] = entries
+			tmpl["Did"] = did
+			tmpl["FileExtensions"] = fileExtensions(c.Request.Context(), location, spath)
+			if cursor != "" {
+				tmpl["NextPage"] = nextPageQuery(c, cursor)
+			}
+			content := server.TmplPage(StaticFs, "fs.tmpl", tmpl)
+			page := server.Header(StaticFs, base) + content + server.FooterEmpty(StaticFs, base)
+			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
 			return
 		}
+
+		// Serve file content if it's a file
+		auditData(c, path)
+		http.ServeFile(c.Writer, c.Request, path)
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "path not found"})
+}
+
+// helper function to write metadata of file or directory of data location to
+// HTTP response
+func dataStat(c *gin.Context, location, spath, fileName string) {
+	meta, err := NewLocalFsClient(location).Stat(spath, fileName)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
 	}
-	c.JSON(http.StatusNotFound, gin.H{"error": "data location not found in metadata"})
+	statResponse(c, meta)
 }
 
-// DataFilesHandler provides access to data files
+// DataFilesHandler provides search of files in data locations of a DID
+/*
+```
+# find all files in data locations of a DID
+curl "http://localhost:8340/files?did=<did>&pattern=all"
+# find HDF5 files larger than 1MB modified in January 2024 within scan1 sub-path
+curl "http://localhost:8340/files?did=<did>&path=scan1&glob=*.h5&min_size=1048576&after=2024-01-01&before=2024-02-01"
+# find first 100 images of reduced data location up to 2 levels deep
+curl "http://localhost:8340/files?did=<did>&attr=reduced_data_location&ctype=image/*&depth=2&limit=100"
+```
+*/
 func DataFilesHandler(c *gin.Context) {
 	// Get DID from HTTP request
 	did := c.Query("did")
 	if did == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing did parameter"})
-		return
-	}
-	pattern := c.Query("pattern")
-	if pattern == "" {
-		c.JSON(http.StatusNotFound, gin.H{"error": "no files pattern is provided"})
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": "missing did parameter"})
 		return
 	}
 	if val, err := url.QueryUnescape(did); err == nil {
 		did = val
 	}
-	if val, err := url.QueryUnescape(pattern); err == nil {
-		pattern = val
+	// pattern is regular expression of file names, 'all' matches all files
+	var re *regexp.Regexp
+	if pattern := c.Query("pattern"); pattern != "" && pattern != "all" {
+		if val, err := url.QueryUnescape(pattern); err == nil {
+			pattern = val
+		}
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": fmt.Sprintf("invalid regex pattern: %v", err)})
+			return
+		}
+	}
+	opts, err := parseListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	// search is recursive and returns files by default
+	if c.Query("depth") == "" && c.Query("recursive") == "" {
+		opts.Depth = -1
+	}
+	if c.Query("type") == "" {
+		opts.Type = "file"
+	}
+	if opts.Limit == 0 {
+		opts.Limit = maxListLimit
 	}
 
 	// Find metadata record for given DID
 	meta, err := findMetaDataRecord(did)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "metadata record not found"})
+		metaDataError(c, err)
 		return
 	}
 
-	// Extract data location from metadata record
-	for _, attr := range srvConfig.Config.CHESSMetaData.DataLocationAttributes {
-		if val, ok := meta[attr]; ok {
-			// take data location
-			path := val.(string)
+	// find files matching our search across data locations
+	attrs, ok := locationAttributes(c)
+	if !ok {
+		return
+	}
+	locations := dataLocations(meta, attrs)
+	if len(locations) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"status": "fail", "error": "data files not found"})
+		return
+	}
+	entries, cursor, truncated, err := searchFiles(c.Request.Context(), did, locations, c.Query("path"), re, opts)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if cursor != "" {
+		c.Header("X-Next-Cursor", cursor)
+	}
+	if truncated {
+		c.Header("X-Truncated", "true")
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": entries, "next_cursor": cursor, "truncated": truncated})
+}
 
-			// find all files in that location using our pattern
-			files, err := findFiles(path, pattern)
-			if err != nil {
-				log.Println("WARNING: findFiles", err)
-				//                 c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-				//                 return
-			}
-			c.JSON(http.StatusOK, files)
+// DataLocationsHandler provides access to GET /locations end-point
+/*
+```
+# get all data locations of given DID
+curl "http://localhost:8340/locations?did=/beamline=3a/btr=123/cycle=2024-3/sample_name=bla"
+# get data locations of specific attribute along with total size of their files
+curl "http://localhost:8340/locations?did=<did>&attr=reduced_data_location&size=true"
+```
+*/
+func DataLocationsHandler(c *gin.Context) {
+	did := c.Query("did")
+	if did == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": "missing did parameter"})
+		return
+	}
+	dirSize, _ := strconv.ParseBool(c.Query("size"))
+	meta, err := findMetaDataRecord(did)
+	if err != nil {
+		metaDataError(c, err)
+		return
+	}
+	attrs, ok := locationAttributes(c)
+	if !ok {
+		return
+	}
+	locations := dataLocations(meta, attrs)
+	for i := range locations {
+		locations[i].Stat(c.Request.Context(), dirSize)
+	}
+	if locations == nil {
+		locations = []DataLocation{}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "did": did, "data": locations})
+}
+
+// MetaDataCacheDeleteHandler provides access to DELETE /metadata/cache end-point
+/*
+```
+# invalidate cached meta-data record of given DID
+curl -X DELETE "http://localhost:8340/metadata/cache?did=/beamline=3a/btr=123/cycle=2024-3/sample_name=bla"
+# purge all cached meta-data records
+curl -X DELETE http://localhost:8340/metadata/cache
+```
+*/
+func MetaDataCacheDeleteHandler(c *gin.Context) {
+	cache, ok := metaDataClient.(*MetaDataCache)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "meta-data cache is disabled"})
+		return
+	}
+	if did := c.Query("did"); did != "" {
+		cache.Invalidate(did)
+	} else {
+		cache.Purge()
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// EventsHandler provides access to GET /events end-point which streams
+// file-system change events as Server-Sent Events
+/*
+```
+# get change events of all watched storage areas and data locations
+curl -N http://localhost:8340/events
+# get change events of raw storage area
+curl -N "http://localhost:8340/events?area=raw"
+# get change events of data locations of a DID
+curl -N "http://localhost:8340/events?did=/beamline=3a/btr=123/cycle=2024-3/sample_name=bla"
+```
+*/
+func EventsHandler(c *gin.Context) {
+	if fsWatcher == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"status": "fail", "error": "file-system watcher is disabled"})
+		return
+	}
+	area := c.Query("area")
+	if area != "" {
+		if _, err := storageArea(area); err != nil {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+	}
+	locations := make(map[string]bool)
+	if did := c.Query("did"); did != "" {
+		meta, err := findMetaDataRecord(did)
+		if err != nil {
+			metaDataError(c, err)
+			return
+		}
+		attrs, ok := locationAttributes(c)
+		if !ok {
 			return
 		}
+		dlocations := dataLocations(meta, attrs)
+		if len(dlocations) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"status": "fail", "error": "data location not found in metadata"})
+			return
+		}
+		for _, loc := range dlocations {
+			fsWatcher.WatchLocation(loc.Path)
+			locations[filepath.Clean(loc.Path)] = true
+		}
 	}
-	c.JSON(http.StatusNotFound, gin.H{"error": "data files not found"})
+
+	events, cancel := fsWatcher.Bus.Subscribe(100)
+	defer cancel()
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			if area != "" && event.Area != area {
+				return true
+			}
+			if len(locations) > 0 && !locations[event.Location] {
+				return true
+			}
+			c.SSEvent(event.Type, event)
+		case <-ticker.C:
+			// keep connection alive
+			c.SSEvent("ping", gin.H{"time": time.Now()})
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
 }
@@ -0,0 +1,430 @@
+package main
+
+// lifecycle module provides lifecycle rules and retention of files of
+// storage areas. The lifecycle rules of S3 buckets are applied by S3 storage
+// while rules of other storage backends are periodically applied by
+// DataManagement service. The retention of files is kept by storage backends
+// and extended by retention policies of DataManagement configuration.
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrRetained represents error of deletion or replacement of retained file
+var ErrRetained = errors.New("file is under retention")
+
+// lifecycleIdPattern represents pattern of lifecycle rule ids
+var lifecycleIdPattern = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9_.-]*$")
+
+// day represents duration of one day used by lifecycle rules and retention
+// policies
+const day = 24 * time.Hour
+
+// validateLifecycle validates lifecycle rules, every rule should have unique
+// id and at least one action
+func validateLifecycle(rules []LifecycleRule) error {
+	ids := make(map[string]bool)
+	for _, rule := range rules {
+		if !lifecycleIdPattern.MatchString(rule.ID) {
+			return fmt.Errorf("invalid lifecycle rule id '%s'", rule.ID)
+		}
+		if ids[rule.ID] {
+			return fmt.Errorf("duplicate lifecycle rule id '%s'", rule.ID)
+		}
+		ids[rule.ID] = true
+		if rule.ExpireDays < 0 || rule.TransitionDays < 0 || rule.AbortUploadsDays < 0 {
+			return fmt.Errorf("lifecycle rule '%s' has negative number of days", rule.ID)
+		}
+		if rule.ExpireDays == 0 && rule.TransitionDays == 0 && rule.AbortUploadsDays == 0 {
+			return fmt.Errorf("lifecycle rule '%s' does not have any action", rule.ID)
+		}
+		if (rule.TransitionDays > 0) != (rule.TransitionTarget != "") {
+			return fmt.Errorf("lifecycle rule '%s' should have both transition days and target", rule.ID)
+		}
+		if rule.ExpireDays > 0 && rule.TransitionDays > 0 && rule.ExpireDays <= rule.TransitionDays {
+			return fmt.Errorf("lifecycle rule '%s' expires files before their transition", rule.ID)
+		}
+	}
+	return nil
+}
+
+// validateTransitions validates transition targets of lifecycle rules of
+// storage area, the files of S3 buckets are transitioned to S3 storage
+// classes while files of other storage backends are moved to other storage
+// areas
+func validateTransitions(area *StorageArea, rules []LifecycleRule) error {
+	if area.Type == "s3" {
+		return nil
+	}
+	for _, rule := range rules {
+		if rule.TransitionTarget == "" {
+			continue
+		}
+		target, err := storageArea(rule.TransitionTarget)
+		if err != nil {
+			return fmt.Errorf("lifecycle rule '%s' has invalid transition target: %w", rule.ID, err)
+		}
+		if target == area || !slices.Contains(target.Capabilities, "write") {
+			return fmt.Errorf("lifecycle rule '%s' has invalid transition target '%s'", rule.ID, target.Name)
+		}
+	}
+	return nil
+}
+
+// validateRetention validates retention of a file
+func validateRetention(retention Retention) error {
+	switch retention.Mode {
+	case "":
+		if !retention.RetainUntil.IsZero() {
+			return errors.New("retention mode is not provided")
+		}
+	case RetentionGovernance, RetentionCompliance:
+		if retention.RetainUntil.IsZero() {
+			return errors.New("retention date is not provided")
+		}
+	default:
+		return fmt.Errorf("invalid retention mode '%s', supported modes: %s, %s",
+			retention.Mode, RetentionGovernance, RetentionCompliance)
+	}
+	return nil
+}
+
+// extendRetention extends current retention of a file with given one, the
+// retention period can not be shortened and active compliance retention can
+// not be changed to governance one, the legal hold can only be placed
+func extendRetention(current, update Retention) (Retention, error) {
+	if err := validateRetention(update); err != nil {
+		return current, err
+	}
+	now := time.Now()
+	result := current
+	result.LegalHold = current.LegalHold || update.LegalHold
+	if update.Mode == "" {
+		return result, nil
+	}
+	if now.Before(current.RetainUntil) {
+		if update.RetainUntil.Before(current.RetainUntil) {
+			return current, fmt.Errorf("%w until %s, it can not be shortened", ErrRetained, current.RetainUntil.Format(time.RFC3339))
+		}
+		if current.Mode == RetentionCompliance && update.Mode != RetentionCompliance {
+			return current, fmt.Errorf("%w in %s mode, it can not be changed", ErrRetained, current.Mode)
+		}
+	}
+	result.Mode = update.Mode
+	result.RetainUntil = update.RetainUntil
+	return result, nil
+}
+
+// releaseRetention removes legal hold and governance retention of a file,
+// active compliance retention is kept
+func releaseRetention(current Retention) Retention {
+	if current.Mode == RetentionCompliance && time.Now().Before(current.RetainUntil) {
+		return Retention{Mode: current.Mode, RetainUntil: current.RetainUntil}
+	}
+	return Retention{}
+}
+
+// policyRetention provides retention of a file defined by retention
+// policies of DataManagement configuration, the file is retained for policy
+// period since its last modification
+func policyRetention(area, dir, file string, modTime time.Time) Retention {
+	var retention Retention
+	for _, policy := range dmConfig.Lifecycle.Retention {
+		if policy.Area != area || (policy.Dir != "" && policy.Dir != dir) || !strings.HasPrefix(file, policy.Prefix) {
+			continue
+		}
+		until := modTime.Add(time.Duration(policy.Days) * day)
+		if until.After(retention.RetainUntil) || (until.Equal(retention.RetainUntil) && policy.Mode == RetentionCompliance) {
+			retention.Mode = policy.Mode
+			retention.RetainUntil = until
+		}
+	}
+	return retention
+}
+
+// helper function to check if any retention policy applies to given
+// directory of storage area
+func hasRetentionPolicy(area, dir string) bool {
+	for _, policy := range dmConfig.Lifecycle.Retention {
+		if policy.Area == area && (policy.Dir == "" || policy.Dir == dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileRetention provides effective retention of a file of storage area, it
+// combines retention kept by storage backend with retention policies of
+// DataManagement configuration
+func fileRetention(area *StorageArea, dir, file string) (Retention, error) {
+	var retention Retention
+	if manager, ok := area.Backend.(RetentionManager); ok {
+		var err error
+		if retention, err = manager.Retention(dir, file); err != nil {
+			return retention, fmt.Errorf("[DataManagement.main.fileRetention] Retention error: %w", err)
+		}
+	}
+	if hasRetentionPolicy(area.Name, dir) {
+		meta, err := area.Backend.Stat(dir, file)
+		if err != nil {
+			return retention, fmt.Errorf("[DataManagement.main.fileRetention] Stat error: %w", err)
+		}
+		policy := policyRetention(area.Name, dir, file, meta.ModTime)
+		if policy.RetainUntil.After(retention.RetainUntil) {
+			retention.Mode = policy.Mode
+			retention.RetainUntil = policy.RetainUntil
+		}
+	}
+	return retention, nil
+}
+
+// checkRetention checks that a file or all files of a directory (S3 bucket)
+// of storage area can be deleted or replaced, i.e. they are not retained.
+// The non-existing files are not retained.
+func checkRetention(area *StorageArea, dir, file string) error {
+	if file != "" {
+		retention, err := fileRetention(area, dir, file)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if retention.Active(time.Now()) {
+			return fmt.Errorf("%w: %s/%s/%s", ErrRetained, area.Name, dir, file)
+		}
+		return nil
+	}
+	if _, ok := area.Backend.(RetentionManager); !ok && !hasRetentionPolicy(area.Name, dir) {
+		return nil
+	}
+	entries, _, err := listContext(context.Background(), area.Backend, dir, -1)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.checkRetention] list error: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDirectory {
+			continue
+		}
+		if err := checkRetention(area, dir, entry.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initLifecycle applies lifecycle rules of DataManagement configuration to
+// storage areas and starts periodic application of lifecycle rules. The
+// configured rules replace existing rules with the same ids.
+func initLifecycle() error {
+	if dmConfig.Lifecycle.Interval <= 0 {
+		return fmt.Errorf("invalid lifecycle interval %d, it should be positive number of seconds", dmConfig.Lifecycle.Interval)
+	}
+	for _, policy := range dmConfig.Lifecycle.Retention {
+		if _, err := storageArea(policy.Area); err != nil {
+			return fmt.Errorf("invalid retention policy: %w", err)
+		}
+		if policy.Days <= 0 {
+			return fmt.Errorf("retention policy of %s area should have positive number of days", policy.Area)
+		}
+		if policy.Mode != RetentionGovernance && policy.Mode != RetentionCompliance {
+			return fmt.Errorf("invalid retention mode '%s' of %s area", policy.Mode, policy.Area)
+		}
+	}
+	type areaDir struct{ area, dir string }
+	var order []areaDir
+	rules := make(map[areaDir][]LifecycleRule)
+	for _, policy := range dmConfig.Lifecycle.Rules {
+		key := areaDir{policy.Area, policy.Dir}
+		if _, ok := rules[key]; !ok {
+			order = append(order, key)
+		}
+		rules[key] = append(rules[key], policy.LifecycleRule)
+	}
+	for _, key := range order {
+		area, err := storageArea(key.area)
+		if err != nil {
+			return fmt.Errorf("invalid lifecycle rule: %w", err)
+		}
+		manager, ok := area.Backend.(LifecycleManager)
+		if !ok {
+			return fmt.Errorf("%w: lifecycle rules of %s storage", ErrNotSupported, area.Type)
+		}
+		if err := validateLifecycle(rules[key]); err != nil {
+			return err
+		}
+		if err := validateTransitions(area, rules[key]); err != nil {
+			return err
+		}
+		current, err := manager.Lifecycle(key.dir)
+		if err != nil {
+			log.Printf("WARNING: unable to get lifecycle rules of %s/%s: %v", key.area, key.dir, err)
+			continue
+		}
+		merged := mergeLifecycle(current, rules[key])
+		if err := manager.SetLifecycle(key.dir, merged); err != nil {
+			log.Printf("WARNING: unable to set lifecycle rules of %s/%s: %v", key.area, key.dir, err)
+			continue
+		}
+		log.Printf("INFO: lifecycle rules of %s/%s: %+v", key.area, key.dir, merged)
+	}
+	go runLifecycle(time.Duration(dmConfig.Lifecycle.Interval) * time.Second)
+	return nil
+}
+
+// helper function to merge lifecycle rules, the rules replace current rules
+// with the same ids
+func mergeLifecycle(current, rules []LifecycleRule) []LifecycleRule {
+	var merged []LifecycleRule
+	for _, rule := range current {
+		if !slices.ContainsFunc(rules, func(r LifecycleRule) bool { return r.ID == rule.ID }) {
+			merged = append(merged, rule)
+		}
+	}
+	return append(merged, rules...)
+}
+
+// runLifecycle periodically applies lifecycle rules of storage areas and
+// purges their expired trash entries
+func runLifecycle(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, area := range listStorageAreas() {
+			applyLifecycle(area, time.Now())
+			purgeTrash(area, time.Now())
+		}
+	}
+}
+
+// applyLifecycle applies lifecycle rules of all directories (S3 buckets) of
+// storage area at given time. The incomplete uploads are aborted for all
+// storage areas, while expiration and transition of files are applied only
+// to storage areas which are not managed by S3 storage.
+func applyLifecycle(area *StorageArea, now time.Time) {
+	manager, ok := area.Backend.(LifecycleManager)
+	if !ok {
+		return
+	}
+	dirs, err := area.Backend.List("", 1)
+	if err != nil {
+		log.Printf("ERROR: unable to list %s storage area: %v", area.Name, err)
+		return
+	}
+	for _, entry := range dirs {
+		if !entry.IsDirectory {
+			continue
+		}
+		rules, err := manager.Lifecycle(entry.Name)
+		if err != nil {
+			log.Printf("ERROR: unable to get lifecycle rules of %s/%s: %v", area.Name, entry.Name, err)
+			continue
+		}
+		var active []LifecycleRule
+		for _, rule := range rules {
+			if !rule.Disabled {
+				active = append(active, rule)
+			}
+		}
+		if len(active) == 0 {
+			continue
+		}
+		abortUploads(area, entry.Name, active, now)
+		if area.Type != "s3" {
+			applyRules(area, entry.Name, active, now)
+		}
+	}
+}
+
+// helper function to abort incomplete uploads of directory (S3 bucket)
+// according to lifecycle rules
+func abortUploads(area *StorageArea, dir string, rules []LifecycleRule, now time.Time) {
+	if uploadManager == nil {
+		return
+	}
+	for _, session := range uploadManager.Sessions(area.Name) {
+		if session.Dir != dir {
+			continue
+		}
+		for _, rule := range rules {
+			if rule.AbortUploadsDays == 0 || !strings.HasPrefix(session.File, rule.Prefix) ||
+				now.Sub(session.Created) < time.Duration(rule.AbortUploadsDays)*day {
+				continue
+			}
+			if err := uploadManager.Abort(session.ID); err != nil {
+				log.Printf("ERROR: lifecycle rule %s unable to abort upload session %s: %v", rule.ID, session.ID, err)
+			} else {
+				log.Printf("INFO: lifecycle rule %s aborted upload session %s", rule.ID, session.ID)
+			}
+			break
+		}
+	}
+}
+
+// helper function to expire and transition files of directory according to
+// lifecycle rules, the retained files are kept
+func applyRules(area *StorageArea, dir string, rules []LifecycleRule, now time.Time) {
+	entries, _, err := listContext(context.Background(), area.Backend, dir, -1)
+	if err != nil {
+		log.Printf("ERROR: unable to list %s/%s: %v", area.Name, dir, err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDirectory {
+			continue
+		}
+		age := now.Sub(entry.ModTime)
+		for _, rule := range rules {
+			if !strings.HasPrefix(entry.Name, rule.Prefix) {
+				continue
+			}
+			if rule.ExpireDays > 0 && age >= time.Duration(rule.ExpireDays)*day {
+				err := checkRetention(area, dir, entry.Name)
+				if err == nil {
+					err = area.Backend.Delete(dir, entry.Name)
+				}
+				auditSystem("lifecycle.expire", area.Name, dir+"/"+entry.Name, entry.Size, err)
+				if err != nil {
+					log.Printf("ERROR: lifecycle rule %s unable to expire %s/%s/%s: %v", rule.ID, area.Name, dir, entry.Name, err)
+				} else {
+					log.Printf("INFO: lifecycle rule %s expired %s/%s/%s", rule.ID, area.Name, dir, entry.Name)
+				}
+				break
+			}
+			if rule.TransitionDays > 0 && age >= time.Duration(rule.TransitionDays)*day {
+				req := TransferRequest{
+					Source:      TransferPath{Area: area.Name, Dir: dir, File: entry.Name},
+					Destination: TransferPath{Area: rule.TransitionTarget, Dir: dir, File: entry.Name},
+					Overwrite:   OverwriteDifferent,
+				}
+				result, err := transfer(req, true)
+				if err == nil && result.Action == ActionSkip {
+					// archived file has the same content
+					if err = checkRetention(area, dir, entry.Name); err == nil {
+						err = area.Backend.Delete(dir, entry.Name)
+					}
+				}
+				auditSystem("lifecycle.transition", area.Name, dir+"/"+entry.Name, entry.Size, err)
+				if err != nil {
+					log.Printf("ERROR: lifecycle rule %s unable to transition %s to %s: %v", rule.ID, req.Source, rule.TransitionTarget, err)
+				} else {
+					log.Printf("INFO: lifecycle rule %s transitioned %s to %s", rule.ID, req.Source, rule.TransitionTarget)
+				}
+				break
+			}
+		}
+	}
+}
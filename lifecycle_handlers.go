@@ -0,0 +1,261 @@
+package main
+
+// lifecycle handlers module provides access to lifecycle rules of
+// directories (S3 buckets) and retention of files (S3 objects) of storage
+// areas
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LifecycleParams represents lifecycle rules of a directory (S3 bucket)
+type LifecycleParams struct {
+	Rules []LifecycleRule `json:"rules"`
+}
+
+// RetentionParams represents retention of a file, the retention period is
+// given either by retention date or by number of days from now
+type RetentionParams struct {
+	Mode        string    `json:"mode"`
+	RetainUntil time.Time `json:"retain_until"`
+	Days        int       `json:"days"`
+	LegalHold   bool      `json:"legal_hold"`
+}
+
+// helper function to check that a file or all files of a directory of
+// storage area are not retained before they are deleted or replaced
+func retentionGuard(c *gin.Context, name, dir, file string) bool {
+	area, err := storageArea(name)
+	if err == nil {
+		err = checkRetention(area, dir, file)
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// helper function to lookup storage area of HTTP request which supports
+// retention of files
+func areaRetention(c *gin.Context) (*StorageArea, RetentionManager, FileStorageParams, bool) {
+	var params FileStorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return nil, nil, params, false
+	}
+	area, err := storageArea(params.Area)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return nil, nil, params, false
+	}
+	manager, ok := area.Backend.(RetentionManager)
+	if !ok {
+		err := fmt.Errorf("%w: retention of %s storage", ErrNotSupported, area.Type)
+		c.JSON(http.StatusNotImplemented, gin.H{"status": "fail", "error": err.Error()})
+		return nil, nil, params, false
+	}
+	return area, manager, params, true
+}
+
+// helper function to provide retention of a file in HTTP response
+func retentionResponse(c *gin.Context, area *StorageArea, params FileStorageParams, retention Retention) {
+	effective, err := fileRetention(area, params.Dir, params.File)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	data := gin.H{
+		"retention": retention,
+		"effective": effective,
+		"active":    effective.Active(time.Now()),
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": data})
+}
+
+// LifecycleHandler provides access to GET /lifecycle/:area/:dir end-point
+/*
+```
+# get lifecycle rules of dir (S3 bucket)
+curl http://localhost:8340/lifecycle/raw/dir
+```
+*/
+func LifecycleHandler(c *gin.Context) {
+	storage, ok := areaBackend(c)
+	if !ok {
+		return
+	}
+	var params StorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	manager, ok := storage.(LifecycleManager)
+	if !ok {
+		err := fmt.Errorf("%w: lifecycle rules of %s storage", ErrNotSupported, storage.Type())
+		c.JSON(http.StatusNotImplemented, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	rules, err := manager.Lifecycle(params.Dir)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if rules == nil {
+		rules = []LifecycleRule{}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": gin.H{"dir": params.Dir, "rules": rules}})
+}
+
+// LifecyclePutHandler provides access to PUT /lifecycle/:area/:dir end-point,
+// the given rules replace existing rules and empty list of rules removes them
+/*
+```
+# expire files of dir after 30 days and abort its incomplete uploads after 7 days
+curl -X PUT http://localhost:8340/lifecycle/raw/dir \
+     -H "Content-Type: application/json" \
+     -d '{"rules":[{"id":"expire", "expire_days":30, "abort_uploads_days":7}]}'
+# move scans older than 90 days to tape storage area (S3 storage class of S3 buckets)
+curl -X PUT http://localhost:8340/lifecycle/raw/dir \
+     -H "Content-Type: application/json" \
+     -d '{"rules":[{"id":"archive", "prefix":"scans/", "transition_days":90, "transition_target":"tape"}]}'
+```
+*/
+func LifecyclePutHandler(c *gin.Context) {
+	var params StorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	area, err := storageArea(params.Area)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	manager, ok := area.Backend.(LifecycleManager)
+	if !ok {
+		err := fmt.Errorf("%w: lifecycle rules of %s storage", ErrNotSupported, area.Type)
+		c.JSON(http.StatusNotImplemented, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	var lifecycle LifecycleParams
+	if err := c.ShouldBindJSON(&lifecycle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if err := validateTransitions(area, lifecycle.Rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if err := manager.SetLifecycle(params.Dir, lifecycle.Rules); err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if lifecycle.Rules == nil {
+		lifecycle.Rules = []LifecycleRule{}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": gin.H{"dir": params.Dir, "rules": lifecycle.Rules}})
+}
+
+// RetentionHandler provides access to GET /retention/:area/:dir/:file
+// end-point, it provides retention kept by storage backend along with
+// effective retention which includes retention policies of the service
+/*
+```
+curl http://localhost:8340/retention/doi/dataset/scan.h5
+```
+*/
+func RetentionHandler(c *gin.Context) {
+	area, manager, params, ok := areaRetention(c)
+	if !ok {
+		return
+	}
+	retention, err := manager.Retention(params.Dir, params.File)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	retentionResponse(c, area, params, retention)
+}
+
+// RetentionPutHandler provides access to PUT /retention/:area/:dir/:file
+// end-point, it places legal hold or extends retention of a file
+/*
+```
+# retain published dataset file for 10 years
+curl -X PUT http://localhost:8340/retention/doi/dataset/scan.h5 \
+     -H "Content-Type: application/json" \
+     -d '{"mode":"compliance", "days":3650}'
+# place legal hold on a file
+curl -X PUT http://localhost:8340/retention/doi/dataset/scan.h5 \
+     -H "Content-Type: application/json" \
+     -d '{"legal_hold":true}'
+```
+*/
+func RetentionPutHandler(c *gin.Context) {
+	area, manager, params, ok := areaRetention(c)
+	if !ok {
+		return
+	}
+	var rparams RetentionParams
+	if err := c.ShouldBindJSON(&rparams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	update := Retention{Mode: rparams.Mode, RetainUntil: rparams.RetainUntil, LegalHold: rparams.LegalHold}
+	if rparams.Days < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": "days should not be negative"})
+		return
+	} else if rparams.Days > 0 {
+		update.RetainUntil = time.Now().Add(time.Duration(rparams.Days) * day)
+	}
+	current, err := manager.Retention(params.Dir, params.File)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	retention, err := extendRetention(current, update)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if err := manager.SetRetention(params.Dir, params.File, retention); err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	retentionResponse(c, area, params, retention)
+}
+
+// RetentionDeleteHandler provides access to DELETE /retention/:area/:dir/:file
+// end-point, it removes legal hold and governance retention of a file while
+// active compliance retention and retention policies of the service are kept
+/*
+```
+curl -X DELETE http://localhost:8340/retention/doi/dataset/scan.h5
+```
+*/
+func RetentionDeleteHandler(c *gin.Context) {
+	area, manager, params, ok := areaRetention(c)
+	if !ok {
+		return
+	}
+	current, err := manager.Retention(params.Dir, params.File)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	retention := releaseRetention(current)
+	if retention != current {
+		if err := manager.SetRetention(params.Dir, params.File, retention); err != nil {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+	}
+	retentionResponse(c, area, params, retention)
+}
@@ -0,0 +1,89 @@
+package main
+
+// lifecycle tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestExtendRetention tests that retention of a file can only be extended
+func TestExtendRetention(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	soon := now.Add(time.Hour)
+	later := now.Add(24 * time.Hour)
+	tests := []struct {
+		name    string
+		current Retention
+		update  Retention
+		result  Retention
+		err     error // expected error, errAny means any error
+	}{
+		{"set governance", Retention{}, Retention{Mode: RetentionGovernance, RetainUntil: soon}, Retention{Mode: RetentionGovernance, RetainUntil: soon}, nil},
+		{"extend governance", Retention{Mode: RetentionGovernance, RetainUntil: soon}, Retention{Mode: RetentionGovernance, RetainUntil: later}, Retention{Mode: RetentionGovernance, RetainUntil: later}, nil},
+		{"shorten governance", Retention{Mode: RetentionGovernance, RetainUntil: later}, Retention{Mode: RetentionGovernance, RetainUntil: soon}, Retention{}, ErrRetained},
+		{"governance to compliance", Retention{Mode: RetentionGovernance, RetainUntil: soon}, Retention{Mode: RetentionCompliance, RetainUntil: soon}, Retention{Mode: RetentionCompliance, RetainUntil: soon}, nil},
+		{"compliance to governance", Retention{Mode: RetentionCompliance, RetainUntil: soon}, Retention{Mode: RetentionGovernance, RetainUntil: later}, Retention{}, ErrRetained},
+		{"shorten compliance", Retention{Mode: RetentionCompliance, RetainUntil: later}, Retention{Mode: RetentionCompliance, RetainUntil: soon}, Retention{}, ErrRetained},
+		{"extend compliance", Retention{Mode: RetentionCompliance, RetainUntil: soon}, Retention{Mode: RetentionCompliance, RetainUntil: later}, Retention{Mode: RetentionCompliance, RetainUntil: later}, nil},
+		{"replace expired compliance", Retention{Mode: RetentionCompliance, RetainUntil: past}, Retention{Mode: RetentionGovernance, RetainUntil: soon}, Retention{Mode: RetentionGovernance, RetainUntil: soon}, nil},
+		{"place legal hold", Retention{Mode: RetentionGovernance, RetainUntil: soon}, Retention{LegalHold: true}, Retention{Mode: RetentionGovernance, RetainUntil: soon, LegalHold: true}, nil},
+		{"keep legal hold", Retention{LegalHold: true}, Retention{Mode: RetentionGovernance, RetainUntil: soon}, Retention{Mode: RetentionGovernance, RetainUntil: soon, LegalHold: true}, nil},
+		{"invalid mode", Retention{}, Retention{Mode: "forever", RetainUntil: soon}, Retention{}, errAny},
+		{"missing date", Retention{}, Retention{Mode: RetentionGovernance}, Retention{}, errAny},
+		{"missing mode", Retention{}, Retention{RetainUntil: soon}, Retention{}, errAny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := extendRetention(tt.current, tt.update)
+			switch {
+			case tt.err == nil:
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if result != tt.result {
+					t.Fatalf("expected retention %+v, got %+v", tt.result, result)
+				}
+			case tt.err == errAny:
+				if err == nil {
+					t.Fatal("expected error")
+				}
+			case !errors.Is(err, tt.err):
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// errAny represents any expected error in table tests
+var errAny = errors.New("any error")
+
+// TestReleaseRetention tests that only active compliance retention is kept
+// when retention of a file is released
+func TestReleaseRetention(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	soon := now.Add(time.Hour)
+	tests := []struct {
+		name    string
+		current Retention
+		result  Retention
+	}{
+		{"no retention", Retention{}, Retention{}},
+		{"legal hold", Retention{LegalHold: true}, Retention{}},
+		{"governance", Retention{Mode: RetentionGovernance, RetainUntil: soon, LegalHold: true}, Retention{}},
+		{"compliance", Retention{Mode: RetentionCompliance, RetainUntil: soon, LegalHold: true}, Retention{Mode: RetentionCompliance, RetainUntil: soon}},
+		{"expired compliance", Retention{Mode: RetentionCompliance, RetainUntil: past}, Retention{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := releaseRetention(tt.current); result != tt.result {
+				t.Fatalf("expected retention %+v, got %+v", tt.result, result)
+			}
+		})
+	}
+}
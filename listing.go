@@ -0,0 +1,383 @@
+package main
+
+// listing module provides pagination, sorting and filtering of storage listings
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxListLimit defines maximum number of entries in single page of listing
+const maxListLimit = 10000
+
+// defaultListLimit defines number of entries in single page of listing if
+// limit is not provided
+const defaultListLimit = 1000
+
+// ListOptions represents options of storage listing
+type ListOptions struct {
+	Limit      int            // maximum number of entries to return
+	Cursor     string         // opaque cursor of next page returned by previous listing
+	Sort       string         // sort key: name, size or mtime
+	Desc       bool           // sort in descending order
+	Glob       string         // glob pattern of entry base name, e.g. *.h5
+	Regex      *regexp.Regexp // regular expression of entry name
+	Extensions []string       // file extensions, e.g. .h5, .tiff
+	Depth      int            // depth of listing, 1 lists direct entries, negative value means unlimited depth
+	MinSize    int64          // minimal size of files in bytes
+	MaxSize    int64          // maximal size of files in bytes, zero means no limit
+	After      time.Time      // entries modified at or after given time
+	Before     time.Time      // entries modified before given time
+	Type       string         // type of entries: file or dir
+	CTypes     []string       // content types of files, e.g. application/x-hdf5 or image/*
+}
+
+// listCursor represents position of last entry of listing page
+type listCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	Key  int64  `json:"k,omitempty"` // value of numeric sort key
+	Name string `json:"n"`           // name of entry, names of directories have trailing slash
+}
+
+// parseListOptions parses listing options of HTTP request, e.g.
+// ?limit=100&cursor=...&sort=mtime&order=desc&glob=*.h5&regex=scan_[0-9]+&ext=.h5,.tiff&recursive=true&depth=2
+// &min_size=1024&max_size=1048576&after=2024-01-01&before=2024-02-01T12:00:00Z&type=file&ctype=image/*
+func parseListOptions(c *gin.Context) (ListOptions, error) {
+	opts := ListOptions{Sort: "name", Depth: 1, Limit: defaultListLimit}
+	if val := c.Query("limit"); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return opts, fmt.Errorf("invalid limit '%s', it should be within [1, %d] range", val, maxListLimit)
+		}
+		opts.Limit = limit
+	}
+	opts.Cursor = c.Query("cursor")
+	if val := c.Query("sort"); val != "" {
+		switch val {
+		case "name", "size", "mtime":
+			opts.Sort = val
+		default:
+			return opts, fmt.Errorf("invalid sort key '%s', supported keys: name, size, mtime", val)
+		}
+	}
+	switch val := c.Query("order"); val {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, fmt.Errorf("invalid order '%s', supported orders: asc, desc", val)
+	}
+	if val := c.Query("glob"); val != "" {
+		if _, err := path.Match(val, ""); err != nil {
+			return opts, fmt.Errorf("invalid glob pattern '%s': %w", val, err)
+		}
+		opts.Glob = val
+	}
+	if val := c.Query("regex"); val != "" {
+		re, err := regexp.Compile(val)
+		if err != nil {
+			return opts, fmt.Errorf("invalid regex pattern '%s': %w", val, err)
+		}
+		opts.Regex = re
+	}
+	if val := c.Query("ext"); val != "" {
+		for _, ext := range strings.Split(val, ",") {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext == "" {
+				continue
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			opts.Extensions = append(opts.Extensions, ext)
+		}
+	}
+	if val := c.Query("recursive"); val != "" {
+		recursive, err := strconv.ParseBool(val)
+		if err != nil {
+			return opts, fmt.Errorf("invalid recursive value '%s'", val)
+		}
+		if recursive {
+			opts.Depth = -1
+		}
+	}
+	if val := c.Query("depth"); val != "" {
+		depth, err := strconv.Atoi(val)
+		if err != nil || depth < 1 {
+			return opts, fmt.Errorf("invalid depth '%s', it should be positive number", val)
+		}
+		opts.Depth = depth
+	}
+	for key, size := range map[string]*int64{"min_size": &opts.MinSize, "max_size": &opts.MaxSize} {
+		if val := c.Query(key); val != "" {
+			num, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || num < 1 {
+				return opts, fmt.Errorf("invalid %s '%s', it should be positive number of bytes", key, val)
+			}
+			*size = num
+		}
+	}
+	for key, tstamp := range map[string]*time.Time{"after": &opts.After, "before": &opts.Before} {
+		if val := c.Query(key); val != "" {
+			t, err := parseTime(val)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s '%s', it should be RFC3339 time or YYYY-MM-DD date", key, val)
+			}
+			*tstamp = t
+		}
+	}
+	switch val := c.Query("type"); val {
+	case "", "file", "dir":
+		opts.Type = val
+	default:
+		return opts, fmt.Errorf("invalid type '%s', supported types: file, dir", val)
+	}
+	if val := c.Query("ctype"); val != "" {
+		for _, ctype := range strings.Split(val, ",") {
+			if ctype = strings.ToLower(strings.TrimSpace(ctype)); ctype != "" {
+				opts.CTypes = append(opts.CTypes, ctype)
+			}
+		}
+	}
+	if opts.Cursor != "" {
+		if _, err := opts.decodeCursor(); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// nextPageQuery returns query of HTTP request which requests the page of
+// listing following given cursor, other listing options are kept
+func nextPageQuery(c *gin.Context, cursor string) string {
+	query := c.Request.URL.Query()
+	query.Set("cursor", cursor)
+	return "?" + query.Encode()
+}
+
+// helper function to parse time in RFC3339 or YYYY-MM-DD format
+func parseTime(val string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, val)
+}
+
+// Apply filters and sorts given entries and returns requested page of
+// entries along with the cursor of the next page, the cursor is empty if
+// there are no more entries
+func (o ListOptions) Apply(entries []Metadata) ([]Metadata, string, error) {
+	return applyListOptions(o, entries, func(entry Metadata) Metadata { return entry })
+}
+
+// listPage lists page of directory of storage backend according to listing
+// options along with the cursor of the next page and truncated flag of
+// partial listing. Listings ordered by name in ascending order are streamed
+// by backends which support it, i.e. they start after the cursor and stop
+// once the page is filled, otherwise entire directory is listed.
+func listPage(ctx context.Context, backend StorageBackend, dir string, o ListOptions) ([]Metadata, string, bool, error) {
+	lister, ok := backend.(PageLister)
+	if !ok || o.Sort != "name" || o.Desc {
+		entries, truncated, err := listContext(ctx, backend, dir, o.Depth)
+		if err != nil {
+			return nil, "", false, err
+		}
+		page, cursor, err := o.Apply(entries)
+		return page, cursor, truncated, err
+	}
+	var after string
+	if o.Cursor != "" {
+		cursor, err := o.decodeCursor()
+		if err != nil {
+			return nil, "", false, err
+		}
+		after = cursor.Name
+	}
+	var page []Metadata
+	var next string
+	truncated, err := lister.ListAfter(ctx, dir, o.Depth, after, func(entry Metadata) bool {
+		if !o.match(entry) {
+			return true
+		}
+		if o.Limit > 0 && len(page) == o.Limit {
+			// there are more entries than requested
+			next = o.encodeCursor(o.cursorOf(page[len(page)-1]))
+			return false
+		}
+		page = append(page, entry)
+		return true
+	})
+	if err != nil {
+		return nil, "", false, err
+	}
+	return page, next, truncated, nil
+}
+
+// applyListOptions filters, sorts and paginates arbitrary items according to
+// listing options, the meta function provides metadata of an item and names
+// of items should be unique
+func applyListOptions[T any](o ListOptions, items []T, meta func(T) Metadata) ([]T, string, error) {
+	var out []T
+	for _, item := range items {
+		if o.match(meta(item)) {
+			out = append(out, item)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return o.less(o.cursorOf(meta(out[i])), o.cursorOf(meta(out[j])))
+	})
+	if o.Cursor != "" {
+		cursor, err := o.decodeCursor()
+		if err != nil {
+			return nil, "", err
+		}
+		// skip entries up to and including the cursor position
+		idx := sort.Search(len(out), func(i int) bool {
+			return o.less(cursor, o.cursorOf(meta(out[i])))
+		})
+		out = out[idx:]
+	}
+	if o.Limit > 0 && len(out) > o.Limit {
+		out = out[:o.Limit]
+		return out, o.encodeCursor(o.cursorOf(meta(out[len(out)-1]))), nil
+	}
+	return out, "", nil
+}
+
+// helper function to check if entry matches filters of listing options
+func (o ListOptions) match(entry Metadata) bool {
+	base := filepath.Base(entry.Name)
+	if o.Glob != "" {
+		if ok, _ := path.Match(o.Glob, base); !ok {
+			return false
+		}
+	}
+	if o.Regex != nil && !o.Regex.MatchString(entry.Name) {
+		return false
+	}
+	if (o.Type == "file" && entry.IsDirectory) || (o.Type == "dir" && !entry.IsDirectory) {
+		return false
+	}
+	if !o.After.IsZero() && entry.ModTime.Before(o.After) {
+		return false
+	}
+	if !o.Before.IsZero() && !entry.ModTime.Before(o.Before) {
+		return false
+	}
+	if o.MinSize > 0 || o.MaxSize > 0 || len(o.CTypes) > 0 {
+		// size and content type filters apply to files only
+		if entry.IsDirectory {
+			return false
+		}
+		if entry.Size < o.MinSize || (o.MaxSize > 0 && entry.Size > o.MaxSize) {
+			return false
+		}
+		if len(o.CTypes) > 0 && !o.matchContentType(entry.ContentType) {
+			return false
+		}
+	}
+	if len(o.Extensions) > 0 {
+		if entry.IsDirectory {
+			return false
+		}
+		ext := strings.ToLower(filepath.Ext(base))
+		found := false
+		for _, e := range o.Extensions {
+			if e == ext {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// helper function to check if content type matches content types of listing
+// options, the content type pattern may have wildcard subtype, e.g. image/*
+func (o ListOptions) matchContentType(ctype string) bool {
+	if idx := strings.Index(ctype, ";"); idx > 0 {
+		ctype = ctype[:idx]
+	}
+	ctype = strings.ToLower(strings.TrimSpace(ctype))
+	for _, pat := range o.CTypes {
+		if pat == ctype {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pat, "/*"); ok && strings.HasPrefix(ctype, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function to build cursor for given entry
+func (o ListOptions) cursorOf(entry Metadata) listCursor {
+	cursor := listCursor{Sort: o.Sort, Desc: o.Desc, Name: entry.Name}
+	if entry.IsDirectory {
+		// directories are ordered along with S3 common prefixes
+		cursor.Name += "/"
+	}
+	switch o.Sort {
+	case "size":
+		cursor.Key = entry.Size
+	case "mtime":
+		cursor.Key = entry.ModTime.UnixNano()
+	}
+	return cursor
+}
+
+// helper function to compare positions of two entries according to sort
+// order, entries with equal sort keys are ordered by their names
+func (o ListOptions) less(a, b listCursor) bool {
+	if a.Key != b.Key {
+		if o.Desc {
+			return a.Key > b.Key
+		}
+		return a.Key < b.Key
+	}
+	if o.Desc {
+		return a.Name > b.Name
+	}
+	return a.Name < b.Name
+}
+
+// helper function to encode listing cursor
+func (o ListOptions) encodeCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// helper function to decode listing cursor, the cursor should be produced
+// by listing with the same sort options
+func (o ListOptions) decodeCursor() (listCursor, error) {
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil {
+		return cursor, errors.New("invalid cursor")
+	}
+	if cursor.Sort != o.Sort || cursor.Desc != o.Desc {
+		return cursor, errors.New("cursor does not match sort options of the listing")
+	}
+	return cursor, nil
+}
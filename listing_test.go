@@ -0,0 +1,129 @@
+package main
+
+// listing tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestListCursor tests encoding and decoding of listing cursor
+func TestListCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   ListOptions
+		cursor listCursor
+	}{
+		{"name", ListOptions{Sort: "name"}, listCursor{Sort: "name", Name: "dir/scan.h5"}},
+		{"directory", ListOptions{Sort: "name"}, listCursor{Sort: "name", Name: "dir/"}},
+		{"name desc", ListOptions{Sort: "name", Desc: true}, listCursor{Sort: "name", Desc: true, Name: "scan.h5"}},
+		{"size", ListOptions{Sort: "size"}, listCursor{Sort: "size", Key: 1024, Name: "scan.h5"}},
+		{"mtime desc", ListOptions{Sort: "mtime", Desc: true}, listCursor{Sort: "mtime", Desc: true, Key: time.Now().UnixNano(), Name: "scan.h5"}},
+		{"unicode", ListOptions{Sort: "name"}, listCursor{Sort: "name", Name: "données/скан.h5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Cursor = opts.encodeCursor(tt.cursor)
+			cursor, err := opts.decodeCursor()
+			if err != nil {
+				t.Fatalf("unable to decode cursor %s: %v", opts.Cursor, err)
+			}
+			if cursor != tt.cursor {
+				t.Fatalf("expected cursor %+v, got %+v", tt.cursor, cursor)
+			}
+		})
+	}
+}
+
+// TestListCursorInvalid tests rejection of invalid cursors
+func TestListCursorInvalid(t *testing.T) {
+	name := ListOptions{Sort: "name"}
+	tests := []struct {
+		name   string
+		opts   ListOptions
+		cursor string
+	}{
+		{"not base64", name, "not a cursor!"},
+		{"not json", name, "bm90IGpzb24"},
+		{"other sort key", ListOptions{Sort: "size"}, name.encodeCursor(listCursor{Sort: "name", Name: "a"})},
+		{"other order", ListOptions{Sort: "name", Desc: true}, name.encodeCursor(listCursor{Sort: "name", Name: "a"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Cursor = tt.cursor
+			if _, err := opts.decodeCursor(); err == nil {
+				t.Fatalf("cursor %s should be rejected", tt.cursor)
+			}
+		})
+	}
+}
+
+// TestListPages tests that pages of listing provide all entries exactly once
+func TestListPages(t *testing.T) {
+	now := time.Now()
+	var entries []Metadata
+	for i := 0; i < 25; i++ {
+		entries = append(entries, Metadata{
+			Name:        fmt.Sprintf("scan_%02d.h5", i),
+			Size:        int64(i % 4), // duplicate sort keys are ordered by names
+			ModTime:     now.Add(time.Duration(i%3) * time.Second),
+			IsDirectory: i%5 == 0,
+		})
+	}
+	for _, opts := range []ListOptions{
+		{Sort: "name", Limit: 7},
+		{Sort: "name", Desc: true, Limit: 7},
+		{Sort: "size", Limit: 4},
+		{Sort: "mtime", Desc: true, Limit: 10},
+	} {
+		t.Run(fmt.Sprintf("%s desc=%v", opts.Sort, opts.Desc), func(t *testing.T) {
+			seen := make(map[string]bool)
+			for page := 0; ; page++ {
+				if page > len(entries) {
+					t.Fatal("listing does not terminate")
+				}
+				data, cursor, err := opts.Apply(entries)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, entry := range data {
+					if seen[entry.Name] {
+						t.Fatalf("entry %s is listed twice", entry.Name)
+					}
+					seen[entry.Name] = true
+				}
+				if cursor == "" {
+					break
+				}
+				opts.Cursor = cursor
+			}
+			if len(seen) != len(entries) {
+				t.Fatalf("expected %d entries, got %d", len(entries), len(seen))
+			}
+		})
+	}
+}
+
+// TestNextPageQuery tests that query of next page keeps listing options
+func TestNextPageQuery(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/dm?did=/beamline=3a&limit=10&cursor=old", nil)
+	query, err := url.ParseQuery(strings.TrimPrefix(nextPageQuery(c, "next"), "?"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := url.Values{"did": {"/beamline=3a"}, "limit": {"10"}, "cursor": {"next"}}
+	if query.Encode() != expect.Encode() {
+		t.Fatalf("expected query %s, got %s", expect.Encode(), query.Encode())
+	}
+}
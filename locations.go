@@ -0,0 +1,123 @@
+package main
+
+// locations module provides data locations of DIDs
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	srvConfig "github.com/CHESSComputing/golib/config"
+	"github.com/gin-gonic/gin"
+)
+
+// DataLocation represents data location of a DID
+type DataLocation struct {
+	Attribute string    `json:"attribute"` // meta-data record attribute of data location
+	Path      string    `json:"path"`
+	Exists    bool      `json:"exists"`
+	IsDir     bool      `json:"is_dir"`
+	Size      int64     `json:"size"`  // size of file or total size of files in directory
+	Files     int64     `json:"files"` // number of files in data location
+	ModTime   time.Time `json:"mod_time"`
+	Truncated bool      `json:"truncated,omitempty"` // size of directory is partial due to walk limits
+}
+
+// locationAttributes returns list of meta-data record attributes to lookup
+// data locations, by default it is DataLocationAttributes of configuration
+// but HTTP request may provide concrete attribute via attr parameter. The
+// attribute should be one of DataLocationAttributes since its value is used
+// as root of accessible files.
+func locationAttributes(c *gin.Context) ([]string, bool) {
+	attrs := srvConfig.Config.CHESSMetaData.DataLocationAttributes
+	attr := c.Query("attr")
+	if attr == "" {
+		return attrs, true
+	}
+	if !slices.Contains(attrs, attr) {
+		msg := fmt.Sprintf("invalid attr '%s', it should be one of %v", attr, attrs)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": msg})
+		return nil, false
+	}
+	return []string{attr}, true
+}
+
+// dataLocations returns data locations of meta-data record for given list
+// of attributes, attributes may have string or list of strings values and
+// values of other types are ignored
+func dataLocations(meta map[string]any, attrs []string) []DataLocation {
+	var locations []DataLocation
+	seen := make(map[string]bool)
+	add := func(attr string, val any) {
+		path, ok := val.(string)
+		if !ok || path == "" || seen[attr+path] {
+			return
+		}
+		seen[attr+path] = true
+		locations = append(locations, DataLocation{Attribute: attr, Path: path})
+	}
+	for _, attr := range attrs {
+		switch val := meta[attr].(type) {
+		case []string:
+			for _, v := range val {
+				add(attr, v)
+			}
+		case []any:
+			for _, v := range val {
+				add(attr, v)
+			}
+		default:
+			add(attr, val)
+		}
+	}
+	return locations
+}
+
+// Stat fills existence, type, size and modification time of data location,
+// the total size of files in directory is computed only if it is requested
+func (l *DataLocation) Stat(ctx context.Context, dirSize bool) {
+	info, err := os.Stat(l.Path)
+	if err != nil {
+		return
+	}
+	l.Exists = true
+	l.IsDir = info.IsDir()
+	l.ModTime = info.ModTime()
+	if !l.IsDir {
+		l.Size = info.Size()
+		l.Files = 1
+		return
+	}
+	if !dirSize {
+		return
+	}
+	if fileCatalog != nil {
+		if entries, truncated, err := fileCatalog.List(ctx, l.Path, "", -1); err == nil {
+			for _, entry := range entries {
+				if !entry.IsDirectory {
+					l.Size += entry.Size
+					l.Files++
+				}
+			}
+			l.Truncated = truncated
+			return
+		}
+	}
+	truncated, err := walkDir(ctx, l.Path, -1, func(path, rel string, entry fs.DirEntry) error {
+		if entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			l.Size += info.Size()
+			l.Files++
+		}
+		return nil
+	})
+	l.Truncated = truncated || err != nil
+}
@@ -25,6 +25,15 @@ func main() {
 	flag.Parse()
 	if version {
 		fmt.Println("server version:", srvConfig.Info())
+		// show storage configuration if service configuration is available
+		if config != "" {
+			if cobj, err := srvConfig.ParseConfig(config); err == nil {
+				srvConfig.Config = &cobj
+				if err := parseConfig(); err == nil {
+					fmt.Println(storageInfo())
+				}
+			}
+		}
 		return
 	}
 	if cobj, err := srvConfig.ParseConfig(config); err == nil {
@@ -32,6 +41,9 @@ func main() {
 	} else {
 		log.Fatal(fmt.Sprintf("Unable to parse config='%s'\nerror: %v", config, err))
 	}
+	if err := parseConfig(); err != nil {
+		log.Fatal(fmt.Sprintf("Unable to parse DataManagement config='%s'\nerror: %v", config, err))
+	}
 	if srvConfig.Config.DataManagement.WebServer.Verbose > 0 {
 		log.SetFlags(log.Llongfile)
 	}
@@ -0,0 +1,329 @@
+package main
+
+// metadata module provides access to meta-data records of DIDs
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	services "github.com/CHESSComputing/golib/services"
+)
+
+// meta-data lookup errors
+var (
+	ErrInvalidDID          = errors.New("invalid did")
+	ErrRecordNotFound      = errors.New("metadata record not found")
+	ErrMetaDataUnavailable = errors.New("metadata service is unavailable")
+	ErrMetaDataTimeout     = errors.New("metadata service timeout")
+)
+
+// maxDIDCandidates defines maximum number of records to lookup for a DID,
+// it allows to report candidates of ambiguous DID
+const maxDIDCandidates = 10
+
+// AmbiguousDIDError represents error of DID which matches multiple meta-data records
+type AmbiguousDIDError struct {
+	DID        string   // requested DID
+	Candidates []string // DIDs of matched meta-data records
+}
+
+// Error implements error interface
+func (e *AmbiguousDIDError) Error() string {
+	return fmt.Sprintf("ambiguous did '%s', it matches %d metadata records", e.DID, len(e.Candidates))
+}
+
+// didPartPattern represents single key=value part of FOXDEN DID
+var didPartPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*=[^/"\\\x00-\x1f]+$`)
+
+// didRequiredKeys defines keys which should be present in FOXDEN DID
+var didRequiredKeys = []string{"beamline", "btr", "cycle"}
+
+// validateDID checks that given DID follows FOXDEN DID grammar, e.g.
+// /beamline=3a/btr=123/cycle=2024-3/sample_name=bla
+func validateDID(did string) error {
+	if !strings.HasPrefix(did, "/") {
+		return fmt.Errorf("%w '%s': it should start with '/'", ErrInvalidDID, did)
+	}
+	keys := make(map[string]bool)
+	for _, part := range strings.Split(did[1:], "/") {
+		if !didPartPattern.MatchString(part) {
+			return fmt.Errorf("%w '%s': malformed part '%s', it should be key=value", ErrInvalidDID, did, part)
+		}
+		key := part[:strings.Index(part, "=")]
+		if keys[key] {
+			return fmt.Errorf("%w '%s': duplicate key '%s'", ErrInvalidDID, did, key)
+		}
+		keys[key] = true
+	}
+	for _, key := range didRequiredKeys {
+		if !keys[key] {
+			return fmt.Errorf("%w '%s': missing '%s' part", ErrInvalidDID, did, key)
+		}
+	}
+	if !keys["sample"] && !keys["sample_name"] {
+		return fmt.Errorf("%w '%s': missing 'sample_name' part", ErrInvalidDID, did)
+	}
+	return nil
+}
+
+// MetaDataClient represents client of meta-data records
+type MetaDataClient interface {
+	Records(did string) ([]map[string]any, error) // meta-data records of given DID
+}
+
+// metaDataClient represents meta-data client used by the service
+var metaDataClient MetaDataClient = &ServiceMetaDataClient{}
+
+// ServiceMetaDataClient provides access to meta-data records of FOXDEN
+// MetaData service
+type ServiceMetaDataClient struct {
+	Timeout time.Duration // timeout of MetaData service requests, zero means no timeout
+}
+
+// metaDataResult represents result of MetaData service request
+type metaDataResult struct {
+	records []map[string]any
+	err     error
+}
+
+// Records implements MetaDataClient interface
+func (s *ServiceMetaDataClient) Records(did string) ([]map[string]any, error) {
+	if s.Timeout <= 0 {
+		return s.records(did)
+	}
+	// services.MetaDataRecords does not support cancellation therefore we
+	// stop waiting for its result once timeout is reached
+	ch := make(chan metaDataResult, 1)
+	go func() {
+		records, err := s.records(did)
+		ch <- metaDataResult{records: records, err: err}
+	}()
+	select {
+	case res := <-ch:
+		return res.records, res.err
+	case <-time.After(s.Timeout):
+		return nil, fmt.Errorf("[DataManagement.main.ServiceMetaDataClient.Records] %w after %v", ErrMetaDataTimeout, s.Timeout)
+	}
+}
+
+// helper function to fetch records of given DID from MetaData service
+func (s *ServiceMetaDataClient) records(did string) ([]map[string]any, error) {
+	// build query as structured value to properly escape DID
+	data, err := json.Marshal(map[string]any{"did": did})
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.ServiceMetaDataClient.Records] json.Marshal error: %w", err)
+	}
+	query := string(data)
+	var skeys []string
+	var sorder, idx int
+	limit := maxDIDCandidates
+	records, err := services.MetaDataRecords(query, skeys, sorder, idx, limit)
+	if err != nil {
+		var nerr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &nerr) && nerr.Timeout()) {
+			return nil, fmt.Errorf("[DataManagement.main.ServiceMetaDataClient.Records] %w: %w", ErrMetaDataTimeout, err)
+		}
+		return nil, fmt.Errorf("[DataManagement.main.ServiceMetaDataClient.Records] %w: %w", ErrMetaDataUnavailable, err)
+	}
+	return records, nil
+}
+
+// LocalMetaDataClient provides in-memory meta-data records which can be
+// loaded from JSON file, it allows to run the service without MetaData service
+type LocalMetaDataClient struct {
+	mu      sync.RWMutex
+	records map[string][]map[string]any
+}
+
+// NewLocalMetaDataClient creates new local meta-data client, if file name is
+// provided the records are loaded from JSON file with list of records
+func NewLocalMetaDataClient(fname string) (*LocalMetaDataClient, error) {
+	client := &LocalMetaDataClient{records: make(map[string][]map[string]any)}
+	if fname == "" {
+		return client, nil
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewLocalMetaDataClient] os.ReadFile error: %w", err)
+	}
+	var records []map[string]any
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewLocalMetaDataClient] json.Unmarshal error: %w", err)
+	}
+	for _, rec := range records {
+		client.Add(rec)
+	}
+	return client, nil
+}
+
+// Add adds meta-data record to the client, records without DID are ignored
+func (l *LocalMetaDataClient) Add(rec map[string]any) {
+	did, ok := rec["did"].(string)
+	if !ok || did == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records[did] = append(l.records[did], rec)
+}
+
+// Records implements MetaDataClient interface
+func (l *LocalMetaDataClient) Records(did string) ([]map[string]any, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.records[did], nil
+}
+
+// metaCacheEntry represents cached meta-data records of DID
+type metaCacheEntry struct {
+	did     string
+	records []map[string]any
+	expire  time.Time
+}
+
+// metaCall represents in-flight lookup of DID records
+type metaCall struct {
+	wg      sync.WaitGroup
+	records []map[string]any
+	err     error
+}
+
+// MetaDataCache provides TTL and LRU cache of meta-data records on top of
+// meta-data client. Concurrent lookups of the same DID are de-duplicated,
+// i.e. only one request is sent to underlying client.
+type MetaDataCache struct {
+	Client MetaDataClient // underlying meta-data client
+	TTL    time.Duration  // time to keep records in the cache
+	Size   int            // maximum number of cached DIDs
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	calls   map[string]*metaCall
+}
+
+// NewMetaDataCache creates new cache of meta-data records
+func NewMetaDataCache(client MetaDataClient, ttl time.Duration, size int) *MetaDataCache {
+	return &MetaDataCache{
+		Client:  client,
+		TTL:     ttl,
+		Size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		calls:   make(map[string]*metaCall),
+	}
+}
+
+// Records implements MetaDataClient interface
+func (m *MetaDataCache) Records(did string) ([]map[string]any, error) {
+	m.mu.Lock()
+	if elem, ok := m.entries[did]; ok {
+		entry := elem.Value.(*metaCacheEntry)
+		if time.Now().Before(entry.expire) {
+			m.lru.MoveToFront(elem)
+			m.mu.Unlock()
+			return entry.records, nil
+		}
+		m.remove(elem)
+	}
+	if call, ok := m.calls[did]; ok {
+		// another lookup of the same DID is in progress, wait for its result
+		m.mu.Unlock()
+		call.wg.Wait()
+		return call.records, call.err
+	}
+	call := &metaCall{}
+	call.wg.Add(1)
+	m.calls[did] = call
+	m.mu.Unlock()
+
+	call.records, call.err = m.Client.Records(did)
+
+	m.mu.Lock()
+	delete(m.calls, did)
+	// we do not cache failed lookups and DIDs without records since they may
+	// appear in MetaData service later
+	if call.err == nil && len(call.records) > 0 {
+		m.add(did, call.records)
+	}
+	m.mu.Unlock()
+	call.wg.Done()
+	return call.records, call.err
+}
+
+// Invalidate removes records of given DID from the cache
+func (m *MetaDataCache) Invalidate(did string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.entries[did]; ok {
+		m.remove(elem)
+	}
+}
+
+// Purge removes all records from the cache
+func (m *MetaDataCache) Purge() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]*list.Element)
+	m.lru.Init()
+}
+
+// Len returns number of cached DIDs
+func (m *MetaDataCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+// helper function to add records to the cache, it should be called with
+// acquired lock
+func (m *MetaDataCache) add(did string, records []map[string]any) {
+	entry := &metaCacheEntry{did: did, records: records, expire: time.Now().Add(m.TTL)}
+	if elem, ok := m.entries[did]; ok {
+		elem.Value = entry
+		m.lru.MoveToFront(elem)
+		return
+	}
+	m.entries[did] = m.lru.PushFront(entry)
+	for m.Size > 0 && m.lru.Len() > m.Size {
+		m.remove(m.lru.Back())
+	}
+}
+
+// helper function to remove cache element, it should be called with
+// acquired lock
+func (m *MetaDataCache) remove(elem *list.Element) {
+	entry := m.lru.Remove(elem).(*metaCacheEntry)
+	delete(m.entries, entry.did)
+}
+
+// initMetaDataClient initializes meta-data client of the service according
+// to configuration
+func initMetaDataClient() error {
+	timeout := time.Duration(dmConfig.MetaData.Timeout) * time.Second
+	var client MetaDataClient = &ServiceMetaDataClient{Timeout: timeout}
+	if dmConfig.MetaData.File != "" {
+		local, err := NewLocalMetaDataClient(dmConfig.MetaData.File)
+		if err != nil {
+			return err
+		}
+		client = local
+	}
+	ttl := time.Duration(dmConfig.MetaData.CacheTTL) * time.Second
+	if ttl > 0 {
+		client = NewMetaDataCache(client, ttl, dmConfig.MetaData.CacheSize)
+	}
+	metaDataClient = client
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+// metadata tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingMetaDataClient counts lookups of DIDs, the lookups wait for
+// release channel if it is set
+type countingMetaDataClient struct {
+	calls   atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+// Records implements MetaDataClient interface
+func (c *countingMetaDataClient) Records(did string) ([]map[string]any, error) {
+	c.calls.Add(1)
+	if c.release != nil {
+		<-c.release
+	}
+	if c.err != nil || did == "/unknown" {
+		return nil, c.err
+	}
+	return []map[string]any{{"did": did}}, nil
+}
+
+// TestMetaDataCache tests that records are cached until they expire or are
+// invalidated
+func TestMetaDataCache(t *testing.T) {
+	client := &countingMetaDataClient{}
+	cache := NewMetaDataCache(client, time.Hour, 0)
+	for i := 0; i < 3; i++ {
+		records, err := cache.Records("/a")
+		if err != nil || len(records) != 1 || records[0]["did"] != "/a" {
+			t.Fatalf("unexpected records %v, error %v", records, err)
+		}
+	}
+	if calls := client.calls.Load(); calls != 1 {
+		t.Fatalf("expected single lookup, got %d", calls)
+	}
+	cache.Invalidate("/a")
+	cache.Records("/a")
+	if calls := client.calls.Load(); calls != 2 {
+		t.Fatalf("expected lookup of invalidated DID, got %d lookups", calls)
+	}
+
+	// expired records are looked up again
+	cache.TTL = -time.Second
+	cache.Records("/b")
+	cache.Records("/b")
+	if calls := client.calls.Load(); calls != 4 {
+		t.Fatalf("expected lookups of expired DID, got %d lookups", calls)
+	}
+}
+
+// TestMetaDataCacheMisses tests that failed lookups and DIDs without records
+// are not cached
+func TestMetaDataCacheMisses(t *testing.T) {
+	client := &countingMetaDataClient{}
+	cache := NewMetaDataCache(client, time.Hour, 0)
+	cache.Records("/unknown")
+	cache.Records("/unknown")
+	client.err = ErrMetaDataUnavailable
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Records("/a"); !errors.Is(err, ErrMetaDataUnavailable) {
+			t.Fatalf("expected error %v, got %v", ErrMetaDataUnavailable, err)
+		}
+	}
+	if calls := client.calls.Load(); calls != 4 {
+		t.Fatalf("expected 4 lookups, got %d", calls)
+	}
+	if size := cache.Len(); size != 0 {
+		t.Fatalf("expected empty cache, got %d entries", size)
+	}
+}
+
+// TestMetaDataCacheEviction tests that least recently used DIDs are evicted
+// from the cache
+func TestMetaDataCacheEviction(t *testing.T) {
+	client := &countingMetaDataClient{}
+	cache := NewMetaDataCache(client, time.Hour, 2)
+	cache.Records("/a")
+	cache.Records("/b")
+	cache.Records("/a") // /b becomes least recently used
+	cache.Records("/c")
+	if size := cache.Len(); size != 2 {
+		t.Fatalf("expected 2 cached DIDs, got %d", size)
+	}
+	calls := client.calls.Load()
+	cache.Records("/a")
+	cache.Records("/c")
+	if client.calls.Load() != calls {
+		t.Fatal("expected cached /a and /c DIDs")
+	}
+	cache.Records("/b")
+	if client.calls.Load() != calls+1 {
+		t.Fatal("expected evicted /b DID")
+	}
+	cache.Purge()
+	if size := cache.Len(); size != 0 {
+		t.Fatalf("expected empty cache, got %d entries", size)
+	}
+}
+
+// TestMetaDataCacheConcurrentLookups tests that concurrent lookups of the
+// same DID are sent once to underlying client
+func TestMetaDataCacheConcurrentLookups(t *testing.T) {
+	client := &countingMetaDataClient{release: make(chan struct{})}
+	cache := NewMetaDataCache(client, time.Hour, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if records, err := cache.Records("/a"); err != nil || len(records) != 1 {
+				t.Errorf("unexpected records %v, error %v", records, err)
+			}
+		}()
+	}
+	// wait for the first lookup before it is released
+	for client.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+	if calls := client.calls.Load(); calls != 1 {
+		t.Fatalf("expected single lookup, got %d", calls)
+	}
+}
+
+// TestValidateDID tests FOXDEN DID grammar
+func TestValidateDID(t *testing.T) {
+	tests := []struct {
+		name  string
+		did   string
+		valid bool
+	}{
+		{"valid", "/beamline=3a/btr=123/cycle=2024-3/sample_name=bla", true},
+		{"sample key", "/beamline=3a/btr=123/cycle=2024-3/sample=bla", true},
+		{"extra parts", "/beamline=3a/btr=123/cycle=2024-3/sample_name=bla/user=x_1", true},
+		{"value with spaces", "/beamline=3a/btr=123/cycle=2024-3/sample_name=my sample", true},
+		{"empty", "", false},
+		{"missing leading slash", "beamline=3a/btr=123/cycle=2024-3/sample_name=bla", false},
+		{"trailing slash", "/beamline=3a/btr=123/cycle=2024-3/sample_name=bla/", false},
+		{"missing value", "/beamline=/btr=123/cycle=2024-3/sample_name=bla", false},
+		{"missing key", "/=3a/btr=123/cycle=2024-3/sample_name=bla", false},
+		{"upper case key", "/Beamline=3a/btr=123/cycle=2024-3/sample_name=bla", false},
+		{"duplicate key", "/beamline=3a/beamline=3b/btr=123/cycle=2024-3/sample_name=bla", false},
+		{"missing required key", "/beamline=3a/cycle=2024-3/sample_name=bla", false},
+		{"missing sample", "/beamline=3a/btr=123/cycle=2024-3", false},
+		{"quote in value", `/beamline=3a/btr=123/cycle=2024-3/sample_name=a"}`, false},
+		{"backslash in value", `/beamline=3a/btr=123/cycle=2024-3/sample_name=a\`, false},
+		{"control character", "/beamline=3a/btr=123/cycle=2024-3/sample_name=a\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDID(tt.did)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidDID) {
+				t.Fatalf("expected error %v, got %v", ErrInvalidDID, err)
+			}
+		})
+	}
+}
+
+// TestFindMetaDataRecordInvalidDID tests that malformed DIDs are rejected
+// before meta-data records are looked up
+func TestFindMetaDataRecordInvalidDID(t *testing.T) {
+	defer func(client MetaDataClient) { metaDataClient = client }(metaDataClient)
+	client := &countingMetaDataClient{}
+	metaDataClient = client
+	if _, err := findMetaDataRecord(`/beamline=3a"}, {"did": "/x`); !errors.Is(err, ErrInvalidDID) {
+		t.Fatalf("expected error %v, got %v", ErrInvalidDID, err)
+	}
+	if calls := client.calls.Load(); calls != 0 {
+		t.Fatalf("expected no lookups, got %d", calls)
+	}
+	did := "/beamline=3a/btr=123/cycle=2024-3/sample_name=bla"
+	rec, err := findMetaDataRecord(did)
+	if err != nil || rec["did"] != did {
+		t.Fatalf("unexpected record %v, error %v", rec, err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+// mimetypes module provides detection of content type of stored files
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"bytes"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// content types of scientific data formats
+const (
+	ContentTypeHDF5  = "application/x-hdf5"
+	ContentTypeNeXus = "application/x-nexus"
+	ContentTypeCBF   = "application/x-cbf"
+	ContentTypeEDF   = "application/x-edf"
+	ContentTypeMCS   = "application/x-mcs"
+	ContentTypeTIFF  = "image/tiff"
+	ContentTypeOctet = "application/octet-stream"
+)
+
+// sniffSize defines number of leading bytes of the content used to detect
+// its type
+const sniffSize = 3072
+
+// contentTypes defines content types of file extensions which are not known
+// to mime package
+var contentTypes = map[string]string{
+	".h5":   ContentTypeHDF5,
+	".hdf5": ContentTypeHDF5,
+	".hdf":  ContentTypeHDF5,
+	".nxs":  ContentTypeNeXus,
+	".nx5":  ContentTypeNeXus,
+	".cbf":  ContentTypeCBF,
+	".edf":  ContentTypeEDF,
+	".mcs":  ContentTypeMCS,
+	".tif":  ContentTypeTIFF,
+	".tiff": ContentTypeTIFF,
+}
+
+// hdf5Signature represents signature of HDF5 file, it is located at offset 0
+// or at offset 512, 1024, 2048, etc. if file contains user block
+var hdf5Signature = []byte("\x89HDF\r\n\x1a\n")
+
+// helper function to detect HDF5 content
+func hdf5Detector(raw []byte, limit uint32) bool {
+	for offset := 0; offset+len(hdf5Signature) <= len(raw); offset = nextHDF5Offset(offset) {
+		if bytes.Equal(raw[offset:offset+len(hdf5Signature)], hdf5Signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function to return next possible offset of HDF5 signature
+func nextHDF5Offset(offset int) int {
+	if offset == 0 {
+		return 512
+	}
+	return offset * 2
+}
+
+// helper function to detect CBF (Crystallographic Binary File) content
+func cbfDetector(raw []byte, limit uint32) bool {
+	return bytes.HasPrefix(raw, []byte("###CBF:"))
+}
+
+// helper function to detect EDF (ESRF Data Format) content, EDF file starts
+// with ASCII header enclosed in curly braces
+func edfDetector(raw []byte, limit uint32) bool {
+	if !bytes.HasPrefix(raw, []byte("{")) {
+		return false
+	}
+	header := raw
+	if idx := bytes.IndexByte(raw, '}'); idx > 0 {
+		header = raw[:idx]
+	}
+	return bytes.Contains(header, []byte("HeaderID")) || bytes.Contains(header, []byte("EDF_"))
+}
+
+func init() {
+	root := mimetype.Lookup(ContentTypeOctet)
+	root.Extend(hdf5Detector, ContentTypeHDF5, ".h5")
+	root.Extend(cbfDetector, ContentTypeCBF, ".cbf")
+	root.Extend(edfDetector, ContentTypeEDF, ".edf")
+}
+
+// contentTypeByExtension returns content type of given file name based on
+// its extension, it returns application/octet-stream for unknown extensions
+func contentTypeByExtension(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ctype, ok := contentTypes[ext]; ok {
+		return ctype
+	}
+	if ctype := mime.TypeByExtension(ext); ctype != "" {
+		return ctype
+	}
+	return ContentTypeOctet
+}
+
+// detectContentType detects content type of the file. The content type
+// provided by the client (e.g. via multipart part header) takes precedence,
+// then the type is detected from given leading bytes of the content and
+// finally from file extension.
+func detectContentType(ctype, name string, head []byte) string {
+	if ctype != "" {
+		if mtype, _, err := mime.ParseMediaType(ctype); err == nil && mtype != ContentTypeOctet {
+			return ctype
+		}
+	}
+	byExt := contentTypeByExtension(name)
+	if len(head) > 0 {
+		detected := mimetype.Detect(head)
+		switch {
+		case detected.Is(ContentTypeHDF5):
+			// NeXus files are HDF5 files which are recognized by their extension
+			if byExt == ContentTypeNeXus {
+				return ContentTypeNeXus
+			}
+			return ContentTypeHDF5
+		case detected.Is(ContentTypeOctet), detected.Is("text/plain"):
+			// generic type, the extension is more specific
+			if byExt != ContentTypeOctet {
+				return byExt
+			}
+		}
+		return detected.String()
+	}
+	return byExt
+}
+
+// headWriter keeps leading bytes of written content which are used to
+// detect its content type
+type headWriter struct {
+	head []byte
+}
+
+// Write implements io.Writer interface
+func (w *headWriter) Write(p []byte) (int, error) {
+	if n := sniffSize - len(w.head); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		w.head = append(w.head, p[:n]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,134 @@
+package main
+
+// presign module provides time-limited presigned URLs of files of storage
+// areas. S3 URLs are presigned by S3 backend, i.e. the content is transferred
+// directly between the client and S3 storage, while URLs of other storage
+// backends are served by DataManagement service and signed with HMAC secret.
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errors of signed URLs
+var (
+	ErrSignatureInvalid = errors.New("invalid signature of URL")
+	ErrSignatureExpired = errors.New("signed URL is expired")
+)
+
+// presignSecret represents HMAC secret of signed URLs
+var presignSecret []byte
+
+// PresignedURL represents presigned URL of a file
+type PresignedURL struct {
+	URL     string    `json:"url"`
+	Method  string    `json:"method"` // HTTP method of the URL, GET or PUT
+	Expires time.Time `json:"expires"`
+	Direct  bool      `json:"direct"` // URL refers directly to storage backend, e.g. S3
+}
+
+// initPresign initializes HMAC secret of signed URLs
+func initPresign() error {
+	if val := dmConfig.Presign.URL; val != "" {
+		if purl, err := url.Parse(val); err != nil || (purl.Scheme != "http" && purl.Scheme != "https") || purl.Host == "" {
+			return fmt.Errorf("[DataManagement.main.initPresign] invalid Presign.URL '%s', it should be absolute http(s) URL", val)
+		}
+	} else {
+		log.Println("WARNING: Presign.URL is not configured, signed URLs refer to localhost")
+	}
+	if dmConfig.Presign.Secret != "" {
+		presignSecret = []byte(dmConfig.Presign.Secret)
+		return nil
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("[DataManagement.main.initPresign] rand.Read error: %w", err)
+	}
+	presignSecret = secret
+	log.Println("WARNING: Presign.Secret is not configured, signed URLs will not be valid after restart of the service")
+	return nil
+}
+
+// urlSignature computes HMAC signature of signed URL
+func urlSignature(method, area, dir, file string, expires int64) string {
+	mac := hmac.New(sha256.New, presignSecret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%d", method, area, dir, file, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// presignExpires returns expiration time of presigned URL for given number
+// of seconds, the default and maximum expiration times are configurable
+func presignExpires(val string) (time.Duration, error) {
+	seconds := dmConfig.Presign.Expires
+	if val != "" {
+		var err error
+		seconds, err = strconv.Atoi(val)
+		if err != nil || seconds <= 0 {
+			return 0, fmt.Errorf("invalid expires value '%s', it should be positive number of seconds", val)
+		}
+	}
+	if seconds > dmConfig.Presign.MaxExpires {
+		return 0, fmt.Errorf("expires value %d exceeds maximum of %d seconds", seconds, dmConfig.Presign.MaxExpires)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// presign issues presigned URL of a file of storage area for given HTTP
+// method (GET or PUT), the baseURL is public URL of DataManagement service
+func presign(baseURL, method string, area *StorageArea, dir, file string, expires time.Duration) (PresignedURL, error) {
+	expireAt := time.Now().Add(expires).Truncate(time.Second)
+	purl := PresignedURL{Method: method, Expires: expireAt}
+	if method != http.MethodGet && method != http.MethodPut {
+		return purl, fmt.Errorf("%w: presigned URL of %s method", ErrNotSupported, method)
+	}
+	if method == http.MethodPut && !slices.Contains(area.Backend.Capabilities(), "write") {
+		return purl, fmt.Errorf("%w: %s", ErrReadOnly, area.Name)
+	}
+	if presigner, ok := area.Backend.(Presigner); ok {
+		u, err := presigner.Presign(method, dir, file, expires)
+		if err != nil {
+			return purl, fmt.Errorf("[DataManagement.main.presign] Presign error: %w", err)
+		}
+		purl.URL = u
+		purl.Direct = true
+		return purl, nil
+	}
+	if len(presignSecret) == 0 {
+		return purl, errors.New("[DataManagement.main.presign] HMAC secret of signed URLs is not initialized")
+	}
+	params := url.Values{}
+	params.Set("expires", strconv.FormatInt(expireAt.Unix(), 10))
+	params.Set("signature", urlSignature(method, area.Name, dir, file, expireAt.Unix()))
+	purl.URL = fmt.Sprintf("%s/signed/%s/%s/%s?%s", strings.TrimSuffix(baseURL, "/"),
+		url.PathEscape(area.Name), url.PathEscape(dir), url.PathEscape(file), params.Encode())
+	return purl, nil
+}
+
+// verifySignedURL verifies signature and expiration time of signed URL
+func verifySignedURL(method, area, dir, file, expires, signature string) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid expires parameter", ErrSignatureInvalid)
+	}
+	expected := urlSignature(method, area, dir, file, exp)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return ErrSignatureInvalid
+	}
+	if time.Now().Unix() > exp {
+		return ErrSignatureExpired
+	}
+	return nil
+}
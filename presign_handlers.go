@@ -0,0 +1,119 @@
+package main
+
+// presign handlers module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	srvConfig "github.com/CHESSComputing/golib/config"
+	"github.com/gin-gonic/gin"
+)
+
+// helper function to provide public URL of DataManagement service, the URL
+// is never derived from request headers since they are controlled by clients
+func serviceURL() string {
+	if dmConfig.Presign.URL != "" {
+		return strings.TrimSuffix(dmConfig.Presign.URL, "/")
+	}
+	webServer := srvConfig.Config.DataManagement.WebServer
+	return fmt.Sprintf("http://localhost:%d%s", webServer.Port, webServer.Base)
+}
+
+// PresignHandler provides access to GET and POST /presign/:area/:dir/:file
+// end-points which issue presigned download (GET) and upload (PUT) URLs,
+// respectively. The download URLs require read scope while upload URLs
+// require write scope.
+/*
+```
+# get download URL of the file (S3 object) valid for 1 hour
+curl "http://localhost:8340/presign/raw/dir/scan.h5?expires=3600"
+# get upload URL of the file (S3 object) and upload the file
+curl -X POST http://localhost:8340/presign/raw/dir/scan.h5
+curl -X PUT -T scan.h5 "<url>"
+```
+*/
+func PresignHandler(c *gin.Context) {
+	var params FileStorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	area, err := storageArea(params.Area)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	expires, err := presignExpires(c.Query("expires"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	method := http.MethodGet
+	if c.Request.Method == http.MethodPost {
+		method = http.MethodPut
+	}
+	purl, err := presign(serviceURL(), method, area, params.Dir, params.File, expires)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": purl})
+}
+
+// SignedHandler provides access to GET and PUT /signed/:area/:dir/:file
+// end-points which serve signed URLs issued by PresignHandler, the requests
+// are authorized by signature of the URL
+/*
+```
+curl -o scan.h5 "http://localhost:8340/signed/raw/dir/scan.h5?expires=<expires>&signature=<signature>"
+curl -X PUT -T scan.h5 "http://localhost:8340/signed/raw/dir/scan.h5?expires=<expires>&signature=<signature>"
+```
+*/
+func SignedHandler(c *gin.Context) {
+	var params FileStorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	err := verifySignedURL(c.Request.Method, params.Area, params.Dir, params.File, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusForbidden), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	storage, ok := areaBackend(c)
+	if !ok {
+		return
+	}
+	if c.Request.Method == http.MethodGet {
+		reader, meta, err := storage.Open(params.Dir, params.File)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+		defer reader.Close()
+		serveContent(c, params.File, meta, reader)
+		return
+	}
+	expect, err := expectedChecksums(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if !retentionGuard(c, params.Area, params.Dir, params.File) {
+		return
+	}
+	meta, err := storage.Upload(params.Dir, params.File, c.ContentType(), c.Request.Body, c.Request.ContentLength, expect)
+	if err != nil {
+		log.Println("ERROR: fail to upload file via signed URL", err)
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	auditMeta(c, meta.Size, meta.Checksums)
+	msg := fmt.Sprintf("File %s/%s uploaded successfully", params.Dir, params.File)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "msg": msg, "data": meta})
+}
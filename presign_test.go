@@ -0,0 +1,86 @@
+package main
+
+// presign tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestVerifySignedURL tests verification of signature and expiration time
+// of signed URLs
+func TestVerifySignedURL(t *testing.T) {
+	presignSecret = []byte("secret")
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Minute).Unix()
+	valid := urlSignature(http.MethodGet, "raw", "dir", "scan.h5", future)
+	expired := urlSignature(http.MethodGet, "raw", "dir", "scan.h5", past)
+	tests := []struct {
+		name      string
+		method    string
+		area      string
+		dir       string
+		file      string
+		expires   string
+		signature string
+		err       error
+	}{
+		{"valid", "GET", "raw", "dir", "scan.h5", strconv.FormatInt(future, 10), valid, nil},
+		{"upper case signature", "GET", "raw", "dir", "scan.h5", strconv.FormatInt(future, 10), strings.ToUpper(valid), nil},
+		{"tampered method", "PUT", "raw", "dir", "scan.h5", strconv.FormatInt(future, 10), valid, ErrSignatureInvalid},
+		{"tampered area", "GET", "doi", "dir", "scan.h5", strconv.FormatInt(future, 10), valid, ErrSignatureInvalid},
+		{"tampered dir", "GET", "raw", "other", "scan.h5", strconv.FormatInt(future, 10), valid, ErrSignatureInvalid},
+		{"tampered file", "GET", "raw", "dir", "scan.h6", strconv.FormatInt(future, 10), valid, ErrSignatureInvalid},
+		{"tampered expires", "GET", "raw", "dir", "scan.h5", strconv.FormatInt(future+1, 10), valid, ErrSignatureInvalid},
+		{"invalid expires", "GET", "raw", "dir", "scan.h5", "tomorrow", valid, ErrSignatureInvalid},
+		{"missing signature", "GET", "raw", "dir", "scan.h5", strconv.FormatInt(future, 10), "", ErrSignatureInvalid},
+		{"expired", "GET", "raw", "dir", "scan.h5", strconv.FormatInt(past, 10), expired, ErrSignatureExpired},
+		{"extended expired", "GET", "raw", "dir", "scan.h5", strconv.FormatInt(future, 10), expired, ErrSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySignedURL(tt.method, tt.area, tt.dir, tt.file, tt.expires, tt.signature)
+			if tt.err == nil && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// TestPresignRoundTrip tests that signed URL of file-system storage is
+// verified with its own parameters
+func TestPresignRoundTrip(t *testing.T) {
+	presignSecret = []byte("secret")
+	area := &StorageArea{Name: "raw", Backend: NewLocalFsClient(t.TempDir())}
+	purl, err := presign("https://foxden.example.com/dm/", http.MethodGet, area, "dir", "scan 1.h5", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purl.Direct {
+		t.Fatal("URL of file-system storage should be served by the service")
+	}
+	u, err := url.Parse(purl.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/dm/signed/raw/dir/scan 1.h5" {
+		t.Fatalf("unexpected path of signed URL %s", u.Path)
+	}
+	query := u.Query()
+	if err := verifySignedURL(http.MethodGet, "raw", "dir", "scan 1.h5", query.Get("expires"), query.Get("signature")); err != nil {
+		t.Fatalf("signed URL %s is not verified: %v", purl.URL, err)
+	}
+	if err := verifySignedURL(http.MethodPut, "raw", "dir", "scan 1.h5", query.Get("expires"), query.Get("signature")); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("download URL should not be valid for upload, got %v", err)
+	}
+}
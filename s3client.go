@@ -0,0 +1,1310 @@
+package main
+
+// s3 client module provides S3 implementation of StorageBackend
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	s3 "github.com/CHESSComputing/golib/s3"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsCredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	aws3 "github.com/aws/aws-sdk-go/service/s3"
+	minio "github.com/minio/minio-go/v7"
+	credentials "github.com/minio/minio-go/v7/pkg/credentials"
+	lifecycle "github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+// S3Backend provides S3 implementation of StorageBackend where top-level
+// directories are represented by S3 buckets and files by S3 objects
+type S3Backend struct {
+	Kind        string      // kind of S3 client, e.g. minio or aws
+	Client      s3.S3Client // golib S3 client
+	TrashBucket string      // bucket of deleted objects, deletions are permanent without it
+}
+
+// NewS3Backend creates new S3Backend for given configuration, if S3 endpoint
+// is not provided the S3 client is initialized from DataManagement.S3
+// section of FOXDEN configuration
+func NewS3Backend(config BackendConfig) (*S3Backend, error) {
+	kind := strings.ToLower(config.Kind)
+	if config.Endpoint == "" {
+		client, err := s3.InitializeS3Client(kind)
+		if err != nil {
+			return nil, fmt.Errorf("[DataManagement.main.NewS3Backend] s3.InitializeS3Client error: %w", err)
+		}
+		return &S3Backend{Kind: kind, Client: client, TrashBucket: config.TrashBucket}, nil
+	}
+	switch kind {
+	case "minio":
+		client, err := minio.New(config.Endpoint, &minio.Options{
+			Creds:  credentials.NewStaticV4(config.AccessKey, config.AccessSecret, ""),
+			Secure: config.UseSSL,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("[DataManagement.main.NewS3Backend] minio.New error: %w", err)
+		}
+		return &S3Backend{Kind: kind, Client: &s3.MinioClient{S3Client: client}, TrashBucket: config.TrashBucket}, nil
+	case "aws":
+		sess, err := session.NewSession(&aws.Config{
+			Endpoint:         aws.String(config.Endpoint),
+			Region:           aws.String(config.Region),
+			Credentials:      awsCredentials.NewStaticCredentials(config.AccessKey, config.AccessSecret, ""),
+			S3ForcePathStyle: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("[DataManagement.main.NewS3Backend] session.NewSession error: %w", err)
+		}
+		return &S3Backend{Kind: kind, Client: &s3.AWSClient{S3Client: aws3.New(sess)}, TrashBucket: config.TrashBucket}, nil
+	}
+	return nil, fmt.Errorf("[DataManagement.main.NewS3Backend] unsupported s3 client %s", config.Kind)
+}
+
+// Type implements StorageBackend interface
+func (b *S3Backend) Type() string {
+	return "s3"
+}
+
+// Capabilities implements StorageBackend interface
+func (b *S3Backend) Capabilities() []string {
+	caps := []string{"list", "read", "range", "write", "delete", "stat", "copy", "checksums", "versions", "lifecycle", "retention"}
+	if _, ok := b.Client.(*s3.MinioClient); ok {
+		caps = append(caps, "uploads")
+	}
+	if b.TrashBucket != "" {
+		caps = append(caps, "trash")
+	}
+	return caps
+}
+
+// List implements StorageBackend interface, it lists buckets if dir is empty
+// or objects of given bucket along with their checksums. The S3 object keys
+// are treated as paths, i.e. the depth of the object is number of its path
+// components, and common prefixes of objects are listed as directories.
+func (b *S3Backend) List(dir string, depth int) ([]Metadata, error) {
+	var records []Metadata
+	_, err := b.ListAfter(context.Background(), dir, depth, "", func(meta Metadata) bool {
+		records = append(records, meta)
+		return true
+	})
+	return records, err
+}
+
+// ListAfter implements PageLister interface, it lists buckets or objects of
+// given bucket in lexical order of their keys starting after given key. The
+// direct entries of a bucket are listed along with their common prefixes
+// (directories) using delimiter, deeper listings are recursive.
+func (b *S3Backend) ListAfter(ctx context.Context, dir string, depth int, after string, fn func(Metadata) bool) (bool, error) {
+	if dir == "" {
+		buckets, err := b.Client.ListBuckets()
+		if err != nil {
+			return false, fmt.Errorf("[DataManagement.main.S3Backend.List] ListBuckets error: %w", err)
+		}
+		sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+		for _, bucket := range buckets {
+			if bucket.Name+"/" <= after {
+				continue
+			}
+			meta := Metadata{Name: bucket.Name, ModTime: bucket.CreationDate, IsDirectory: true}
+			if !fn(meta) {
+				break
+			}
+		}
+		return false, nil
+	}
+	lister := &objectLister{depth: depth, after: after, fn: fn}
+	client, ok := b.Client.(*s3.MinioClient)
+	if !ok {
+		// fall back to generic listing of the bucket without object checksums
+		objs, err := b.Client.ListObjects(dir)
+		if err != nil {
+			return false, fmt.Errorf("[DataManagement.main.S3Backend.List] ListObjects error: %w", err)
+		}
+		sort.Slice(objs, func(i, j int) bool { return objs[i].Name < objs[j].Name })
+		for _, obj := range objs {
+			meta := Metadata{
+				Name:        obj.Name,
+				Size:        obj.Size,
+				ModTime:     obj.LastModified,
+				ContentType: obj.ContentType,
+			}
+			if !lister.next(meta) {
+				break
+			}
+		}
+		return false, nil
+	}
+	// cancel listing of remaining objects once we stop reading them
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	opts := minio.ListObjectsOptions{Recursive: depth != 1, WithMetadata: true, StartAfter: after}
+	for obj := range client.S3Client.ListObjects(ctx, dir, opts) {
+		if obj.Err != nil {
+			return false, fmt.Errorf("[DataManagement.main.S3Backend.List] minio.ListObjects error: %w", obj.Err)
+		}
+		meta := Metadata{
+			Name:        obj.Key,
+			Size:        obj.Size,
+			ModTime:     obj.LastModified,
+			ContentType: obj.ContentType,
+			ETag:        quoteETag(obj.ETag),
+			Checksums:   s3Checksums(obj.UserMetadata),
+		}
+		if !opts.Recursive && strings.HasSuffix(obj.Key, "/") {
+			// common prefix of objects
+			meta = Metadata{Name: strings.TrimSuffix(obj.Key, "/"), IsDirectory: true}
+		}
+		if !lister.next(meta) {
+			break
+		}
+	}
+	return false, nil
+}
+
+// objectLister passes S3 objects listed in lexical order of their keys to
+// listing function, it keeps objects within requested depth and represents
+// their common prefixes as directories. Entries which do not follow given
+// key (after) are skipped.
+type objectLister struct {
+	depth int
+	after string
+	fn    func(Metadata) bool
+	last  []string // path components of previous object
+}
+
+// helper function to pass object and its new common prefixes to listing
+// function, it returns false if listing should be stopped
+func (l *objectLister) next(obj Metadata) bool {
+	if obj.IsDirectory {
+		return obj.Name+"/" <= l.after || l.fn(obj)
+	}
+	parts := strings.Split(strings.Trim(obj.Name, "/"), "/")
+	for level := 1; level < len(parts) && (l.depth < 0 || level <= l.depth); level++ {
+		// objects are sorted, i.e. objects with the same prefix follow each other
+		if level < len(l.last) && slices.Equal(parts[:level], l.last[:level]) {
+			continue
+		}
+		prefix := strings.Join(parts[:level], "/")
+		if prefix+"/" > l.after && !l.fn(Metadata{Name: prefix, IsDirectory: true}) {
+			return false
+		}
+	}
+	l.last = parts
+	if (l.depth < 0 || len(parts) <= l.depth) && obj.Name > l.after {
+		return l.fn(obj)
+	}
+	return true
+}
+
+// Stat implements StorageBackend interface, it provides metadata of a bucket
+// if file is empty or of an object otherwise. Non-existing buckets and
+// objects are reported as os.ErrNotExist errors.
+func (b *S3Backend) Stat(dir, file string) (Metadata, error) {
+	if file == "" {
+		return b.statBucket(dir)
+	}
+	return b.statObject(dir, file, "")
+}
+
+// helper function to provide metadata of given version of an object, the
+// empty version id refers to the latest version
+func (b *S3Backend) statObject(dir, file, versionID string) (Metadata, error) {
+	meta := Metadata{Name: file}
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		opts := minio.StatObjectOptions{VersionID: versionID}
+		info, err := client.S3Client.StatObject(context.Background(), dir, file, opts)
+		if err != nil {
+			return meta, fmt.Errorf("[DataManagement.main.S3Backend.Stat] minio.StatObject error: %w", s3Error(err))
+		}
+		meta.Size = info.Size
+		meta.ModTime = info.LastModified
+		meta.ContentType = info.ContentType
+		meta.ETag = quoteETag(info.ETag)
+		meta.Checksums = s3Checksums(info.UserMetadata)
+	case *s3.AWSClient:
+		input := &aws3.HeadObjectInput{
+			Bucket: aws.String(dir),
+			Key:    aws.String(file),
+		}
+		if versionID != "" {
+			input.VersionId = aws.String(versionID)
+		}
+		out, err := client.S3Client.HeadObject(input)
+		if err != nil {
+			return meta, fmt.Errorf("[DataManagement.main.S3Backend.Stat] aws.HeadObject error: %w", s3Error(err))
+		}
+		meta.Size = aws.Int64Value(out.ContentLength)
+		meta.ModTime = aws.TimeValue(out.LastModified)
+		meta.ContentType = aws.StringValue(out.ContentType)
+		meta.ETag = quoteETag(aws.StringValue(out.ETag))
+		meta.Checksums = s3Checksums(aws.StringValueMap(out.Metadata))
+	default:
+		return meta, errors.New("[DataManagement.main.S3Backend.Stat] unsupported s3 client")
+	}
+	return meta, nil
+}
+
+// helper function to provide metadata of a bucket
+func (b *S3Backend) statBucket(dir string) (Metadata, error) {
+	meta := Metadata{Name: dir, IsDirectory: true}
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		found, err := client.S3Client.BucketExists(context.Background(), dir)
+		if err != nil {
+			return meta, fmt.Errorf("[DataManagement.main.S3Backend.Stat] minio.BucketExists error: %w", s3Error(err))
+		}
+		if !found {
+			return meta, fmt.Errorf("[DataManagement.main.S3Backend.Stat] bucket %s: %w", dir, os.ErrNotExist)
+		}
+	case *s3.AWSClient:
+		_, err := client.S3Client.HeadBucket(&aws3.HeadBucketInput{Bucket: aws.String(dir)})
+		if err != nil {
+			return meta, fmt.Errorf("[DataManagement.main.S3Backend.Stat] aws.HeadBucket error: %w", s3Error(err))
+		}
+	default:
+		return meta, errors.New("[DataManagement.main.S3Backend.Stat] unsupported s3 client")
+	}
+	return meta, nil
+}
+
+// helper function to represent S3 errors of non-existing buckets and objects
+// as os.ErrNotExist errors
+func s3Error(err error) error {
+	var rerr awserr.RequestFailure
+	if errors.As(err, &rerr) && rerr.StatusCode() == http.StatusNotFound {
+		return errors.Join(os.ErrNotExist, err)
+	}
+	if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+		return errors.Join(os.ErrNotExist, err)
+	}
+	return err
+}
+
+// Open implements StorageBackend interface, it provides streaming access to
+// S3 object along with its metadata, the caller is responsible to close
+// returned reader
+func (b *S3Backend) Open(dir, file string) (io.ReadSeekCloser, Metadata, error) {
+	return b.openObject(dir, file, "")
+}
+
+// helper function to open given version of an object, the empty version id
+// refers to the latest version
+func (b *S3Backend) openObject(dir, file, versionID string) (io.ReadSeekCloser, Metadata, error) {
+	var meta Metadata
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		ctx := context.Background()
+		opts := minio.GetObjectOptions{VersionID: versionID}
+		obj, err := client.S3Client.GetObject(ctx, dir, file, opts)
+		if err != nil {
+			return nil, meta, fmt.Errorf("[DataManagement.main.S3Backend.Open] minio.GetObject error: %w", s3Error(err))
+		}
+		info, err := obj.Stat()
+		if err != nil {
+			obj.Close()
+			return nil, meta, fmt.Errorf("[DataManagement.main.S3Backend.Open] minio.Stat error: %w", s3Error(err))
+		}
+		meta = Metadata{
+			Name:        file,
+			Size:        info.Size,
+			ModTime:     info.LastModified,
+			ContentType: info.ContentType,
+			ETag:        quoteETag(info.ETag),
+			Checksums:   s3Checksums(info.UserMetadata),
+		}
+		return obj, meta, nil
+	case *s3.AWSClient:
+		meta, err := b.statObject(dir, file, versionID)
+		if err != nil {
+			return nil, meta, fmt.Errorf("[DataManagement.main.S3Backend.Open] Stat error: %w", err)
+		}
+		reader := &awsObjectReader{
+			client:    client.S3Client,
+			bucket:    dir,
+			object:    file,
+			versionID: versionID,
+			size:      meta.Size,
+		}
+		return reader, meta, nil
+	}
+	return nil, meta, errors.New("[DataManagement.main.S3Backend.Open] unsupported s3 client")
+}
+
+// Create implements StorageBackend interface, it creates new bucket
+func (b *S3Backend) Create(dir string) error {
+	if err := b.Client.CreateBucket(dir); err != nil {
+		return fmt.Errorf("[DataManagement.main.S3Backend.Create] CreateBucket error: %w", err)
+	}
+	return nil
+}
+
+// Delete implements StorageBackend interface, it removes given object or
+// entire bucket along with its objects if file is empty
+func (b *S3Backend) Delete(dir, file string) error {
+	if file == "" {
+		objects, err := b.List(dir, -1)
+		if err != nil {
+			return fmt.Errorf("[DataManagement.main.S3Backend.Delete] List error: %w", err)
+		}
+		for _, obj := range objects {
+			if obj.IsDirectory {
+				continue
+			}
+			if err := b.Client.DeleteObject(dir, obj.Name, ""); err != nil {
+				return fmt.Errorf("[DataManagement.main.S3Backend.Delete] DeleteObject error: %w", err)
+			}
+		}
+		if err := b.Client.DeleteBucket(dir); err != nil {
+			return fmt.Errorf("[DataManagement.main.S3Backend.Delete] DeleteBucket error: %w", err)
+		}
+		return nil
+	}
+	// with enabled versioning of the bucket the delete marker becomes the
+	// latest version of the object, see DeleteVersion to remove the version
+	if err := b.Client.DeleteObject(dir, file, ""); err != nil {
+		return fmt.Errorf("[DataManagement.main.S3Backend.Delete] DeleteObject error: %w", err)
+	}
+	return nil
+}
+
+// Upload implements StorageBackend interface. The checksums of the content
+// are computed and verified along with the upload and kept as user metadata
+// of the object, the content type of the object is detected from its content
+// unless it is provided by the client.
+func (b *S3Backend) Upload(dir, file, ctype string, reader io.Reader, size int64, expect map[string]string) (Metadata, error) {
+	meta := Metadata{Name: file, Size: size}
+	seeker, ok := reader.(io.ReadSeeker)
+	if !ok {
+		// the content can be read only once, therefore we compute checksums
+		// while uploading the object and verify them afterwards
+		return b.uploadStream(dir, file, ctype, reader, size, expect)
+	}
+	summer := NewChecksummer(checksumAlgorithms(expect)...)
+	head := &headWriter{}
+	if _, err := io.Copy(io.MultiWriter(summer, head), seeker); err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.S3Backend.Upload] io.Copy error: %w", err)
+	}
+	if err := summer.Verify(expect); err != nil {
+		return meta, err
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.S3Backend.Upload] reader.Seek error: %w", err)
+	}
+	meta.Checksums = storedChecksums(summer.Sums())
+	meta.ContentType = detectContentType(ctype, file, head.head)
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		opts := minio.PutObjectOptions{ContentType: meta.ContentType, UserMetadata: meta.Checksums}
+		info, err := client.S3Client.PutObject(context.Background(), dir, file, seeker, size, opts)
+		if err != nil {
+			return meta, fmt.Errorf("[DataManagement.main.S3Backend.Upload] minio.PutObject error: %w", err)
+		}
+		meta.ETag = quoteETag(info.ETag)
+		meta.ModTime = info.LastModified
+	case *s3.AWSClient:
+		input := &aws3.PutObjectInput{
+			Bucket:        aws.String(dir),
+			Key:           aws.String(file),
+			Body:          aws.ReadSeekCloser(seeker),
+			ContentLength: aws.Int64(size),
+			Metadata:      aws.StringMap(meta.Checksums),
+			ContentType:   aws.String(meta.ContentType),
+		}
+		out, err := client.S3Client.PutObject(input)
+		if err != nil {
+			return meta, fmt.Errorf("[DataManagement.main.S3Backend.Upload] aws.PutObject error: %w", err)
+		}
+		meta.ETag = quoteETag(aws.StringValue(out.ETag))
+	default:
+		return meta, errors.New("[DataManagement.main.S3Backend.Upload] unsupported s3 client")
+	}
+	return meta, nil
+}
+
+// helper function to upload content of non-seekable reader, the object is
+// removed if its checksums do not match expected ones
+func (b *S3Backend) uploadStream(dir, file, ctype string, reader io.Reader, size int64, expect map[string]string) (Metadata, error) {
+	meta := Metadata{Name: file, Size: size}
+	client, ok := b.Client.(*s3.MinioClient)
+	if !ok {
+		return meta, fmt.Errorf("%w: streaming upload requires MinIO S3 client", ErrNotSupported)
+	}
+	ctx := context.Background()
+	summer := NewChecksummer(checksumAlgorithms(expect)...)
+	head := &headWriter{}
+	opts := minio.PutObjectOptions{ContentType: detectContentType(ctype, file, nil)}
+	info, err := client.S3Client.PutObject(ctx, dir, file, io.TeeReader(reader, io.MultiWriter(summer, head)), size, opts)
+	if err != nil {
+		return meta, fmt.Errorf("[DataManagement.main.S3Backend.uploadStream] minio.PutObject error: %w", err)
+	}
+	if err := summer.Verify(expect); err != nil {
+		if rerr := client.S3Client.RemoveObject(ctx, dir, file, minio.RemoveObjectOptions{}); rerr != nil {
+			log.Printf("ERROR: unable to remove corrupted object %s/%s, error %v", dir, file, rerr)
+		}
+		return meta, err
+	}
+	meta.Size = info.Size
+	meta.Checksums = storedChecksums(summer.Sums())
+	meta.ContentType = detectContentType(ctype, file, head.head)
+	if err := b.setMetadata(dir, file, meta.ContentType, meta.Checksums); err != nil {
+		return meta, err
+	}
+	return b.Stat(dir, file)
+}
+
+// Copy implements StorageBackend interface, it performs server side copy of
+// the object along with its metadata
+func (b *S3Backend) Copy(srcDir, srcFile, dstDir, dstFile string) (Metadata, error) {
+	var meta Metadata
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		info, err := b.Stat(srcDir, srcFile)
+		if err != nil {
+			return meta, fmt.Errorf("[DataManagement.main.S3Backend.Copy] Stat error: %w", err)
+		}
+		dst := minio.CopyDestOptions{
+			Bucket:          dstDir,
+			Object:          dstFile,
+			UserMetadata:    info.Checksums,
+			ContentType:     info.ContentType,
+			ReplaceMetadata: true,
+		}
+		src := minio.CopySrcOptions{Bucket: srcDir, Object: srcFile}
+		if _, err := client.S3Client.ComposeObject(context.Background(), dst, src); err != nil {
+			return meta, fmt.Errorf("[DataManagement.main.S3Backend.Copy] minio.ComposeObject error: %w", err)
+		}
+	case *s3.AWSClient:
+		_, err := client.S3Client.CopyObject(&aws3.CopyObjectInput{
+			Bucket:            aws.String(dstDir),
+			Key:               aws.String(dstFile),
+			CopySource:        aws.String(url.PathEscape(srcDir + "/" + srcFile)),
+			MetadataDirective: aws.String(aws3.MetadataDirectiveCopy),
+		})
+		if err != nil {
+			return meta, fmt.Errorf("[DataManagement.main.S3Backend.Copy] aws.CopyObject error: %w", err)
+		}
+	default:
+		return meta, errors.New("[DataManagement.main.S3Backend.Copy] unsupported s3 client")
+	}
+	return b.Stat(dstDir, dstFile)
+}
+
+// helper function to replace content type and user metadata of the object
+// via server side copy of the object onto itself
+func (b *S3Backend) setMetadata(dir, file, ctype string, metadata map[string]string) error {
+	client, ok := b.Client.(*s3.MinioClient)
+	if !ok {
+		return fmt.Errorf("%w: updating object metadata requires MinIO S3 client", ErrNotSupported)
+	}
+	dst := minio.CopyDestOptions{
+		Bucket:          dir,
+		Object:          file,
+		UserMetadata:    metadata,
+		ContentType:     ctype,
+		ReplaceMetadata: true,
+	}
+	src := minio.CopySrcOptions{Bucket: dir, Object: file}
+	if _, err := client.S3Client.ComposeObject(context.Background(), dst, src); err != nil {
+		return fmt.Errorf("[DataManagement.main.S3Backend.setMetadata] minio.ComposeObject error: %w", err)
+	}
+	return nil
+}
+
+// StoreChecksums computes checksums of existing S3 object, verifies them
+// against expected values and keeps them as user metadata of the object
+// along with detected content type of the object.
+// It is used for objects assembled by S3 itself, e.g. via multipart upload,
+// and the object is removed if its checksums do not match expected ones.
+func (b *S3Backend) StoreChecksums(dir, file, ctype string, expect map[string]string) (map[string]string, error) {
+	client, ok := b.Client.(*s3.MinioClient)
+	if !ok {
+		return nil, fmt.Errorf("%w: storing object checksums requires MinIO S3 client", ErrNotSupported)
+	}
+	ctx := context.Background()
+	obj, err := client.S3Client.GetObject(ctx, dir, file, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.S3Backend.StoreChecksums] minio.GetObject error: %w", err)
+	}
+	defer obj.Close()
+	summer := NewChecksummer(checksumAlgorithms(expect)...)
+	head := &headWriter{}
+	if _, err := io.Copy(io.MultiWriter(summer, head), obj); err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.S3Backend.StoreChecksums] io.Copy error: %w", err)
+	}
+	if err := summer.Verify(expect); err != nil {
+		if rerr := client.S3Client.RemoveObject(ctx, dir, file, minio.RemoveObjectOptions{}); rerr != nil {
+			log.Printf("ERROR: unable to remove corrupted object %s/%s, error %v", dir, file, rerr)
+		}
+		return nil, err
+	}
+	sums := storedChecksums(summer.Sums())
+	if err := b.setMetadata(dir, file, detectContentType(ctype, file, head.head), sums); err != nil {
+		return sums, err
+	}
+	return sums, nil
+}
+
+// helper function to provide quoted ETag value
+func quoteETag(etag string) string {
+	if etag == "" || etag[0] == '"' {
+		return etag
+	}
+	return fmt.Sprintf("\"%s\"", etag)
+}
+
+// Versioning implements Versioner interface, it reports if versioning of
+// the bucket is enabled
+func (b *S3Backend) Versioning(dir string) (bool, error) {
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		config, err := client.S3Client.GetBucketVersioning(context.Background(), dir)
+		if err != nil {
+			return false, fmt.Errorf("[DataManagement.main.S3Backend.Versioning] minio.GetBucketVersioning error: %w", s3Error(err))
+		}
+		return config.Enabled(), nil
+	case *s3.AWSClient:
+		out, err := client.S3Client.GetBucketVersioning(&aws3.GetBucketVersioningInput{Bucket: aws.String(dir)})
+		if err != nil {
+			return false, fmt.Errorf("[DataManagement.main.S3Backend.Versioning] aws.GetBucketVersioning error: %w", s3Error(err))
+		}
+		return aws.StringValue(out.Status) == aws3.BucketVersioningStatusEnabled, nil
+	}
+	return false, errors.New("[DataManagement.main.S3Backend.Versioning] unsupported s3 client")
+}
+
+// SetVersioning implements Versioner interface, it enables or suspends
+// versioning of the bucket, the existing versions of objects are kept
+func (b *S3Backend) SetVersioning(dir string, enabled bool) error {
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		var err error
+		if enabled {
+			err = client.S3Client.EnableVersioning(context.Background(), dir)
+		} else {
+			err = client.S3Client.SuspendVersioning(context.Background(), dir)
+		}
+		if err != nil {
+			return fmt.Errorf("[DataManagement.main.S3Backend.SetVersioning] minio error: %w", s3Error(err))
+		}
+		return nil
+	case *s3.AWSClient:
+		status := aws3.BucketVersioningStatusSuspended
+		if enabled {
+			status = aws3.BucketVersioningStatusEnabled
+		}
+		_, err := client.S3Client.PutBucketVersioning(&aws3.PutBucketVersioningInput{
+			Bucket:                  aws.String(dir),
+			VersioningConfiguration: &aws3.VersioningConfiguration{Status: aws.String(status)},
+		})
+		if err != nil {
+			return fmt.Errorf("[DataManagement.main.S3Backend.SetVersioning] aws.PutBucketVersioning error: %w", s3Error(err))
+		}
+		return nil
+	}
+	return errors.New("[DataManagement.main.S3Backend.SetVersioning] unsupported s3 client")
+}
+
+// Versions implements Versioner interface, it lists versions and delete
+// markers of an object
+func (b *S3Backend) Versions(dir, file string) ([]Version, error) {
+	var versions []Version
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		opts := minio.ListObjectsOptions{Prefix: file, WithVersions: true}
+		for obj := range client.S3Client.ListObjects(context.Background(), dir, opts) {
+			if obj.Err != nil {
+				return nil, fmt.Errorf("[DataManagement.main.S3Backend.Versions] minio.ListObjects error: %w", s3Error(obj.Err))
+			}
+			if obj.Key != file {
+				continue
+			}
+			versions = append(versions, Version{
+				VersionID:      obj.VersionID,
+				Size:           obj.Size,
+				ModTime:        obj.LastModified,
+				IsLatest:       obj.IsLatest,
+				IsDeleteMarker: obj.IsDeleteMarker,
+				ETag:           quoteETag(obj.ETag),
+			})
+		}
+	case *s3.AWSClient:
+		input := &aws3.ListObjectVersionsInput{Bucket: aws.String(dir), Prefix: aws.String(file)}
+		err := client.S3Client.ListObjectVersionsPages(input, func(page *aws3.ListObjectVersionsOutput, last bool) bool {
+			for _, obj := range page.Versions {
+				if aws.StringValue(obj.Key) != file {
+					continue
+				}
+				versions = append(versions, Version{
+					VersionID: aws.StringValue(obj.VersionId),
+					Size:      aws.Int64Value(obj.Size),
+					ModTime:   aws.TimeValue(obj.LastModified),
+					IsLatest:  aws.BoolValue(obj.IsLatest),
+					ETag:      quoteETag(aws.StringValue(obj.ETag)),
+				})
+			}
+			for _, marker := range page.DeleteMarkers {
+				if aws.StringValue(marker.Key) != file {
+					continue
+				}
+				versions = append(versions, Version{
+					VersionID:      aws.StringValue(marker.VersionId),
+					ModTime:        aws.TimeValue(marker.LastModified),
+					IsLatest:       aws.BoolValue(marker.IsLatest),
+					IsDeleteMarker: true,
+				})
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("[DataManagement.main.S3Backend.Versions] aws.ListObjectVersions error: %w", s3Error(err))
+		}
+	default:
+		return nil, errors.New("[DataManagement.main.S3Backend.Versions] unsupported s3 client")
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("[DataManagement.main.S3Backend.Versions] object %s/%s: %w", dir, file, os.ErrNotExist)
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+// OpenVersion implements Versioner interface
+func (b *S3Backend) OpenVersion(dir, file, versionID string) (io.ReadSeekCloser, Metadata, error) {
+	return b.openObject(dir, file, versionID)
+}
+
+// DeleteVersion implements Versioner interface, it permanently removes
+// version (or delete marker) of an object
+func (b *S3Backend) DeleteVersion(dir, file, versionID string) error {
+	if err := b.Client.DeleteObject(dir, file, versionID); err != nil {
+		return fmt.Errorf("[DataManagement.main.S3Backend.DeleteVersion] DeleteObject error: %w", err)
+	}
+	return nil
+}
+
+// RestoreVersion implements Versioner interface, it copies prior version of
+// an object server side which makes it the latest version of the object
+func (b *S3Backend) RestoreVersion(dir, file, versionID string) (Metadata, error) {
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		dst := minio.CopyDestOptions{Bucket: dir, Object: file}
+		src := minio.CopySrcOptions{Bucket: dir, Object: file, VersionID: versionID}
+		if _, err := client.S3Client.ComposeObject(context.Background(), dst, src); err != nil {
+			return Metadata{}, fmt.Errorf("[DataManagement.main.S3Backend.RestoreVersion] minio.ComposeObject error: %w", s3Error(err))
+		}
+	case *s3.AWSClient:
+		source := url.PathEscape(dir+"/"+file) + "?versionId=" + url.QueryEscape(versionID)
+		_, err := client.S3Client.CopyObject(&aws3.CopyObjectInput{
+			Bucket:            aws.String(dir),
+			Key:               aws.String(file),
+			CopySource:        aws.String(source),
+			MetadataDirective: aws.String(aws3.MetadataDirectiveCopy),
+		})
+		if err != nil {
+			return Metadata{}, fmt.Errorf("[DataManagement.main.S3Backend.RestoreVersion] aws.CopyObject error: %w", s3Error(err))
+		}
+	default:
+		return Metadata{}, errors.New("[DataManagement.main.S3Backend.RestoreVersion] unsupported s3 client")
+	}
+	return b.Stat(dir, file)
+}
+
+// Presign implements Presigner interface, it provides presigned URL of an
+// object for GET or PUT HTTP method
+func (b *S3Backend) Presign(method, dir, file string, expires time.Duration) (string, error) {
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		u, err := client.S3Client.Presign(context.Background(), method, dir, file, expires, nil)
+		if err != nil {
+			return "", fmt.Errorf("[DataManagement.main.S3Backend.Presign] minio.Presign error: %w", err)
+		}
+		return u.String(), nil
+	case *s3.AWSClient:
+		var req *request.Request
+		switch method {
+		case http.MethodGet:
+			req, _ = client.S3Client.GetObjectRequest(&aws3.GetObjectInput{Bucket: aws.String(dir), Key: aws.String(file)})
+		case http.MethodPut:
+			req, _ = client.S3Client.PutObjectRequest(&aws3.PutObjectInput{Bucket: aws.String(dir), Key: aws.String(file)})
+		default:
+			return "", fmt.Errorf("%w: presigned URL of %s method", ErrNotSupported, method)
+		}
+		u, err := req.Presign(expires)
+		if err != nil {
+			return "", fmt.Errorf("[DataManagement.main.S3Backend.Presign] aws.Presign error: %w", err)
+		}
+		return u, nil
+	}
+	return "", errors.New("[DataManagement.main.S3Backend.Presign] unsupported s3 client")
+}
+
+// helper function to check if S3 error reports missing configuration of the
+// bucket or object, e.g. lifecycle or object lock configuration
+func s3NotConfigured(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		code = aerr.Code()
+	}
+	switch code {
+	case "NoSuchLifecycleConfiguration", "NoSuchObjectLockConfiguration",
+		"ObjectLockConfigurationNotFoundError", "InvalidRequest":
+		return true
+	}
+	return false
+}
+
+// Lifecycle implements LifecycleManager interface, it provides lifecycle
+// rules of the bucket
+func (b *S3Backend) Lifecycle(dir string) ([]LifecycleRule, error) {
+	var rules []LifecycleRule
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		config, err := client.S3Client.GetBucketLifecycle(context.Background(), dir)
+		if err != nil {
+			if s3NotConfigured(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("[DataManagement.main.S3Backend.Lifecycle] minio.GetBucketLifecycle error: %w", s3Error(err))
+		}
+		for _, rule := range config.Rules {
+			prefix := rule.RuleFilter.Prefix
+			if prefix == "" {
+				prefix = rule.Prefix
+			}
+			rules = append(rules, LifecycleRule{
+				ID:               rule.ID,
+				Prefix:           prefix,
+				Disabled:         rule.Status != "Enabled",
+				ExpireDays:       int(rule.Expiration.Days),
+				TransitionDays:   int(rule.Transition.Days),
+				TransitionTarget: rule.Transition.StorageClass,
+				AbortUploadsDays: int(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation),
+			})
+		}
+	case *s3.AWSClient:
+		out, err := client.S3Client.GetBucketLifecycleConfiguration(&aws3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(dir)})
+		if err != nil {
+			if s3NotConfigured(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("[DataManagement.main.S3Backend.Lifecycle] aws.GetBucketLifecycleConfiguration error: %w", s3Error(err))
+		}
+		for _, rule := range out.Rules {
+			lrule := LifecycleRule{
+				ID:       aws.StringValue(rule.ID),
+				Prefix:   aws.StringValue(rule.Prefix),
+				Disabled: aws.StringValue(rule.Status) != aws3.ExpirationStatusEnabled,
+			}
+			if rule.Filter != nil && rule.Filter.Prefix != nil {
+				lrule.Prefix = aws.StringValue(rule.Filter.Prefix)
+			}
+			if rule.Expiration != nil {
+				lrule.ExpireDays = int(aws.Int64Value(rule.Expiration.Days))
+			}
+			if len(rule.Transitions) > 0 {
+				lrule.TransitionDays = int(aws.Int64Value(rule.Transitions[0].Days))
+				lrule.TransitionTarget = aws.StringValue(rule.Transitions[0].StorageClass)
+			}
+			if rule.AbortIncompleteMultipartUpload != nil {
+				lrule.AbortUploadsDays = int(aws.Int64Value(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation))
+			}
+			rules = append(rules, lrule)
+		}
+	default:
+		return nil, errors.New("[DataManagement.main.S3Backend.Lifecycle] unsupported s3 client")
+	}
+	return rules, nil
+}
+
+// SetLifecycle implements LifecycleManager interface, it replaces lifecycle
+// rules of the bucket, empty list of rules removes lifecycle configuration
+func (b *S3Backend) SetLifecycle(dir string, rules []LifecycleRule) error {
+	if err := validateLifecycle(rules); err != nil {
+		return err
+	}
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		config := lifecycle.NewConfiguration()
+		for _, rule := range rules {
+			lrule := lifecycle.Rule{
+				ID:         rule.ID,
+				Status:     "Enabled",
+				RuleFilter: lifecycle.Filter{Prefix: rule.Prefix},
+			}
+			if rule.Disabled {
+				lrule.Status = "Disabled"
+			}
+			lrule.Expiration.Days = lifecycle.ExpirationDays(rule.ExpireDays)
+			if rule.TransitionDays > 0 {
+				lrule.Transition.Days = lifecycle.ExpirationDays(rule.TransitionDays)
+				lrule.Transition.StorageClass = rule.TransitionTarget
+			}
+			lrule.AbortIncompleteMultipartUpload.DaysAfterInitiation = lifecycle.ExpirationDays(rule.AbortUploadsDays)
+			config.Rules = append(config.Rules, lrule)
+		}
+		if err := client.S3Client.SetBucketLifecycle(context.Background(), dir, config); err != nil {
+			return fmt.Errorf("[DataManagement.main.S3Backend.SetLifecycle] minio.SetBucketLifecycle error: %w", s3Error(err))
+		}
+		return nil
+	case *s3.AWSClient:
+		if len(rules) == 0 {
+			_, err := client.S3Client.DeleteBucketLifecycle(&aws3.DeleteBucketLifecycleInput{Bucket: aws.String(dir)})
+			if err != nil {
+				return fmt.Errorf("[DataManagement.main.S3Backend.SetLifecycle] aws.DeleteBucketLifecycle error: %w", s3Error(err))
+			}
+			return nil
+		}
+		var lrules []*aws3.LifecycleRule
+		for _, rule := range rules {
+			lrule := &aws3.LifecycleRule{
+				ID:     aws.String(rule.ID),
+				Status: aws.String(aws3.ExpirationStatusEnabled),
+				Filter: &aws3.LifecycleRuleFilter{Prefix: aws.String(rule.Prefix)},
+			}
+			if rule.Disabled {
+				lrule.Status = aws.String(aws3.ExpirationStatusDisabled)
+			}
+			if rule.ExpireDays > 0 {
+				lrule.Expiration = &aws3.LifecycleExpiration{Days: aws.Int64(int64(rule.ExpireDays))}
+			}
+			if rule.TransitionDays > 0 {
+				lrule.Transitions = []*aws3.Transition{{
+					Days:         aws.Int64(int64(rule.TransitionDays)),
+					StorageClass: aws.String(rule.TransitionTarget),
+				}}
+			}
+			if rule.AbortUploadsDays > 0 {
+				lrule.AbortIncompleteMultipartUpload = &aws3.AbortIncompleteMultipartUpload{
+					DaysAfterInitiation: aws.Int64(int64(rule.AbortUploadsDays)),
+				}
+			}
+			lrules = append(lrules, lrule)
+		}
+		_, err := client.S3Client.PutBucketLifecycleConfiguration(&aws3.PutBucketLifecycleConfigurationInput{
+			Bucket:                 aws.String(dir),
+			LifecycleConfiguration: &aws3.BucketLifecycleConfiguration{Rules: lrules},
+		})
+		if err != nil {
+			return fmt.Errorf("[DataManagement.main.S3Backend.SetLifecycle] aws.PutBucketLifecycleConfiguration error: %w", s3Error(err))
+		}
+		return nil
+	}
+	return errors.New("[DataManagement.main.S3Backend.SetLifecycle] unsupported s3 client")
+}
+
+// Retention implements RetentionManager interface, it provides retention
+// and legal hold of an object, the objects of buckets without object lock
+// do not have retention
+func (b *S3Backend) Retention(dir, file string) (Retention, error) {
+	var retention Retention
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		ctx := context.Background()
+		mode, until, err := client.S3Client.GetObjectRetention(ctx, dir, file, "")
+		if err != nil && !s3NotConfigured(err) {
+			return retention, fmt.Errorf("[DataManagement.main.S3Backend.Retention] minio.GetObjectRetention error: %w", s3Error(err))
+		}
+		if err == nil && mode != nil && until != nil {
+			retention.Mode = strings.ToLower(string(*mode))
+			retention.RetainUntil = *until
+		}
+		status, err := client.S3Client.GetObjectLegalHold(ctx, dir, file, minio.GetObjectLegalHoldOptions{})
+		if err != nil && !s3NotConfigured(err) {
+			return retention, fmt.Errorf("[DataManagement.main.S3Backend.Retention] minio.GetObjectLegalHold error: %w", s3Error(err))
+		}
+		retention.LegalHold = err == nil && status != nil && *status == minio.LegalHoldEnabled
+	case *s3.AWSClient:
+		out, err := client.S3Client.GetObjectRetention(&aws3.GetObjectRetentionInput{Bucket: aws.String(dir), Key: aws.String(file)})
+		if err != nil && !s3NotConfigured(err) {
+			return retention, fmt.Errorf("[DataManagement.main.S3Backend.Retention] aws.GetObjectRetention error: %w", s3Error(err))
+		}
+		if err == nil && out.Retention != nil {
+			retention.Mode = strings.ToLower(aws.StringValue(out.Retention.Mode))
+			retention.RetainUntil = aws.TimeValue(out.Retention.RetainUntilDate)
+		}
+		hold, err := client.S3Client.GetObjectLegalHold(&aws3.GetObjectLegalHoldInput{Bucket: aws.String(dir), Key: aws.String(file)})
+		if err != nil && !s3NotConfigured(err) {
+			return retention, fmt.Errorf("[DataManagement.main.S3Backend.Retention] aws.GetObjectLegalHold error: %w", s3Error(err))
+		}
+		retention.LegalHold = err == nil && hold.LegalHold != nil &&
+			aws.StringValue(hold.LegalHold.Status) == aws3.ObjectLockLegalHoldStatusOn
+	default:
+		return retention, errors.New("[DataManagement.main.S3Backend.Retention] unsupported s3 client")
+	}
+	return retention, nil
+}
+
+// SetRetention implements RetentionManager interface, it sets retention and
+// legal hold of an object, the bucket should be created with object lock.
+// The governance retention is bypassed since changes of retention are
+// validated by DataManagement service, i.e. retention can only be extended
+// and its release requires admin scope of access token.
+func (b *S3Backend) SetRetention(dir, file string, retention Retention) error {
+	switch client := b.Client.(type) {
+	case *s3.MinioClient:
+		ctx := context.Background()
+		opts := minio.PutObjectRetentionOptions{GovernanceBypass: true}
+		if retention.Mode != "" {
+			mode := minio.RetentionMode(strings.ToUpper(retention.Mode))
+			opts.Mode = &mode
+			opts.RetainUntilDate = &retention.RetainUntil
+		}
+		if err := client.S3Client.PutObjectRetention(ctx, dir, file, opts); err != nil {
+			return fmt.Errorf("[DataManagement.main.S3Backend.SetRetention] minio.PutObjectRetention error: %w", s3Error(err))
+		}
+		status := minio.LegalHoldDisabled
+		if retention.LegalHold {
+			status = minio.LegalHoldEnabled
+		}
+		err := client.S3Client.PutObjectLegalHold(ctx, dir, file, minio.PutObjectLegalHoldOptions{Status: &status})
+		if err != nil {
+			return fmt.Errorf("[DataManagement.main.S3Backend.SetRetention] minio.PutObjectLegalHold error: %w", s3Error(err))
+		}
+		return nil
+	case *s3.AWSClient:
+		lock := &aws3.ObjectLockRetention{}
+		if retention.Mode != "" {
+			lock.Mode = aws.String(strings.ToUpper(retention.Mode))
+			lock.RetainUntilDate = aws.Time(retention.RetainUntil)
+		}
+		_, err := client.S3Client.PutObjectRetention(&aws3.PutObjectRetentionInput{
+			Bucket:                    aws.String(dir),
+			Key:                       aws.String(file),
+			Retention:                 lock,
+			BypassGovernanceRetention: aws.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("[DataManagement.main.S3Backend.SetRetention] aws.PutObjectRetention error: %w", s3Error(err))
+		}
+		status := aws3.ObjectLockLegalHoldStatusOff
+		if retention.LegalHold {
+			status = aws3.ObjectLockLegalHoldStatusOn
+		}
+		_, err = client.S3Client.PutObjectLegalHold(&aws3.PutObjectLegalHoldInput{
+			Bucket:    aws.String(dir),
+			Key:       aws.String(file),
+			LegalHold: &aws3.ObjectLockLegalHold{Status: aws.String(status)},
+		})
+		if err != nil {
+			return fmt.Errorf("[DataManagement.main.S3Backend.SetRetention] aws.PutObjectLegalHold error: %w", s3Error(err))
+		}
+		return nil
+	}
+	return errors.New("[DataManagement.main.S3Backend.SetRetention] unsupported s3 client")
+}
+
+// helper function to list objects of trash entry, the objects are listed
+// starting after the prefix of trash entry until the first object of other
+// trash entry
+func (b *S3Backend) trashObjects(id string) ([]Metadata, error) {
+	var objects []Metadata
+	prefix := id + "/"
+	_, err := b.ListAfter(context.Background(), b.TrashBucket, -1, prefix, func(obj Metadata) bool {
+		if !strings.HasPrefix(obj.Name, prefix) {
+			return false
+		}
+		if !obj.IsDirectory {
+			objects = append(objects, obj)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// helper function to remove trash entry along with given objects of the
+// entry, it is used to roll back incomplete move of data to trash
+func (b *S3Backend) discardTrash(id string, objects []string) {
+	for _, name := range append(objects, id+".json") {
+		if err := b.Client.DeleteObject(b.TrashBucket, name, ""); err != nil {
+			log.Printf("WARNING: unable to remove %s of trash entry %s: %v", name, id, err)
+		}
+	}
+}
+
+// helper function to read trash entry
+func (b *S3Backend) trashEntry(id string) (TrashEntry, error) {
+	var entry TrashEntry
+	if !trashIdPattern.MatchString(id) {
+		return entry, fmt.Errorf("invalid trash id '%s'", id)
+	}
+	reader, _, err := b.Open(b.TrashBucket, id+".json")
+	if err != nil {
+		return entry, err
+	}
+	defer reader.Close()
+	err = json.NewDecoder(reader).Decode(&entry)
+	return entry, err
+}
+
+// Trash implements Trasher interface, it copies given object or all objects
+// of the bucket if file is empty to trash bucket and deletes them
+func (b *S3Backend) Trash(dir, file string) (TrashEntry, error) {
+	entry := TrashEntry{Dir: dir, File: file, IsDirectory: file == ""}
+	if b.TrashBucket == "" {
+		return entry, fmt.Errorf("%w: trash bucket is not configured", ErrNotSupported)
+	}
+	if dir == b.TrashBucket {
+		return entry, &ForbiddenPathError{Path: dir, Reason: "trash bucket can not be deleted"}
+	}
+	var objects []Metadata
+	if entry.IsDirectory {
+		entries, err := b.List(dir, -1)
+		if err != nil {
+			return entry, fmt.Errorf("[DataManagement.main.S3Backend.Trash] List error: %w", err)
+		}
+		for _, obj := range entries {
+			if !obj.IsDirectory {
+				objects = append(objects, obj)
+			}
+		}
+	} else {
+		meta, err := b.Stat(dir, file)
+		if err != nil {
+			return entry, fmt.Errorf("[DataManagement.main.S3Backend.Trash] Stat error: %w", err)
+		}
+		meta.Name = file
+		objects = append(objects, meta)
+	}
+	var err error
+	if entry.ID, err = newTrashID(); err != nil {
+		return entry, err
+	}
+	entry.Deleted = time.Now()
+	for _, obj := range objects {
+		entry.Size += obj.Size
+		entry.Files++
+	}
+
+	// keep trash entry before we copy its data to make sure that trash
+	// bucket does not have data without entries
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.S3Backend.Trash] json.Marshal error: %w", err)
+	}
+	_, err = b.Upload(b.TrashBucket, entry.ID+".json", "application/json", bytes.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.S3Backend.Trash] Upload error: %w", err)
+	}
+	var copied []string
+	for _, obj := range objects {
+		name := entry.ID + "/" + obj.Name
+		if _, err := b.Copy(dir, obj.Name, b.TrashBucket, name); err != nil {
+			b.discardTrash(entry.ID, copied)
+			return entry, fmt.Errorf("[DataManagement.main.S3Backend.Trash] Copy error: %w", err)
+		}
+		copied = append(copied, name)
+	}
+
+	// delete copied objects, the trash entry is rolled back if nothing was
+	// deleted, otherwise it is kept to allow restore of deleted objects
+	for idx, obj := range objects {
+		if err := b.Client.DeleteObject(dir, obj.Name, ""); err != nil {
+			if idx == 0 {
+				b.discardTrash(entry.ID, copied)
+			} else {
+				log.Printf("WARNING: %d of %d objects of %s are moved to trash %s", idx, len(objects), dir, entry.ID)
+			}
+			return entry, fmt.Errorf("[DataManagement.main.S3Backend.Trash] DeleteObject error: %w", err)
+		}
+	}
+	if entry.IsDirectory {
+		if err := b.Client.DeleteBucket(dir); err != nil {
+			log.Printf("WARNING: objects of %s are moved to trash %s but bucket is not deleted", dir, entry.ID)
+			return entry, fmt.Errorf("[DataManagement.main.S3Backend.Trash] DeleteBucket error: %w", err)
+		}
+	}
+	log.Printf("INFO: moved %s/%s to trash %s", dir, file, entry.ID)
+	return entry, nil
+}
+
+// TrashList implements Trasher interface, it lists trash entries from the
+// latest to the oldest one
+func (b *S3Backend) TrashList() ([]TrashEntry, error) {
+	entries := []TrashEntry{}
+	if b.TrashBucket == "" {
+		return entries, nil
+	}
+	objects, err := b.List(b.TrashBucket, 1)
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.S3Backend.TrashList] List error: %w", err)
+	}
+	for _, obj := range objects {
+		id, ok := strings.CutSuffix(obj.Name, ".json")
+		if obj.IsDirectory || !ok {
+			continue
+		}
+		entry, err := b.trashEntry(id)
+		if err != nil {
+			log.Printf("WARNING: unable to read trash entry %s: %v", id, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Deleted.After(entries[j].Deleted) })
+	return entries, nil
+}
+
+// Undelete implements Trasher interface, it copies objects of trash entry
+// back to their original bucket which is re-created if it was deleted
+func (b *S3Backend) Undelete(id string) (TrashEntry, error) {
+	entry, err := b.trashEntry(id)
+	if err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.S3Backend.Undelete] trashEntry error: %w", err)
+	}
+	if entry.IsDirectory {
+		if _, err := b.Stat(entry.Dir, ""); err == nil {
+			return entry, fmt.Errorf("%w: %s", ErrTransferConflict, entry.Dir)
+		}
+		if err := b.Create(entry.Dir); err != nil {
+			return entry, err
+		}
+	} else if _, err := b.Stat(entry.Dir, entry.File); err == nil {
+		return entry, fmt.Errorf("%w: %s/%s", ErrTransferConflict, entry.Dir, entry.File)
+	}
+	objects, err := b.trashObjects(id)
+	if err != nil {
+		return entry, fmt.Errorf("[DataManagement.main.S3Backend.Undelete] trashObjects error: %w", err)
+	}
+	for _, obj := range objects {
+		if _, err := b.Copy(b.TrashBucket, obj.Name, entry.Dir, strings.TrimPrefix(obj.Name, id+"/")); err != nil {
+			return entry, fmt.Errorf("[DataManagement.main.S3Backend.Undelete] Copy error: %w", err)
+		}
+	}
+	if err := b.Purge(id); err != nil {
+		log.Printf("WARNING: unable to remove trash entry %s: %v", id, err)
+	}
+	log.Printf("INFO: restored %s/%s from trash %s", entry.Dir, entry.File, id)
+	return entry, nil
+}
+
+// Purge implements Trasher interface, it permanently removes objects of
+// trash entry
+func (b *S3Backend) Purge(id string) error {
+	if _, err := b.trashEntry(id); err != nil {
+		return fmt.Errorf("[DataManagement.main.S3Backend.Purge] trashEntry error: %w", err)
+	}
+	objects, err := b.trashObjects(id)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.S3Backend.Purge] trashObjects error: %w", err)
+	}
+	for _, obj := range objects {
+		if err := b.Client.DeleteObject(b.TrashBucket, obj.Name, ""); err != nil {
+			return fmt.Errorf("[DataManagement.main.S3Backend.Purge] DeleteObject error: %w", err)
+		}
+	}
+	if err := b.Client.DeleteObject(b.TrashBucket, id+".json", ""); err != nil {
+		return fmt.Errorf("[DataManagement.main.S3Backend.Purge] DeleteObject error: %w", err)
+	}
+	return nil
+}
+
+// awsObjectReader implements io.ReadSeekCloser for AWS S3 objects by
+// issuing ranged GET requests starting at current read offset
+type awsObjectReader struct {
+	client    *aws3.S3
+	bucket    string
+	object    string
+	versionID string
+	size      int64
+	offset    int64
+	body      io.ReadCloser
+}
+
+// Read implements io.Reader interface
+func (r *awsObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		input := &aws3.GetObjectInput{
+			Bucket: aws.String(r.bucket),
+			Key:    aws.String(r.object),
+			Range:  aws.String(fmt.Sprintf("bytes=%d-", r.offset)),
+		}
+		if r.versionID != "" {
+			input.VersionId = aws.String(r.versionID)
+		}
+		out, err := r.client.GetObject(input)
+		if err != nil {
+			return 0, fmt.Errorf("[DataManagement.main.awsObjectReader.Read] aws.GetObject error: %w", err)
+		}
+		r.body = out.Body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker interface
+func (r *awsObjectReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.offset + offset
+	case io.SeekEnd:
+		pos = r.size + offset
+	default:
+		return 0, errors.New("[DataManagement.main.awsObjectReader.Seek] invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("[DataManagement.main.awsObjectReader.Seek] negative position")
+	}
+	if pos != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = pos
+	return pos, nil
+}
+
+// Close implements io.Closer interface
+func (r *awsObjectReader) Close() error {
+	if r.body != nil {
+		err := r.body.Close()
+		r.body = nil
+		return err
+	}
+	return nil
+}
+
+// helper function to extract checksums from S3 object user metadata, the
+// user metadata keys may or may not contain X-Amz-Meta- prefix
+func s3Checksums(userMetadata map[string]string) map[string]string {
+	sums := make(map[string]string)
+	for key, val := range userMetadata {
+		key = strings.ToLower(key)
+		key = strings.TrimPrefix(key, "x-amz-meta-")
+		switch key {
+		case ChecksumSHA256, ChecksumAdler32, ChecksumCRC32C:
+			sums[key] = val
+		}
+	}
+	if len(sums) == 0 {
+		return nil
+	}
+	return sums
+}
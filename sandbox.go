@@ -0,0 +1,106 @@
+package main
+
+// sandbox module provides safe resolution of user supplied paths
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ForbiddenPathError represents error of user supplied path which escapes its root area
+type ForbiddenPathError struct {
+	Path   string // user supplied path
+	Reason string // reason why path is forbidden
+}
+
+// Error implements error interface
+func (e *ForbiddenPathError) Error() string {
+	return fmt.Sprintf("forbidden path '%s': %s", e.Path, e.Reason)
+}
+
+// resolvePath joins given path elements to the root area and ensures that
+// resulting path stays within the root. It rejects absolute paths, parent
+// directory references and symbolic links which point outside of the root.
+// The root itself is trusted, e.g. it comes from server configuration or
+// from data location attribute of meta-data record.
+func resolvePath(root string, elems ...string) (string, error) {
+	for _, elem := range elems {
+		if elem == "" {
+			continue
+		}
+		if strings.ContainsRune(elem, 0) {
+			return "", &ForbiddenPathError{Path: elem, Reason: "contains NUL character"}
+		}
+		if filepath.IsAbs(elem) || strings.HasPrefix(elem, "/") || strings.HasPrefix(elem, "\\") {
+			return "", &ForbiddenPathError{Path: elem, Reason: "absolute path is not allowed"}
+		}
+		for _, part := range strings.FieldsFunc(elem, isPathSeparator) {
+			if part == ".." {
+				return "", &ForbiddenPathError{Path: elem, Reason: "parent directory reference is not allowed"}
+			}
+		}
+	}
+	root = filepath.Clean(root)
+	path := filepath.Join(append([]string{root}, elems...)...)
+	if !withinRoot(root, path) {
+		return "", &ForbiddenPathError{Path: filepath.Join(elems...), Reason: "path escapes root area"}
+	}
+
+	// resolve symbolic links of root and of existing part of the path
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		// root does not exist yet, nothing can escape from it
+		return path, nil
+	}
+	realPath, err := evalExistingSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("[DataManagement.main.resolvePath] evalExistingSymlinks error: %w", err)
+	}
+	if !withinRoot(realRoot, realPath) {
+		return "", &ForbiddenPathError{Path: filepath.Join(elems...), Reason: "symbolic link escapes root area"}
+	}
+	return path, nil
+}
+
+// helper function to check if given path is within root area
+func withinRoot(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	return true
+}
+
+// helper function to resolve symbolic links of the longest existing prefix
+// of given path, the non-existing remainder is appended as-is
+func evalExistingSymlinks(path string) (string, error) {
+	var rest []string
+	for {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{real}, rest...)...), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, rest...)...), nil
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// helper function to check path separators of both unix and windows styles
+func isPathSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
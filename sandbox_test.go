@@ -0,0 +1,97 @@
+package main
+
+// sandbox tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestResolvePath tests resolution of user supplied paths within root area
+func TestResolvePath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "dir"), filepath.Join(root, "in")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		elems     []string
+		path      string // expected path relative to root
+		forbidden bool
+	}{
+		{"file", []string{"dir", "file.h5"}, "dir/file.h5", false},
+		{"nested", []string{"dir", "a/b/file.h5"}, "dir/a/b/file.h5", false},
+		{"empty elements", []string{"", "dir", ""}, "dir", false},
+		{"missing dirs", []string{"missing", "new/file"}, "missing/new/file", false},
+		{"dot", []string{"dir", "./file"}, "dir/file", false},
+		{"parent", []string{"..", "file"}, "", true},
+		{"nested parent", []string{"dir", "a/../../../file"}, "", true},
+		{"parent within root", []string{"dir", "a/../file"}, "", true},
+		{"windows parent", []string{"dir", "..\\file"}, "", true},
+		{"absolute", []string{"/etc/passwd"}, "", true},
+		{"absolute file", []string{"dir", "/etc/passwd"}, "", true},
+		{"windows absolute", []string{"\\etc"}, "", true},
+		{"nul", []string{"dir", "file\x00.h5"}, "", true},
+		{"symlink escape", []string{"out", "file"}, "", true},
+		{"symlink escape of dir", []string{"out"}, "", true},
+		{"symlink within root", []string{"in", "file"}, "in/file", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := resolvePath(root, tt.elems...)
+			if tt.forbidden {
+				var perr *ForbiddenPathError
+				if !errors.As(err, &perr) {
+					t.Fatalf("expected forbidden path error, got path %q error %v", path, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if expect := filepath.Join(root, filepath.FromSlash(tt.path)); path != expect {
+				t.Fatalf("expected path %q, got %q", expect, path)
+			}
+		})
+	}
+}
+
+// TestResolveReservedArea tests that reserved area of file-system storage is
+// not accessible via user supplied paths
+func TestResolveReservedArea(t *testing.T) {
+	client := NewLocalFsClient(t.TempDir())
+	tests := []struct {
+		name      string
+		elems     []string
+		forbidden bool
+	}{
+		{"reserved area", []string{metaArea}, true},
+		{"reserved file", []string{metaArea, "attrs/file.json"}, true},
+		{"reserved via dot", []string{".", metaArea + "/trash"}, true},
+		{"reserved name in sub-directory", []string{"dir", metaArea}, false},
+		{"similar name", []string{metaArea + "2"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.resolve(tt.elems...)
+			var perr *ForbiddenPathError
+			if forbidden := errors.As(err, &perr); forbidden != tt.forbidden {
+				t.Fatalf("expected forbidden %v, got error %v", tt.forbidden, err)
+			}
+			if !tt.forbidden && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
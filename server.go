@@ -8,10 +8,11 @@ import (
 	"embed"
 	"fmt"
 	"log"
-	"strings"
+	"slices"
+	"time"
 
+	authz "github.com/CHESSComputing/golib/authz"
 	srvConfig "github.com/CHESSComputing/golib/config"
-	s3 "github.com/CHESSComputing/golib/s3"
 	server "github.com/CHESSComputing/golib/server"
 	"github.com/gin-gonic/gin"
 )
@@ -21,63 +22,140 @@ import (
 //go:embed static
 var StaticFs embed.FS
 
-// our s3 client
-var s3Client s3.S3Client
-
 // helper function to setup our server router
 func setupRouter() *gin.Engine {
-	if srvConfig.Config.DataManagement.S3.Name != "" {
-		return setupS3Router()
-	}
-	return setupFSRouter()
-}
-
-// helper function to setup server router for S3 backend
-func setupS3Router() *gin.Engine {
 	routes := []server.Route{
+		// signed URLs are authorized by their signatures
+		{Method: "GET", Path: "/signed/:area/:dir/:file", Handler: SignedHandler},
+		{Method: "PUT", Path: "/signed/:area/:dir/:file", Handler: SignedHandler},
+
 		{Method: "GET", Path: "/data", Handler: DataLocationHandler, Authorized: true},
 		{Method: "GET", Path: "/files", Handler: DataFilesHandler, Authorized: true},
-		{Method: "GET", Path: "/storage", Handler: S3StorageHandler, Authorized: true},
-		{Method: "GET", Path: "/storage/:bucket/:object", Handler: S3StorageHandler, Authorized: true},
+		{Method: "GET", Path: "/locations", Handler: DataLocationsHandler, Authorized: true},
+		{Method: "GET", Path: "/events", Handler: EventsHandler, Authorized: true},
+		{Method: "GET", Path: "/archive", Handler: ArchiveHandler, Authorized: true},
+		{Method: "GET", Path: "/archive/:area/:dir", Handler: ArchiveStorageHandler, Authorized: true},
+		{Method: "GET", Path: "/versions/:area/:dir", Handler: VersioningHandler, Authorized: true},
+		{Method: "GET", Path: "/versions/:area/:dir/:file", Handler: VersionsHandler, Authorized: true},
+		{Method: "GET", Path: "/presign/:area/:dir/:file", Handler: PresignHandler, Authorized: true},
+		{Method: "GET", Path: "/lifecycle/:area/:dir", Handler: LifecycleHandler, Authorized: true},
+		{Method: "GET", Path: "/retention/:area/:dir/:file", Handler: RetentionHandler, Authorized: true},
+		{Method: "GET", Path: "/trash/:area", Handler: TrashHandler, Authorized: true},
+		{Method: "GET", Path: "/storage", Handler: StorageAreasHandler, Authorized: true},
+		{Method: "GET", Path: "/storage/:area", Handler: StorageHandler, Authorized: true},
+		{Method: "GET", Path: "/storage/:area/:dir", Handler: StorageHandler, Authorized: true},
+		{Method: "GET", Path: "/storage/:area/:dir/:file", Handler: StorageHandler, Authorized: true},
 
-		{Method: "POST", Path: "/storage/:bucket", Handler: S3PostHandler, Authorized: true, Scope: "write"},
-		{Method: "POST", Path: "/storage/:bucket/:object", Handler: S3PostHandler, Authorized: true, Scope: "write"},
+		{Method: "POST", Path: "/storage/:area/:dir", Handler: StoragePostHandler, Authorized: true, Scope: "write"},
+		{Method: "POST", Path: "/storage/:area/:dir/:file", Handler: StoragePostHandler, Authorized: true, Scope: "write"},
 
-		{Method: "DELETE", Path: "/storage/:bucket", Handler: S3DeleteHandler, Authorized: true, Scope: "delete"},
-		{Method: "DELETE", Path: "/storage/:bucket/:object", Handler: S3DeleteHandler, Authorized: true, Scope: "delete"},
-	}
-	r := server.Router(routes, nil, "static", srvConfig.Config.DataManagement.WebServer)
-	return r
-}
+		{Method: "PUT", Path: "/versions/:area/:dir", Handler: VersioningPutHandler, Authorized: true, Scope: "write"},
+		{Method: "POST", Path: "/versions/:area/:dir/:file", Handler: VersionRestoreHandler, Authorized: true, Scope: "write"},
+		{Method: "POST", Path: "/presign/:area/:dir/:file", Handler: PresignHandler, Authorized: true, Scope: "write"},
+		{Method: "PUT", Path: "/lifecycle/:area/:dir", Handler: LifecyclePutHandler, Authorized: true, Scope: "write"},
+		{Method: "PUT", Path: "/retention/:area/:dir/:file", Handler: RetentionPutHandler, Authorized: true, Scope: "write"},
+		{Method: "POST", Path: "/trash/:area/:id", Handler: UndeleteHandler, Authorized: true, Scope: "write"},
+		{Method: "POST", Path: "/copy", Handler: CopyHandler, Authorized: true, Scope: "write"},
+		// move removes the source file, i.e. MoveHandler also requires delete scope
+		{Method: "POST", Path: "/move", Handler: MoveHandler, Authorized: true, Scope: "write"},
 
-// helper function to setup our server router for file-system backend
-func setupFSRouter() *gin.Engine {
-	routes := []server.Route{
-		{Method: "GET", Path: "/data", Handler: DataLocationHandler, Authorized: true},
-		{Method: "GET", Path: "/files", Handler: DataFilesHandler, Authorized: true},
-		{Method: "GET", Path: "/storage", Handler: FsStorageHandler, Authorized: true},
-		{Method: "GET", Path: "/storage/:dir/:file", Handler: FsStorageHandler, Authorized: true},
+		{Method: "DELETE", Path: "/storage/:area/:dir", Handler: StorageDeleteHandler, Authorized: true, Scope: "delete"},
+		{Method: "DELETE", Path: "/storage/:area/:dir/:file", Handler: StorageDeleteHandler, Authorized: true, Scope: "delete"},
+
+		// release of governance retention and legal hold requires admin scope
+		{Method: "DELETE", Path: "/retention/:area/:dir/:file", Handler: RetentionDeleteHandler, Authorized: true, Scope: dmConfig.Lifecycle.ReleaseScope},
+		{Method: "DELETE", Path: "/trash/:area/:id", Handler: TrashDeleteHandler, Authorized: true, Scope: "delete"},
+		{Method: "DELETE", Path: "/metadata/cache", Handler: MetaDataCacheDeleteHandler, Authorized: true, Scope: "delete"},
+
+		{Method: "POST", Path: "/uploads", Handler: UploadCreateHandler, Authorized: true, Scope: "write"},
+		{Method: "GET", Path: "/uploads/:id", Handler: UploadStatusHandler, Authorized: true, Scope: "write"},
+		{Method: "PUT", Path: "/uploads/:id/:chunk", Handler: UploadChunkHandler, Authorized: true, Scope: "write"},
+		{Method: "POST", Path: "/uploads/:id", Handler: UploadCompleteHandler, Authorized: true, Scope: "write"},
+		{Method: "DELETE", Path: "/uploads/:id", Handler: UploadAbortHandler, Authorized: true, Scope: "delete"},
+	}
+	// audit log is accessible only with admin scope of access token
+	routes = append(routes, server.Route{Method: "GET", Path: "/audit", Handler: AuditHandler, Authorized: true, Scope: dmConfig.Audit.Scope})
 
-		{Method: "POST", Path: "/storage/:dir", Handler: FsPostHandler, Authorized: true, Scope: "write"},
-		{Method: "POST", Path: "/storage/:dir/:file", Handler: FsPostHandler, Authorized: true, Scope: "write"},
+	// storage mutations and sensitive reads are recorded in audit log,
+	// server.Router applies authorization before any handler of the route
+	// therefore audited routes are registered separately
+	routes, audited := auditRoutes(routes)
+	webServer := srvConfig.Config.DataManagement.WebServer
+	r := server.Router(routes, nil, "static", webServer)
+	registerAuditRoutes(r, audited, webServer.Verbose)
 
-		{Method: "DELETE", Path: "/storage/:dir", Handler: FsDeleteHandler, Authorized: true, Scope: "delete"},
-		{Method: "DELETE", Path: "/storage/:dir/:file", Handler: FsDeleteHandler, Authorized: true, Scope: "delete"},
+	// server.Router does not support HEAD routes, therefore we register them
+	// within read scope group of authorized routes
+	headRoutes := []server.Route{
+		{Method: "HEAD", Path: "/data", Handler: DataLocationHandler, Authorized: true},
+		{Method: "HEAD", Path: "/storage/:area/:dir", Handler: StorageHandler, Authorized: true},
+		{Method: "HEAD", Path: "/storage/:area/:dir/:file", Handler: StorageHandler, Authorized: true},
+	}
+	authorizedRead := r.Group("/")
+	authorizedRead.Use(authz.ScopeTokenMiddleware("read", srvConfig.Config.Authz.ClientID, webServer.Verbose))
+	for _, route := range headRoutes {
+		authorizedRead.HEAD(route.Path, route.Handler)
 	}
-	r := server.Router(routes, nil, "static", srvConfig.Config.DataManagement.WebServer)
 	return r
 }
 
 // Server defines our HTTP server
 func Server() {
-	// Initialize the appropriate S3 client.
-	var err error
-	if srvConfig.Config.DataManagement.S3.Name != "" {
-		s3Client, err = s3.InitializeS3Client(strings.ToLower(srvConfig.Config.DataManagement.S3.Name))
-		if err != nil {
-			log.Fatalf("Failed to initialize S3 client %s, error %v", srvConfig.Config.DataManagement.S3.Name, err)
+	// initialize audit log of storage mutations
+	if err := initAudit(); err != nil {
+		log.Fatalf("Failed to initialize audit log, error %v", err)
+	}
+
+	// initialize storage areas
+	if err := initStorageAreas(); err != nil {
+		log.Fatalf("Failed to initialize storage areas, error %v", err)
+	}
+
+	// initialize meta-data client
+	if err := initMetaDataClient(); err != nil {
+		log.Fatalf("Failed to initialize meta-data client, error %v", err)
+	}
+
+	// initialize file catalog of DID data locations
+	if err := initCatalog(); err != nil {
+		log.Fatalf("Failed to initialize file catalog, error %v", err)
+	}
+
+	// initialize file-system watcher of storage areas and data locations
+	if err := initWatcher(); err != nil {
+		log.Fatalf("Failed to initialize file-system watcher, error %v", err)
+	}
+
+	// initialize HMAC secret of signed URLs
+	if err := initPresign(); err != nil {
+		log.Fatalf("Failed to initialize signed URLs, error %v", err)
+	}
+
+	// initialize resumable uploads for storage areas which support them
+	stores := make(map[string]ChunkStore)
+	for _, area := range storageAreas {
+		if !slices.Contains(area.Capabilities, "uploads") {
+			continue
+		}
+		switch backend := area.Backend.(type) {
+		case *S3Backend:
+			stores[area.Name] = &S3ChunkStore{Backend: backend}
+		case FsClient:
+			stores[area.Name] = &FsChunkStore{Area: dmConfig.Uploads.StagingArea, Client: backend}
 		}
 	}
+	expire := time.Duration(dmConfig.Uploads.Expire) * time.Second
+	var err error
+	uploadManager, err = NewUploadManager(dmConfig.Uploads.StagingArea, expire, dmConfig.Uploads.MaxChunkSize, stores)
+	if err != nil {
+		log.Fatalf("Failed to initialize upload manager, error %v", err)
+	}
+	go uploadManager.Run(time.Minute)
+
+	// initialize lifecycle rules and retention policies of storage areas
+	if err := initLifecycle(); err != nil {
+		log.Fatalf("Failed to initialize lifecycle rules, error %v", err)
+	}
 
 	// setup web router and start the service
 	r := setupRouter()
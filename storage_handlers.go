@@ -0,0 +1,347 @@
+package main
+
+// storage handlers module provides storage end-points which are served by
+// storage backends of named storage areas, e.g. local file-system or S3
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AreaParams represents site URI parameter for /storage/:area end-point
+type AreaParams struct {
+	Area string `uri:"area" binding:"required"`
+}
+
+// StorageParams represents site URI parameter for /storage/:area/:dir end-point,
+// for S3 backend the dir represents S3 bucket
+type StorageParams struct {
+	AreaParams
+	Dir string `uri:"dir" binding:"required"`
+}
+
+// FileStorageParams represents site URI parameter for /storage/:area/:dir/:file end-point,
+// for S3 backend the file represents S3 object
+type FileStorageParams struct {
+	StorageParams
+	File string `uri:"file" binding:"required"`
+}
+
+// helper function to lookup storage backend of storage area of HTTP request
+func areaBackend(c *gin.Context) (StorageBackend, bool) {
+	var params AreaParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return nil, false
+	}
+	area, err := storageArea(params.Area)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return nil, false
+	}
+	return area.Backend, true
+}
+
+// GET handlers
+
+// StorageAreasHandler provides access to GET /storage end-point
+/*
+```
+# get list of storage areas along with their backend type and capabilities
+curl http://localhost:8340/storage
+```
+*/
+func StorageAreasHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": listStorageAreas()})
+}
+
+// StorageHandler provides access to GET /storage/:area/:dir/:file end-point
+/*
+```
+# get list of dirs (S3 buckets) of storage area
+curl http://localhost:8340/storage/raw
+# get list of specific dir (S3 bucket) in a storage area
+curl http://localhost:8340/storage/raw/dir
+# get first 100 HDF5 files of dir and its sub-directories ordered by modification time
+curl "http://localhost:8340/storage/raw/dir?recursive=true&ext=.h5&sort=mtime&limit=100"
+# get next page of the listing using next_cursor of previous page
+curl "http://localhost:8340/storage/raw/dir?recursive=true&ext=.h5&sort=mtime&limit=100&cursor=<next_cursor>"
+# get concrete file (S3 object) from storage dir
+curl http://localhost:8340/storage/raw/dir/archive.zip
+# get first KB of the file or resume interrupted download
+curl -H "Range: bytes=0-1023" http://localhost:8340/storage/raw/dir/archive.zip
+curl -C - -o archive.zip http://localhost:8340/storage/raw/dir/archive.zip
+# get size, modification time, content type, checksums and ETag of the file
+# (S3 object) or dir (S3 bucket) without transferring its content
+curl -I http://localhost:8340/storage/raw/dir/archive.zip
+curl "http://localhost:8340/storage/raw/dir/archive.zip?stat=true"
+curl "http://localhost:8340/storage/raw/dir?stat=true"
+# get prior version of the file (S3 object)
+curl "http://localhost:8340/storage/raw/dir/archive.zip?version_id=<version_id>"
+```
+*/
+func StorageHandler(c *gin.Context) {
+	storage, ok := areaBackend(c)
+	if !ok {
+		return
+	}
+	var fParams FileStorageParams
+	var dParams StorageParams
+	opts, err := parseListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindUri(&fParams); err == nil {
+		if vid := c.Query("version_id"); vid != "" {
+			storageVersion(c, storage, fParams.Dir, fParams.File, vid)
+			return
+		}
+		if isStatRequest(c) {
+			storageStat(c, storage, fParams.Dir, fParams.File)
+			return
+		}
+		// stream file content, it supports partial and resumable downloads
+		reader, meta, err := storage.Open(fParams.Dir, fParams.File)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+		defer reader.Close()
+		serveContent(c, fParams.File, meta, reader)
+		return
+	} else if err := c.ShouldBindUri(&dParams); err == nil {
+		if isStatRequest(c) {
+			storageStat(c, storage, dParams.Dir, "")
+			return
+		}
+		listingResponse(c, storage, dParams.Dir, opts)
+		return
+	}
+	// get list of dirs
+	opts.Depth = 1
+	listingResponse(c, storage, "", opts)
+}
+
+// helper function to write metadata of file or dir of storage backend to
+// HTTP response
+func storageStat(c *gin.Context, storage StorageBackend, dir, file string) {
+	meta, err := storage.Stat(dir, file)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	statResponse(c, meta)
+}
+
+// helper function to write page of storage listing to HTTP response, the
+// cursor of the next page is provided via next_cursor attribute and
+// X-Next-Cursor HTTP header, the truncated flag of partial listing is provided
+// via truncated attribute and X-Truncated HTTP header
+func listingResponse(c *gin.Context, storage StorageBackend, dir string, opts ListOptions) {
+	data, cursor, truncated, err := listPage(c.Request.Context(), storage, dir, opts)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if cursor != "" {
+		c.Header("X-Next-Cursor", cursor)
+	}
+	if truncated {
+		c.Header("X-Truncated", "true")
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": data, "next_cursor": cursor, "truncated": truncated})
+}
+
+// POST handlers
+
+// StoragePostHandler provides access to POST /storage/:area/:dir end-point
+/*
+```
+curl -X POST http://localhost:8340/storage/raw/dir
+curl -X POST http://localhost:8340/storage/raw/dir/archive.zip \
+     -F "file=@/path/test.zip" \
+     -H "Content-Type: multipart/form-data"
+# upload file and verify its checksum
+curl -X POST http://localhost:8340/storage/raw/dir/archive.zip \
+     -F "file=@/path/test.zip" \
+     -H "X-Checksum-SHA256: $(sha256sum /path/test.zip | cut -d ' ' -f 1)"
+ ```
+*/
+func StoragePostHandler(c *gin.Context) {
+	storage, ok := areaBackend(c)
+	if !ok {
+		return
+	}
+	var dParams StorageParams
+	var fParams FileStorageParams
+	if err := c.ShouldBindUri(&dParams); err == nil && c.Param("file") == "" {
+		if err := storage.Create(dParams.Dir); err == nil {
+			msg := fmt.Sprintf("Dir %s created successfully", dParams.Dir)
+			c.JSON(http.StatusOK, gin.H{"status": "ok", "msg": msg})
+		} else {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		}
+	} else if err := c.ShouldBindUri(&fParams); err == nil {
+		// expected checksums of uploaded file
+		expect, err := expectedChecksums(c.Request)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+		// retained file can not be replaced
+		if !retentionGuard(c, fParams.Area, fParams.Dir, fParams.File) {
+			return
+		}
+
+		// single file
+		file, err := c.FormFile("file")
+		if err != nil {
+			log.Println("ERROR: fail to get file from HTTP form", err)
+			c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+		log.Printf("INFO: uploading file %s", file.Filename)
+
+		// Upload the file to specific dst.
+		reader, err := file.Open()
+		if err != nil {
+			log.Println("ERROR: fail to open file", err)
+			c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+		defer reader.Close()
+		size := file.Size
+		// content type of the multipart part, if it is not provided or
+		// generic the storage backend detects it from the file content
+		ctype := file.Header.Get("Content-Type")
+
+		if meta, err := storage.Upload(fParams.Dir, fParams.File, ctype, reader, size, expect); err == nil {
+			auditMeta(c, meta.Size, meta.Checksums)
+			msg := fmt.Sprintf("File %s/%s uploaded successfully", fParams.Dir, fParams.File)
+			c.JSON(http.StatusOK, gin.H{"status": "ok", "msg": msg, "data": meta})
+		} else {
+			log.Println("ERROR: fail to upload file", err)
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		}
+	} else {
+		log.Println("ERROR: fail to bind HTTP parameters", err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+	}
+}
+
+// DELETE handlers
+
+// StorageDeleteHandler provides access to DELETE /storage/:area/:dir end-point,
+// the deleted files are moved to trash area of the storage if it is enabled
+/*
+```
+# delete empty dir (S3 bucket)
+curl -X DELETE http://localhost:8340/storage/raw/dir
+# list files which would be deleted along with non-empty dir
+curl -X DELETE "http://localhost:8340/storage/raw/dir?recursive=true&dry_run=true"
+# delete non-empty dir along with its files
+curl -X DELETE "http://localhost:8340/storage/raw/dir?recursive=true"
+curl -X DELETE http://localhost:8340/storage/raw/dir/archive.zip
+# permanently delete version of the file (S3 object)
+curl -X DELETE "http://localhost:8340/storage/raw/dir/archive.zip?version_id=<version_id>"
+```
+*/
+func StorageDeleteHandler(c *gin.Context) {
+	storage, ok := areaBackend(c)
+	if !ok {
+		return
+	}
+	area, err := storageArea(c.Param("area"))
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	var dParams StorageParams
+	var fParams FileStorageParams
+	if err := c.ShouldBindUri(&dParams); err == nil && c.Param("file") == "" {
+		storageDelete(c, area, dParams.Dir, "")
+	} else if err := c.ShouldBindUri(&fParams); err == nil {
+		if vid := c.Query("version_id"); vid != "" {
+			storageDeleteVersion(c, storage, fParams.Dir, fParams.File, vid)
+			return
+		}
+		storageDelete(c, area, fParams.Dir, fParams.File)
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+	}
+}
+
+// helper function to delete a file or a directory (S3 bucket) if file is
+// empty. The non-empty directory is deleted only if recursive deletion is
+// requested, the dry-run reports entries which would be deleted and deleted
+// entries are moved to trash area if it is enabled.
+func storageDelete(c *gin.Context, area *StorageArea, dir, file string) {
+	recursive, _ := strconv.ParseBool(c.Query("recursive"))
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	var entries []Metadata
+	var truncated bool
+	if file == "" {
+		depth := 1
+		if dryRun {
+			depth = -1
+		}
+		var err error
+		entries, truncated, err = listContext(c.Request.Context(), area.Backend, dir, depth)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+		if len(entries) > 0 && !recursive {
+			err := fmt.Errorf("%w: %s, use recursive=true to delete it along with its content", ErrNotEmpty, dir)
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+	} else if dryRun {
+		meta, err := area.Backend.Stat(dir, file)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+		meta.Name = file
+		entries = append(entries, meta)
+	}
+	if !retentionGuard(c, area.Name, dir, file) {
+		return
+	}
+	trasher, trash := areaTrasher(area)
+	if dryRun {
+		if entries == nil {
+			entries = []Metadata{}
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "dry_run": true, "trash": trash, "data": entries, "truncated": truncated})
+		return
+	}
+	name := dir
+	if file != "" {
+		name = dir + "/" + file
+	}
+	if trash {
+		entry, err := trasher.Trash(dir, file)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+			return
+		}
+		auditMeta(c, entry.Size, nil)
+		msg := fmt.Sprintf("%s moved to trash successfully", name)
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "msg": msg, "data": entry})
+		return
+	}
+	if err := area.Backend.Delete(dir, file); err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	msg := fmt.Sprintf("%s deleted successfully", name)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "msg": msg})
+}
@@ -0,0 +1,351 @@
+package main
+
+// transfer module provides copy and move of files within and across storage
+// areas
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"slices"
+	"strings"
+)
+
+// ErrTransferConflict represents error of existing destination of transfer
+var ErrTransferConflict = errors.New("destination already exists")
+
+// overwrite policies of transfers
+const (
+	OverwriteNever     = "never"     // fail if destination exists
+	OverwriteAlways    = "always"    // replace existing destination
+	OverwriteNewer     = "newer"     // replace destination only if source is newer
+	OverwriteDifferent = "different" // replace destination only if its content differs
+)
+
+// transfer methods
+const (
+	MethodRename = "rename"      // rename within storage backend
+	MethodCopy   = "server-copy" // server side copy within storage backend
+	MethodStream = "stream"      // stream content between storage backends
+)
+
+// transfer actions
+const (
+	ActionCopy = "copy"
+	ActionMove = "move"
+	ActionSkip = "skip"
+)
+
+// TransferPath represents file (S3 object) of storage area
+type TransferPath struct {
+	Area string `json:"area" binding:"required"`
+	Dir  string `json:"dir" binding:"required"` // directory or S3 bucket
+	File string `json:"file"`                   // file or S3 object, source file name is used if it is empty
+}
+
+// String provides string representation of transfer path
+func (p TransferPath) String() string {
+	return fmt.Sprintf("%s:%s/%s", p.Area, p.Dir, p.File)
+}
+
+// TransferRequest represents request to copy or move a file
+type TransferRequest struct {
+	Source      TransferPath `json:"source" binding:"required"`
+	Destination TransferPath `json:"destination" binding:"required"`
+	Overwrite   string       `json:"overwrite"`   // overwrite policy, by default existing destination is not replaced
+	SkipVerify  bool         `json:"skip_verify"` // do not verify checksums of transferred file
+	DryRun      bool         `json:"dry_run"`     // only report what would be done
+}
+
+// TransferResult represents outcome of transfer
+type TransferResult struct {
+	Source      TransferPath `json:"source"`
+	Destination TransferPath `json:"destination"`
+	Action      string       `json:"action"`           // copy, move or skip
+	Method      string       `json:"method,omitempty"` // rename, server-copy or stream
+	Reason      string       `json:"reason,omitempty"` // reason of skipped transfer
+	Verified    bool         `json:"verified"`         // checksums of destination are verified
+	DryRun      bool         `json:"dry_run,omitempty"`
+	Data        *Metadata    `json:"data,omitempty"` // metadata of destination file
+}
+
+// transfer copies (or moves) file between storage areas according to given
+// request. The file is renamed or copied server side if source and
+// destination belong to the same storage area, otherwise its content is
+// streamed between storage backends. The content of the destination is
+// verified against checksums of the source unless verification is skipped.
+func transfer(req TransferRequest, move bool) (TransferResult, error) {
+	if req.Destination.File == "" {
+		req.Destination.File = req.Source.File
+	}
+	result := TransferResult{
+		Source:      req.Source,
+		Destination: req.Destination,
+		Action:      ActionCopy,
+		DryRun:      req.DryRun,
+	}
+	if move {
+		result.Action = ActionMove
+	}
+	overwrite := req.Overwrite
+	if overwrite == "" {
+		overwrite = OverwriteNever
+	}
+	if !slices.Contains([]string{OverwriteNever, OverwriteAlways, OverwriteNewer, OverwriteDifferent}, overwrite) {
+		return result, fmt.Errorf("invalid overwrite policy '%s', supported policies: %s, %s, %s, %s",
+			overwrite, OverwriteNever, OverwriteAlways, OverwriteNewer, OverwriteDifferent)
+	}
+	if req.Source.File == "" {
+		return result, errors.New("source file is not provided")
+	}
+	if req.Source == req.Destination {
+		return result, errors.New("source and destination are the same")
+	}
+	srcArea, err := storageArea(req.Source.Area)
+	if err != nil {
+		return result, err
+	}
+	dstArea, err := storageArea(req.Destination.Area)
+	if err != nil {
+		return result, err
+	}
+	src, dst := srcArea.Backend, dstArea.Backend
+	if !slices.Contains(dst.Capabilities(), "write") {
+		return result, fmt.Errorf("%w: %s", ErrReadOnly, dstArea.Name)
+	}
+	if move && !slices.Contains(src.Capabilities(), "delete") {
+		return result, fmt.Errorf("%w: %s", ErrReadOnly, srcArea.Name)
+	}
+
+	// check source and destination files
+	srcMeta, err := src.Stat(req.Source.Dir, req.Source.File)
+	if err != nil {
+		return result, fmt.Errorf("[DataManagement.main.transfer] source Stat error: %w", err)
+	}
+	if srcMeta.IsDirectory {
+		return result, fmt.Errorf("%w: transfer of directory %s", ErrNotSupported, req.Source)
+	}
+	dstMeta, err := dst.Stat(req.Destination.Dir, req.Destination.File)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return result, fmt.Errorf("[DataManagement.main.transfer] destination Stat error: %w", err)
+	}
+	if err == nil {
+		if dstMeta.IsDirectory {
+			return result, fmt.Errorf("%w: %s is a directory", ErrTransferConflict, req.Destination)
+		}
+		switch overwrite {
+		case OverwriteNever:
+			return result, fmt.Errorf("%w: %s", ErrTransferConflict, req.Destination)
+		case OverwriteNewer:
+			if !srcMeta.ModTime.After(dstMeta.ModTime) {
+				result.Action = ActionSkip
+				result.Reason = "destination is up to date"
+			}
+		case OverwriteDifferent:
+			if same, err := sameContent(src, dst, req, srcMeta, dstMeta); err != nil {
+				return result, err
+			} else if same {
+				result.Action = ActionSkip
+				result.Reason = "destination has the same content"
+			}
+		}
+	}
+
+	// retained files can not be replaced or moved
+	if err == nil && result.Action != ActionSkip {
+		if err := checkRetention(dstArea, req.Destination.Dir, req.Destination.File); err != nil {
+			return result, err
+		}
+	}
+	if move {
+		if err := checkRetention(srcArea, req.Source.Dir, req.Source.File); err != nil {
+			return result, err
+		}
+	}
+
+	// choose transfer method
+	result.Method = MethodStream
+	if srcArea == dstArea {
+		result.Method = MethodCopy
+		if _, ok := src.(Mover); ok && move {
+			result.Method = MethodRename
+		}
+	}
+	if result.Action == ActionSkip {
+		result.Method = ""
+		result.Data = &dstMeta
+		return result, nil
+	}
+	if req.DryRun {
+		return result, nil
+	}
+
+	// perform transfer, renamed file keeps its content and does not need
+	// to be verified, otherwise the content is transferred to a temporary
+	// file which replaces destination only once it is verified, i.e. an
+	// existing destination is kept if transfer fails
+	if result.Method == MethodRename {
+		meta, err := src.(Mover).Move(req.Source.Dir, req.Source.File, req.Destination.Dir, req.Destination.File)
+		if err != nil {
+			return result, fmt.Errorf("[DataManagement.main.transfer] %s error: %w", result.Method, err)
+		}
+		result.Data = &meta
+		return result, nil
+	}
+	tmp := req.Destination
+	if tmp.File, err = transferTemp(req.Destination.File); err != nil {
+		return result, fmt.Errorf("[DataManagement.main.transfer] transferTemp error: %w", err)
+	}
+	var meta Metadata
+	if result.Method == MethodCopy {
+		meta, err = src.Copy(req.Source.Dir, req.Source.File, tmp.Dir, tmp.File)
+	} else {
+		meta, err = streamFile(src, dst, req.Source, tmp, srcMeta)
+	}
+	if err != nil {
+		removeTransferTemp(dst, tmp)
+		return result, fmt.Errorf("[DataManagement.main.transfer] %s error: %w", result.Method, err)
+	}
+	if !req.SkipVerify {
+		treq := req
+		treq.Destination = tmp
+		if err := verifyTransfer(src, dst, treq, srcMeta, meta); err != nil {
+			log.Printf("ERROR: transfer of %s to %s is not verified: %v", req.Source, req.Destination, err)
+			removeTransferTemp(dst, tmp)
+			return result, fmt.Errorf("[DataManagement.main.transfer] verification error: %w", err)
+		}
+		result.Verified = true
+	}
+	meta, err = placeTransfer(dst, tmp, req.Destination)
+	if err != nil {
+		removeTransferTemp(dst, tmp)
+		return result, fmt.Errorf("[DataManagement.main.transfer] placement error: %w", err)
+	}
+	result.Data = &meta
+	if move {
+		if err := src.Delete(req.Source.Dir, req.Source.File); err != nil {
+			return result, fmt.Errorf("[DataManagement.main.transfer] source Delete error: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// transferSuffix marks temporary files of transfers, such files are not
+// versioned since they never replace content of other files
+const transferSuffix = ".transfer-"
+
+// helper function to return name of temporary file of the transfer to given
+// destination file, it resides next to destination file
+func transferTemp(file string) (string, error) {
+	id, err := newTrashID()
+	if err != nil {
+		return "", err
+	}
+	dir, base := path.Split(file)
+	return dir + "." + base + transferSuffix + id, nil
+}
+
+// helper function to check if given file name is a temporary transfer file
+func isTransferTemp(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, transferSuffix)
+}
+
+// helper function to replace destination file with verified temporary file
+// of the transfer
+func placeTransfer(dst StorageBackend, tmp, dstPath TransferPath) (Metadata, error) {
+	if mover, ok := dst.(Mover); ok {
+		return mover.Move(tmp.Dir, tmp.File, dstPath.Dir, dstPath.File)
+	}
+	meta, err := dst.Copy(tmp.Dir, tmp.File, dstPath.Dir, dstPath.File)
+	if err != nil {
+		return meta, err
+	}
+	removeTransferTemp(dst, tmp)
+	return meta, nil
+}
+
+// helper function to remove temporary file of the transfer
+func removeTransferTemp(dst StorageBackend, tmp TransferPath) {
+	if err := dst.Delete(tmp.Dir, tmp.File); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("ERROR: unable to delete %s: %v", tmp, err)
+	}
+}
+
+// helper function to stream content of a file between storage backends, the
+// content is verified against known checksums of the source while it is
+// uploaded to destination
+func streamFile(src, dst StorageBackend, srcPath, dstPath TransferPath, srcMeta Metadata) (Metadata, error) {
+	reader, _, err := src.Open(srcPath.Dir, srcPath.File)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer reader.Close()
+	return dst.Upload(dstPath.Dir, dstPath.File, srcMeta.ContentType, reader, srcMeta.Size, srcMeta.Checksums)
+}
+
+// helper function to check if source and destination files have the same
+// content, i.e. they have the same size and checksums
+func sameContent(src, dst StorageBackend, req TransferRequest, srcMeta, dstMeta Metadata) (bool, error) {
+	err := verifyTransfer(src, dst, req, srcMeta, dstMeta)
+	if errors.Is(err, ErrChecksumMismatch) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// helper function to verify that destination file has the same size and
+// checksums as source file. The common checksums of both files are compared
+// if they are known, otherwise SHA-256 checksums are computed from content
+// of the files.
+func verifyTransfer(src, dst StorageBackend, req TransferRequest, srcMeta, dstMeta Metadata) error {
+	if srcMeta.Size != dstMeta.Size {
+		return fmt.Errorf("%w: destination size is %d, expect %d", ErrChecksumMismatch, dstMeta.Size, srcMeta.Size)
+	}
+	var compared bool
+	for alg, sum := range srcMeta.Checksums {
+		if val, ok := dstMeta.Checksums[alg]; ok {
+			if val != sum {
+				return fmt.Errorf("%w: destination %s checksum is %s, expect %s", ErrChecksumMismatch, alg, val, sum)
+			}
+			compared = true
+		}
+	}
+	if compared {
+		return nil
+	}
+	srcSum, err := fileChecksum(src, req.Source, srcMeta)
+	if err != nil {
+		return err
+	}
+	dstSum, err := fileChecksum(dst, req.Destination, dstMeta)
+	if err != nil {
+		return err
+	}
+	if srcSum != dstSum {
+		return fmt.Errorf("%w: destination sha256 checksum is %s, expect %s", ErrChecksumMismatch, dstSum, srcSum)
+	}
+	return nil
+}
+
+// helper function to provide SHA-256 checksum of a file, it is computed from
+// the file content if it is not known
+func fileChecksum(backend StorageBackend, path TransferPath, meta Metadata) (string, error) {
+	if sum, ok := meta.Checksums[ChecksumSHA256]; ok {
+		return sum, nil
+	}
+	reader, _, err := backend.Open(path.Dir, path.File)
+	if err != nil {
+		return "", fmt.Errorf("[DataManagement.main.fileChecksum] Open error: %w", err)
+	}
+	defer reader.Close()
+	summer := NewChecksummer(ChecksumSHA256)
+	if _, err := io.Copy(summer, reader); err != nil {
+		return "", fmt.Errorf("[DataManagement.main.fileChecksum] io.Copy error: %w", err)
+	}
+	return summer.Sums()[ChecksumSHA256], nil
+}
@@ -0,0 +1,76 @@
+package main
+
+// transfer handlers module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CopyHandler provides access to POST /copy end-point
+/*
+```
+# copy file to another directory of the same storage area
+curl -X POST http://localhost:8340/copy \
+     -H "Content-Type: application/json" \
+     -d '{"source":{"area":"raw", "dir":"dir", "file":"scan.h5"}, "destination":{"area":"raw", "dir":"reduced"}}'
+# copy file to S3 bucket replacing existing object only if its content is different
+curl -X POST http://localhost:8340/copy \
+     -H "Content-Type: application/json" \
+     -d '{"source":{"area":"raw", "dir":"dir", "file":"scan.h5"}, "destination":{"area":"s3", "dir":"bucket", "file":"scan.h5"}, "overwrite":"different"}'
+```
+*/
+func CopyHandler(c *gin.Context) {
+	transferHandler(c, false)
+}
+
+// MoveHandler provides access to POST /move end-point
+/*
+```
+# rename file within storage area
+curl -X POST http://localhost:8340/move \
+     -H "Content-Type: application/json" \
+     -d '{"source":{"area":"raw", "dir":"dir", "file":"scan.h5"}, "destination":{"area":"raw", "dir":"dir", "file":"scan-1.h5"}}'
+# check what would be done by moving file from S3 bucket to file-system storage
+curl -X POST http://localhost:8340/move \
+     -H "Content-Type: application/json" \
+     -d '{"source":{"area":"s3", "dir":"bucket", "file":"scan.h5"}, "destination":{"area":"raw", "dir":"dir"}, "overwrite":"newer", "dry_run":true}'
+```
+*/
+func MoveHandler(c *gin.Context) {
+	// the route requires write scope while move also removes the source file
+	if !tokenScope(c.Request, "delete") {
+		c.JSON(http.StatusForbidden, gin.H{"status": "fail", "error": "move requires delete scope of access token"})
+		return
+	}
+	transferHandler(c, true)
+}
+
+// helper function to handle copy and move requests
+func transferHandler(c *gin.Context, move bool) {
+	var req TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	result, err := transfer(req, move)
+	auditPath(c, req.Source.Area, req.Source.Dir, req.Source.File)
+	if result.Destination.Area != "" {
+		auditTarget(c, result.Destination.String())
+	} else {
+		auditTarget(c, req.Destination.String())
+	}
+	if result.Data != nil {
+		auditMeta(c, result.Data.Size, result.Data.Checksums)
+	}
+	if err != nil {
+		log.Printf("ERROR: fail to %s %s to %s: %v", result.Action, req.Source, req.Destination, err)
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error(), "data": result})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": result})
+}
@@ -0,0 +1,191 @@
+package main
+
+// transfer tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// helper function to set up raw and derived file-system storage areas
+func testTransferAreas(t *testing.T) (*LocalFsClient, *LocalFsClient) {
+	t.Helper()
+	areas := storageAreas
+	t.Cleanup(func() { storageAreas = areas })
+	raw, derived := NewLocalFsClient(t.TempDir()), NewLocalFsClient(t.TempDir())
+	storageAreas = map[string]*StorageArea{
+		"raw":     {Name: "raw", Backend: raw},
+		"derived": {Name: "derived", Backend: derived},
+	}
+	return raw, derived
+}
+
+// helper function to set modification time of a file
+func setModTime(t *testing.T, client *LocalFsClient, dir, file string, mtime time.Time) {
+	t.Helper()
+	if err := os.Chtimes(filepath.Join(client.Storage, dir, file), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// helper function to check that directory contains only given files, i.e.
+// temporary files of transfers are removed
+func checkDirFiles(t *testing.T, client *LocalFsClient, dir string, files ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(client.Storage, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != len(files) {
+		t.Fatalf("expected files %v, got %v", files, names)
+	}
+	for idx, name := range names {
+		if name != files[idx] {
+			t.Fatalf("expected files %v, got %v", files, names)
+		}
+	}
+}
+
+// TestTransferOverwrite tests overwrite policies of existing destination
+func TestTransferOverwrite(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		overwrite string
+		dstData   string
+		dstTime   time.Time // modification time of destination, source is modified now
+		action    string
+		err       error
+	}{
+		{"never", "", "old", now.Add(-time.Hour), "", ErrTransferConflict},
+		{"always", OverwriteAlways, "old", now.Add(time.Hour), ActionCopy, nil},
+		{"newer source", OverwriteNewer, "old", now.Add(-time.Hour), ActionCopy, nil},
+		{"older source", OverwriteNewer, "old", now.Add(time.Hour), ActionSkip, nil},
+		{"different content", OverwriteDifferent, "old", now.Add(time.Hour), ActionCopy, nil},
+		{"same content", OverwriteDifferent, "new content", now.Add(-time.Hour), ActionSkip, nil},
+	}
+	for _, tt := range tests {
+		for _, dstArea := range []string{"raw", "derived"} {
+			t.Run(tt.name+" to "+dstArea, func(t *testing.T) {
+				raw, derived := testTransferAreas(t)
+				dst := map[string]*LocalFsClient{"raw": raw, "derived": derived}[dstArea]
+				uploadContent(t, raw, "data", "src.txt", "new content")
+				setModTime(t, raw, "data", "src.txt", now)
+				uploadContent(t, dst, "out", "dst.txt", tt.dstData)
+				setModTime(t, dst, "out", "dst.txt", tt.dstTime)
+				req := TransferRequest{
+					Source:      TransferPath{Area: "raw", Dir: "data", File: "src.txt"},
+					Destination: TransferPath{Area: dstArea, Dir: "out", File: "dst.txt"},
+					Overwrite:   tt.overwrite,
+				}
+				result, err := transfer(req, false)
+				if tt.err != nil {
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("expected error %v, got %v", tt.err, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Action != tt.action {
+					t.Fatalf("expected action %s, got %s", tt.action, result.Action)
+				}
+				expect := tt.dstData
+				if tt.action == ActionCopy {
+					expect = "new content"
+					if !result.Verified {
+						t.Fatal("expected verified transfer")
+					}
+				}
+				if data := readContent(t, dst, "out", "dst.txt"); data != expect {
+					t.Fatalf("expected destination content %q, got %q", expect, data)
+				}
+				checkDirFiles(t, dst, "out", "dst.txt")
+			})
+		}
+	}
+}
+
+// TestTransferMove tests that moved file is renamed within storage area and
+// streamed across storage areas
+func TestTransferMove(t *testing.T) {
+	tests := []struct {
+		area     string
+		method   string
+		verified bool
+	}{
+		{"raw", MethodRename, false},
+		{"derived", MethodStream, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.area, func(t *testing.T) {
+			raw, derived := testTransferAreas(t)
+			dst := map[string]*LocalFsClient{"raw": raw, "derived": derived}[tt.area]
+			uploadContent(t, raw, "data", "src.txt", "content")
+			req := TransferRequest{
+				Source:      TransferPath{Area: "raw", Dir: "data", File: "src.txt"},
+				Destination: TransferPath{Area: tt.area, Dir: "out"},
+			}
+			result, err := transfer(req, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Method != tt.method || result.Verified != tt.verified {
+				t.Fatalf("expected method %s verified %v, got %+v", tt.method, tt.verified, result)
+			}
+			if data := readContent(t, dst, "out", "src.txt"); data != "content" {
+				t.Fatalf("unexpected content of moved file %q", data)
+			}
+			if _, err := raw.Stat("data", "src.txt"); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected removed source file, got %v", err)
+			}
+		})
+	}
+}
+
+// TestTransferVerificationFailure tests that existing destination is kept if
+// transferred content does not match checksums of the source
+func TestTransferVerificationFailure(t *testing.T) {
+	for _, dstArea := range []string{"raw", "derived"} {
+		t.Run(dstArea, func(t *testing.T) {
+			raw, derived := testTransferAreas(t)
+			dst := map[string]*LocalFsClient{"raw": raw, "derived": derived}[dstArea]
+			uploadContent(t, dst, "out", "dst.txt", "original")
+			// corrupt source file keeping its size and modification time,
+			// i.e. its stored checksums become stale
+			uploadContent(t, raw, "data", "src.txt", "content")
+			fname := filepath.Join(raw.Storage, "data", "src.txt")
+			info, err := os.Stat(fname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(fname, []byte("CONTENT"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			setModTime(t, raw, "data", "src.txt", info.ModTime())
+
+			req := TransferRequest{
+				Source:      TransferPath{Area: "raw", Dir: "data", File: "src.txt"},
+				Destination: TransferPath{Area: dstArea, Dir: "out", File: "dst.txt"},
+				Overwrite:   OverwriteAlways,
+			}
+			if _, err := transfer(req, false); !errors.Is(err, ErrChecksumMismatch) {
+				t.Fatalf("expected error %v, got %v", ErrChecksumMismatch, err)
+			}
+			if data := readContent(t, dst, "out", "dst.txt"); data != "original" {
+				t.Fatalf("expected original content of destination, got %q", data)
+			}
+			checkDirFiles(t, dst, "out", "dst.txt")
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+// trash module provides recoverable deletion of files and directories of
+// storage areas, deleted files are kept in trash area of storage backends
+// until they are restored or their trash retention ends
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrNotEmpty represents error of non-recursive deletion of non-empty
+// directory (S3 bucket)
+var ErrNotEmpty = errors.New("directory is not empty")
+
+// trashIdPattern represents pattern of trash entry ids
+var trashIdPattern = regexp.MustCompile("^[0-9a-f]{32}$")
+
+// newTrashID generates new id of trash entry
+func newTrashID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("[DataManagement.main.newTrashID] rand.Read error: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// areaTrasher returns trash of storage area if trash is enabled and storage
+// backend supports it
+func areaTrasher(area *StorageArea) (Trasher, bool) {
+	if dmConfig.Trash.Retention < 0 || !slices.Contains(area.Capabilities, "trash") {
+		return nil, false
+	}
+	trasher, ok := area.Backend.(Trasher)
+	return trasher, ok
+}
+
+// purgeTrash permanently removes trash entries of storage area which are
+// kept longer than trash retention
+func purgeTrash(area *StorageArea, now time.Time) {
+	trasher, ok := areaTrasher(area)
+	if !ok {
+		return
+	}
+	entries, err := trasher.TrashList()
+	if err != nil {
+		log.Printf("ERROR: unable to list trash of %s storage area: %v", area.Name, err)
+		return
+	}
+	retention := time.Duration(dmConfig.Trash.Retention) * time.Second
+	for _, entry := range entries {
+		if now.Sub(entry.Deleted) < retention {
+			continue
+		}
+		err := trasher.Purge(entry.ID)
+		auditSystem("trash.purge", area.Name, strings.Trim(path.Join(entry.Dir, entry.File), "/"), entry.Size, err)
+		if err != nil {
+			log.Printf("ERROR: unable to purge trash %s of %s storage area: %v", entry.ID, area.Name, err)
+			continue
+		}
+		log.Printf("INFO: purged trash %s of %s/%s/%s", entry.ID, area.Name, entry.Dir, entry.File)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+// trash handlers module provides access to trash areas of storage areas
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrashParams represents URI parameters for /trash/:area/:id end-point
+type TrashParams struct {
+	AreaParams
+	ID string `uri:"id" binding:"required"`
+}
+
+// helper function to lookup trash of storage area of HTTP request
+func areaTrash(c *gin.Context) (Trasher, bool) {
+	var params AreaParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return nil, false
+	}
+	area, err := storageArea(params.Area)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return nil, false
+	}
+	trasher, ok := areaTrasher(area)
+	if !ok {
+		err := fmt.Errorf("%w: trash of %s storage area", ErrNotSupported, area.Name)
+		c.JSON(http.StatusNotImplemented, gin.H{"status": "fail", "error": err.Error()})
+		return nil, false
+	}
+	return trasher, true
+}
+
+// TrashHandler provides access to GET /trash/:area end-point
+/*
+```
+# list deleted files and directories of raw storage area
+curl http://localhost:8340/trash/raw
+```
+*/
+func TrashHandler(c *gin.Context) {
+	trasher, ok := areaTrash(c)
+	if !ok {
+		return
+	}
+	entries, err := trasher.TrashList()
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": entries})
+}
+
+// UndeleteHandler provides access to POST /trash/:area/:id end-point which
+// restores deleted file or directory at its original location
+/*
+```
+curl -X POST http://localhost:8340/trash/raw/<id>
+```
+*/
+func UndeleteHandler(c *gin.Context) {
+	trasher, ok := areaTrash(c)
+	if !ok {
+		return
+	}
+	var params TrashParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	entry, err := trasher.Undelete(params.ID)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	auditPath(c, params.Area, entry.Dir, entry.File)
+	auditMeta(c, entry.Size, nil)
+	msg := fmt.Sprintf("Trash %s restored successfully", params.ID)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "msg": msg, "data": entry})
+}
+
+// TrashDeleteHandler provides access to DELETE /trash/:area/:id end-point
+// which permanently removes deleted file or directory
+/*
+```
+curl -X DELETE http://localhost:8340/trash/raw/<id>
+```
+*/
+func TrashDeleteHandler(c *gin.Context) {
+	trasher, ok := areaTrash(c)
+	if !ok {
+		return
+	}
+	var params TrashParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if err := trasher.Purge(params.ID); err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	msg := fmt.Sprintf("Trash %s purged successfully", params.ID)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "msg": msg})
+}
@@ -0,0 +1,195 @@
+package main
+
+// upload handlers module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sha256Pattern represents pattern of SHA-256 hex digest
+var sha256Pattern = regexp.MustCompile("^[0-9a-fA-F]{64}$")
+
+// UploadParams represents parameters of new upload session
+type UploadParams struct {
+	Area      string `json:"area" binding:"required"` // storage area
+	Dir       string `json:"dir" binding:"required"`  // storage directory or S3 bucket
+	File      string `json:"file" binding:"required"` // file name or S3 object
+	Size      int64  `json:"size"`                    // total size of the file (optional)
+	ChunkSize int64  `json:"chunk_size" binding:"required"`
+	// content type of the file (optional), it is detected by the server if not provided
+	ContentType string `json:"content_type"`
+}
+
+// UploadSessionParams represents URI parameter for /uploads/:id end-point
+type UploadSessionParams struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+// UploadChunkParams represents URI parameters for /uploads/:id/:chunk end-point
+type UploadChunkParams struct {
+	UploadSessionParams
+	Chunk int `uri:"chunk" binding:"required"`
+}
+
+// UploadCreateHandler provides access to POST /uploads end-point
+/*
+```
+curl -X POST http://localhost:8340/uploads \
+     -H "Content-Type: application/json" \
+     -d '{"area":"raw", "dir":"dir", "file":"scan.h5", "size":53687091200, "chunk_size":104857600}'
+```
+*/
+func UploadCreateHandler(c *gin.Context) {
+	var params UploadParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	auditPath(c, params.Area, params.Dir, params.File)
+	auditMeta(c, params.Size, nil)
+	// retained file can not be replaced
+	if !retentionGuard(c, params.Area, params.Dir, params.File) {
+		return
+	}
+	session, err := uploadManager.Create(tokenUser(c.Request), params.Area, params.Dir, params.File, params.ContentType, params.Size, params.ChunkSize)
+	if err != nil {
+		log.Println("ERROR: fail to create upload session", err)
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": session})
+}
+
+// UploadStatusHandler provides access to GET /uploads/:id end-point
+/*
+```
+curl http://localhost:8340/uploads/<id>
+```
+*/
+func UploadStatusHandler(c *gin.Context) {
+	session, ok := uploadSession(c)
+	if !ok {
+		return
+	}
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": session})
+}
+
+// UploadChunkHandler provides access to PUT /uploads/:id/:chunk end-point
+/*
+```
+curl -X PUT http://localhost:8340/uploads/<id>/1 \
+     -H "X-Checksum-SHA256: $(sha256sum chunk.1 | cut -d ' ' -f 1)" \
+     --data-binary @chunk.1
+```
+*/
+func UploadChunkHandler(c *gin.Context) {
+	var params UploadChunkParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if _, ok := uploadSession(c); !ok {
+		return
+	}
+	digest := c.GetHeader("X-Checksum-SHA256")
+	if !sha256Pattern.MatchString(digest) {
+		msg := "missing or invalid X-Checksum-SHA256 header, it should contain SHA-256 hex digest of the chunk"
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": msg})
+		return
+	}
+	if c.Request.ContentLength <= 0 {
+		c.JSON(http.StatusLengthRequired, gin.H{"status": "fail", "error": "missing Content-Length header"})
+		return
+	}
+	defer c.Request.Body.Close()
+	chunk, err := uploadManager.PutChunk(params.ID, params.Chunk, digest, c.Request.Body, c.Request.ContentLength)
+	if err != nil {
+		log.Printf("ERROR: fail to upload chunk %d of session %s, error %v", params.Chunk, params.ID, err)
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	auditMeta(c, chunk.Size, map[string]string{"sha256": chunk.SHA256})
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": chunk})
+}
+
+// UploadCompleteHandler provides access to POST /uploads/:id end-point
+/*
+```
+curl -X POST http://localhost:8340/uploads/<id>
+# verify checksum of assembled file
+curl -X POST -H "X-Checksum-SHA256: <sha256>" http://localhost:8340/uploads/<id>
+```
+*/
+func UploadCompleteHandler(c *gin.Context) {
+	var params UploadSessionParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if _, ok := uploadSession(c); !ok {
+		return
+	}
+	expect, err := expectedChecksums(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	session, err := uploadManager.Complete(params.ID, expect)
+	if err != nil {
+		log.Printf("ERROR: fail to complete upload session %s, error %v", params.ID, err)
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	auditPath(c, session.Area, session.Dir, session.File)
+	auditMeta(c, session.Received, session.Checksums)
+	msg := fmt.Sprintf("File %s/%s/%s uploaded successfully", session.Area, session.Dir, session.File)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "msg": msg, "checksums": session.Checksums})
+}
+
+// UploadAbortHandler provides access to DELETE /uploads/:id end-point
+/*
+```
+curl -X DELETE http://localhost:8340/uploads/<id>
+```
+*/
+func UploadAbortHandler(c *gin.Context) {
+	var params UploadSessionParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if _, ok := uploadSession(c); !ok {
+		return
+	}
+	if err := uploadManager.Abort(params.ID); err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	msg := fmt.Sprintf("Upload session %s aborted successfully", params.ID)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "msg": msg})
+}
+
+// helper function to lookup upload session of HTTP request, the session
+// should be created by the user of the request
+func uploadSession(c *gin.Context) (*UploadSession, bool) {
+	var params UploadSessionParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return nil, false
+	}
+	session, err := uploadManager.Owned(params.ID, tokenUser(c.Request))
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return nil, false
+	}
+	return session, true
+}
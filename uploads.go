@@ -0,0 +1,658 @@
+package main
+
+// uploads module provides resumable (chunked) upload protocol
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// The upload protocol consists of the following steps:
+// - client creates upload session for given area/dir/file (area/bucket/object)
+// - client uploads numbered chunks of the file along with their checksums,
+//   chunks can be uploaded in any order and re-uploaded if necessary
+// - client may query upload session to find out which chunks were received
+// - client finalizes upload session and server assembles the file
+// Abandoned upload sessions are removed once they expire.
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	s3 "github.com/CHESSComputing/golib/s3"
+	minio "github.com/minio/minio-go/v7"
+)
+
+// maxUploadChunks defines maximum number of chunks in upload session, it
+// matches maximum number of parts of S3 multipart upload
+const maxUploadChunks = 10000
+
+// errors of upload sessions
+var (
+	ErrUploadNotFound   = errors.New("upload session not found")
+	ErrUploadConflict   = errors.New("upload session is in conflicting state")
+	ErrUploadOwner      = errors.New("upload session belongs to another user")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrNotSupported     = errors.New("operation is not supported by storage backend")
+)
+
+// uploadIdPattern represents pattern of upload session ids
+var uploadIdPattern = regexp.MustCompile("^[0-9a-f]{32}$")
+
+// UploadChunk represents received chunk of upload session
+type UploadChunk struct {
+	Number int    `json:"number"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	ETag   string `json:"etag,omitempty"` // ETag of S3 multipart upload part
+}
+
+// UploadSession represents resumable upload session
+type UploadSession struct {
+	ID          string            `json:"id"`
+	Area        string            `json:"area"`                   // storage area
+	Dir         string            `json:"dir"`                    // storage directory or S3 bucket
+	File        string            `json:"file"`                   // file name or S3 object
+	ContentType string            `json:"content_type,omitempty"` // content type provided by the client
+	Owner       string            `json:"owner,omitempty"`        // user who created the session
+	Size        int64             `json:"size"`                   // expected size of the file, zero if unknown
+	ChunkSize   int64             `json:"chunk_size"`             // size of every chunk except the last one
+	Chunks      []UploadChunk     `json:"chunks"`                 // received chunks ordered by their numbers
+	Received    int64             `json:"received"`               // total number of received bytes
+	Missing     []int             `json:"missing,omitempty"`
+	MultipartID string            `json:"multipart_id,omitempty"`
+	Checksums   map[string]string `json:"checksums,omitempty"` // checksums of assembled file
+	Created     time.Time         `json:"created"`
+	Updated     time.Time         `json:"updated"`
+	Expires     time.Time         `json:"expires"`
+
+	mutex      sync.Mutex
+	completing bool
+	inflight   int // number of chunks being stored
+}
+
+// helper function to update received bytes and list of missing chunks
+func (s *UploadSession) update() {
+	sort.Slice(s.Chunks, func(i, j int) bool { return s.Chunks[i].Number < s.Chunks[j].Number })
+	s.Received = 0
+	received := make(map[int]bool)
+	for _, chunk := range s.Chunks {
+		s.Received += chunk.Size
+		received[chunk.Number] = true
+	}
+	s.Missing = nil
+	for n := 1; n <= s.numberOfChunks(); n++ {
+		if !received[n] {
+			s.Missing = append(s.Missing, n)
+		}
+	}
+}
+
+// helper function to start completion of upload session, it checks that all
+// chunks are received and none of them is being stored and provides copy of
+// received chunks
+func (s *UploadSession) begin() ([]UploadChunk, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.completing {
+		return nil, fmt.Errorf("%w: upload session %s is being finalized", ErrUploadConflict, s.ID)
+	}
+	if s.inflight > 0 {
+		return nil, fmt.Errorf("%w: %d chunks of upload session %s are being uploaded", ErrUploadConflict, s.inflight, s.ID)
+	}
+	if len(s.Chunks) == 0 {
+		return nil, fmt.Errorf("%w: no chunks were received", ErrUploadConflict)
+	}
+	if len(s.Missing) > 0 {
+		return nil, fmt.Errorf("%w: missing chunks %v", ErrUploadConflict, s.Missing)
+	}
+	for idx, chunk := range s.Chunks {
+		if chunk.Number != idx+1 {
+			return nil, fmt.Errorf("%w: missing chunk %d", ErrUploadConflict, idx+1)
+		}
+		if idx < len(s.Chunks)-1 && chunk.Size != s.ChunkSize {
+			return nil, fmt.Errorf("%w: chunk %d has size %d, expect %d", ErrUploadConflict, chunk.Number, chunk.Size, s.ChunkSize)
+		}
+	}
+	if s.Size > 0 && s.Received != s.Size {
+		return nil, fmt.Errorf("%w: received %d bytes, expect %d", ErrUploadConflict, s.Received, s.Size)
+	}
+	s.completing = true
+	return slices.Clone(s.Chunks), nil
+}
+
+// helper function to return expected number of chunks, zero if unknown
+func (s *UploadSession) numberOfChunks() int {
+	if s.Size <= 0 {
+		return 0
+	}
+	return int((s.Size + s.ChunkSize - 1) / s.ChunkSize)
+}
+
+// helper function to return expected size of given chunk, zero if unknown
+func (s *UploadSession) chunkSize(number int) int64 {
+	if s.Size <= 0 {
+		return 0
+	}
+	if number == s.numberOfChunks() {
+		return s.Size - int64(number-1)*s.ChunkSize
+	}
+	return s.ChunkSize
+}
+
+// ChunkStore represents storage backend of upload sessions
+type ChunkStore interface {
+	MinChunkSize() int64
+	Init(session *UploadSession) error
+	PutChunk(session *UploadSession, chunk *UploadChunk, reader io.Reader) error
+	Complete(session *UploadSession, chunks []UploadChunk, expect map[string]string) (map[string]string, error)
+	Abort(session *UploadSession) error
+}
+
+// UploadManager manages resumable upload sessions
+type UploadManager struct {
+	Area         string                // staging area for upload sessions
+	Expire       time.Duration         // expiration of abandoned sessions
+	MaxChunkSize int64                 // maximum chunk size
+	Stores       map[string]ChunkStore // chunk stores of storage areas
+
+	mutex    sync.RWMutex
+	sessions map[string]*UploadSession
+}
+
+// our upload manager
+var uploadManager *UploadManager
+
+// NewUploadManager creates new upload manager and loads existing upload
+// sessions from its staging area
+func NewUploadManager(area string, expire time.Duration, maxChunkSize int64, stores map[string]ChunkStore) (*UploadManager, error) {
+	if err := os.MkdirAll(area, 0700); err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewUploadManager] os.MkdirAll error: %w", err)
+	}
+	mgr := &UploadManager{
+		Area:         area,
+		Expire:       expire,
+		MaxChunkSize: maxChunkSize,
+		Stores:       stores,
+		sessions:     make(map[string]*UploadSession),
+	}
+	entries, err := os.ReadDir(area)
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewUploadManager] os.ReadDir error: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !uploadIdPattern.MatchString(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(area, entry.Name(), "session.json"))
+		if err != nil {
+			log.Printf("WARNING: unable to read upload session %s, error %v", entry.Name(), err)
+			continue
+		}
+		var session UploadSession
+		if err := json.Unmarshal(data, &session); err != nil {
+			log.Printf("WARNING: unable to parse upload session %s, error %v", entry.Name(), err)
+			continue
+		}
+		mgr.sessions[session.ID] = &session
+	}
+	log.Printf("INFO: loaded %d upload sessions from %s", len(mgr.sessions), area)
+	return mgr, nil
+}
+
+// Create creates new upload session
+func (m *UploadManager) Create(owner, area, dir, file, ctype string, size, chunkSize int64) (*UploadSession, error) {
+	store, err := m.store(area)
+	if err != nil {
+		return nil, err
+	}
+	if chunkSize <= 0 || chunkSize > m.MaxChunkSize {
+		return nil, fmt.Errorf("chunk size should be within (0, %d] range", m.MaxChunkSize)
+	}
+	if chunkSize < store.MinChunkSize() {
+		return nil, fmt.Errorf("chunk size should be at least %d bytes", store.MinChunkSize())
+	}
+	if size < 0 {
+		return nil, errors.New("size should not be negative")
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.UploadManager.Create] rand.Read error: %w", err)
+	}
+	now := time.Now()
+	session := &UploadSession{
+		ID:          hex.EncodeToString(buf),
+		Area:        area,
+		Dir:         dir,
+		File:        file,
+		ContentType: ctype,
+		Owner:       owner,
+		Size:        size,
+		ChunkSize:   chunkSize,
+		Created:     now,
+		Updated:     now,
+		Expires:     now.Add(m.Expire),
+	}
+	if session.numberOfChunks() > maxUploadChunks {
+		return nil, fmt.Errorf("number of chunks should not exceed %d, please increase chunk size", maxUploadChunks)
+	}
+	session.update()
+	if err := os.MkdirAll(m.sessionDir(session.ID), 0700); err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.UploadManager.Create] os.MkdirAll error: %w", err)
+	}
+	if err := store.Init(session); err != nil {
+		os.RemoveAll(m.sessionDir(session.ID))
+		return nil, fmt.Errorf("[DataManagement.main.UploadManager.Create] Store.Init error: %w", err)
+	}
+	if err := m.save(session); err != nil {
+		store.Abort(session)
+		os.RemoveAll(m.sessionDir(session.ID))
+		return nil, err
+	}
+	m.mutex.Lock()
+	m.sessions[session.ID] = session
+	m.mutex.Unlock()
+	log.Printf("INFO: created upload session %s for %s/%s/%s", session.ID, area, dir, file)
+	return session, nil
+}
+
+// Owned returns upload session for given id which belongs to given user,
+// the sessions created without user can be accessed by any user
+func (m *UploadManager) Owned(id, user string) (*UploadSession, error) {
+	session, err := m.Session(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Owner != "" && session.Owner != user {
+		return nil, fmt.Errorf("%w: %s", ErrUploadOwner, id)
+	}
+	return session, nil
+}
+
+// Session returns upload session for given id
+func (m *UploadManager) Session(id string) (*UploadSession, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if session, ok := m.sessions[id]; ok {
+		return session, nil
+	}
+	return nil, ErrUploadNotFound
+}
+
+// Sessions returns upload sessions of given storage area
+func (m *UploadManager) Sessions(area string) []*UploadSession {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var sessions []*UploadSession
+	for _, session := range m.sessions {
+		if session.Area == area {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// PutChunk stores given chunk of upload session, the chunk content is
+// verified against provided SHA-256 hex digest
+func (m *UploadManager) PutChunk(id string, number int, digest string, reader io.Reader, size int64) (UploadChunk, error) {
+	chunk := UploadChunk{Number: number, Size: size, SHA256: strings.ToLower(digest)}
+	session, err := m.Session(id)
+	if err != nil {
+		return chunk, err
+	}
+	if number < 1 || number > maxUploadChunks || (session.Size > 0 && number > session.numberOfChunks()) {
+		return chunk, fmt.Errorf("invalid chunk number %d", number)
+	}
+	if expect := session.chunkSize(number); expect > 0 && size != expect {
+		return chunk, fmt.Errorf("invalid size of chunk %d, expect %d bytes, got %d", number, expect, size)
+	}
+	if size <= 0 || size > session.ChunkSize {
+		return chunk, fmt.Errorf("invalid size of chunk %d, it should be within (0, %d] range", number, session.ChunkSize)
+	}
+	chunk.Offset = int64(number-1) * session.ChunkSize
+
+	store, err := m.store(session.Area)
+	if err != nil {
+		return chunk, err
+	}
+
+	// chunks in flight prevent completion of upload session until they are stored
+	session.mutex.Lock()
+	if session.completing {
+		session.mutex.Unlock()
+		return chunk, fmt.Errorf("%w: upload session %s is being finalized", ErrUploadConflict, id)
+	}
+	session.inflight++
+	session.mutex.Unlock()
+
+	err = store.PutChunk(session, &chunk, reader)
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.inflight--
+	if err != nil {
+		return chunk, err
+	}
+	var chunks []UploadChunk
+	for _, c := range session.Chunks {
+		if c.Number != number {
+			chunks = append(chunks, c)
+		}
+	}
+	session.Chunks = append(chunks, chunk)
+	session.Updated = time.Now()
+	session.Expires = session.Updated.Add(m.Expire)
+	session.update()
+	return chunk, m.save(session)
+}
+
+// Complete finalizes upload session and assembles the file, the assembled
+// file is verified against given expected checksums
+func (m *UploadManager) Complete(id string, expect map[string]string) (*UploadSession, error) {
+	session, err := m.Session(id)
+	if err != nil {
+		return nil, err
+	}
+	store, err := m.store(session.Area)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := session.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		session.mutex.Lock()
+		session.completing = false
+		session.mutex.Unlock()
+	}()
+	sums, err := store.Complete(session, chunks, expect)
+	if err != nil {
+		return nil, err
+	}
+	session.mutex.Lock()
+	session.Checksums = sums
+	session.mutex.Unlock()
+	m.remove(session)
+	log.Printf("INFO: completed upload session %s for %s/%s/%s", session.ID, session.Area, session.Dir, session.File)
+	return session, nil
+}
+
+// Abort aborts upload session and removes all received chunks
+func (m *UploadManager) Abort(id string) error {
+	session, err := m.Session(id)
+	if err != nil {
+		return err
+	}
+	session.mutex.Lock()
+	busy := session.completing || session.inflight > 0
+	session.mutex.Unlock()
+	if busy {
+		return fmt.Errorf("%w: upload session %s is being uploaded or finalized", ErrUploadConflict, id)
+	}
+	store, err := m.store(session.Area)
+	if err != nil {
+		return err
+	}
+	if err := store.Abort(session); err != nil {
+		return err
+	}
+	m.remove(session)
+	log.Printf("INFO: aborted upload session %s for %s/%s/%s", session.ID, session.Area, session.Dir, session.File)
+	return nil
+}
+
+// Cleanup aborts all expired upload sessions
+func (m *UploadManager) Cleanup() {
+	var expired []string
+	now := time.Now()
+	m.mutex.RLock()
+	for id, session := range m.sessions {
+		session.mutex.Lock()
+		if !session.completing && session.inflight == 0 && session.Expires.Before(now) {
+			expired = append(expired, id)
+		}
+		session.mutex.Unlock()
+	}
+	m.mutex.RUnlock()
+	for _, id := range expired {
+		if err := m.Abort(id); err != nil {
+			log.Printf("ERROR: unable to abort expired upload session %s, error %v", id, err)
+			// remove expired session anyway since it can't be resumed
+			if session, err := m.Session(id); err == nil {
+				m.remove(session)
+			}
+		}
+	}
+}
+
+// Run periodically removes expired upload sessions
+func (m *UploadManager) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.Cleanup()
+	}
+}
+
+// helper function to return chunk store of given storage area
+func (m *UploadManager) store(area string) (ChunkStore, error) {
+	if store, ok := m.Stores[area]; ok {
+		return store, nil
+	}
+	if _, err := storageArea(area); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: storage area %s does not support resumable uploads", ErrNotSupported, area)
+}
+
+// helper function to return staging directory of upload session
+func (m *UploadManager) sessionDir(id string) string {
+	return filepath.Join(m.Area, id)
+}
+
+// helper function to persist upload session in its staging directory
+func (m *UploadManager) save(session *UploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.UploadManager.save] json.Marshal error: %w", err)
+	}
+	fname := filepath.Join(m.sessionDir(session.ID), "session.json")
+	tmp := fname + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("[DataManagement.main.UploadManager.save] os.WriteFile error: %w", err)
+	}
+	if err := os.Rename(tmp, fname); err != nil {
+		return fmt.Errorf("[DataManagement.main.UploadManager.save] os.Rename error: %w", err)
+	}
+	return nil
+}
+
+// helper function to remove upload session and its staging directory
+func (m *UploadManager) remove(session *UploadSession) {
+	m.mutex.Lock()
+	delete(m.sessions, session.ID)
+	m.mutex.Unlock()
+	if err := os.RemoveAll(m.sessionDir(session.ID)); err != nil {
+		log.Printf("WARNING: unable to remove upload session area %s, error %v", m.sessionDir(session.ID), err)
+	}
+}
+
+// helper function to copy chunk content into writer and verify its checksum
+func copyChunk(w io.Writer, chunk *UploadChunk, reader io.Reader) error {
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), io.LimitReader(reader, chunk.Size))
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.copyChunk] io.Copy error: %w", err)
+	}
+	if size != chunk.Size {
+		return fmt.Errorf("incomplete chunk %d, received %d bytes, expect %d", chunk.Number, size, chunk.Size)
+	}
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if digest != chunk.SHA256 {
+		return fmt.Errorf("%w: chunk %d has sha256 %s, expect %s", ErrChecksumMismatch, chunk.Number, digest, chunk.SHA256)
+	}
+	return nil
+}
+
+// FsChunkStore provides file-system implementation of ChunkStore, chunks are
+// kept in staging area and assembled into final file upon completion
+type FsChunkStore struct {
+	Area   string   // staging area of upload sessions
+	Client FsClient // file-system client to assemble uploaded files
+}
+
+// MinChunkSize implements ChunkStore interface
+func (s *FsChunkStore) MinChunkSize() int64 {
+	return 1
+}
+
+// Init implements ChunkStore interface
+func (s *FsChunkStore) Init(session *UploadSession) error {
+	// make sure that target path is valid before we accept any chunks
+	if _, err := s.Client.Stat(session.Dir, session.File); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// PutChunk implements ChunkStore interface
+func (s *FsChunkStore) PutChunk(session *UploadSession, chunk *UploadChunk, reader io.Reader) error {
+	fname := s.chunkFile(session, chunk.Number)
+	tmp, err := os.CreateTemp(filepath.Dir(fname), fmt.Sprintf("%d.chunk-*", chunk.Number))
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.FsChunkStore.PutChunk] os.CreateTemp error: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := copyChunk(tmp, chunk, reader); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("[DataManagement.main.FsChunkStore.PutChunk] tmp.Close error: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), fname); err != nil {
+		return fmt.Errorf("[DataManagement.main.FsChunkStore.PutChunk] os.Rename error: %w", err)
+	}
+	return nil
+}
+
+// Complete implements ChunkStore interface
+func (s *FsChunkStore) Complete(session *UploadSession, chunks []UploadChunk, expect map[string]string) (map[string]string, error) {
+	var files []string
+	for _, chunk := range chunks {
+		files = append(files, s.chunkFile(session, chunk.Number))
+	}
+	meta, err := s.Client.Assemble(session.Dir, session.File, session.ContentType, files, expect)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Checksums, nil
+}
+
+// Abort implements ChunkStore interface
+func (s *FsChunkStore) Abort(session *UploadSession) error {
+	// chunks are removed along with session staging area
+	return nil
+}
+
+// helper function to return file name of upload chunk
+func (s *FsChunkStore) chunkFile(session *UploadSession, number int) string {
+	return filepath.Join(s.Area, session.ID, fmt.Sprintf("%d.chunk", number))
+}
+
+// S3ChunkStore provides S3 implementation of ChunkStore based on S3
+// multipart upload, every chunk represents single part of multipart upload
+type S3ChunkStore struct {
+	Backend *S3Backend // S3 backend which holds uploaded objects
+}
+
+// MinChunkSize implements ChunkStore interface
+func (s *S3ChunkStore) MinChunkSize() int64 {
+	// S3 requires every part except the last one to be at least 5MB
+	return s3.LargeFileThreshold
+}
+
+// helper function to get minio client
+func (s *S3ChunkStore) client() (minio.Core, error) {
+	if client, ok := s.Backend.Client.(*s3.MinioClient); ok {
+		return minio.Core{Client: client.S3Client}, nil
+	}
+	return minio.Core{}, fmt.Errorf("%w: multipart upload requires MinIO S3 client", ErrNotSupported)
+}
+
+// Init implements ChunkStore interface
+func (s *S3ChunkStore) Init(session *UploadSession) error {
+	core, err := s.client()
+	if err != nil {
+		return err
+	}
+	// the content type is refined upon completion once the object content is available
+	opts := minio.PutObjectOptions{ContentType: detectContentType(session.ContentType, session.File, nil)}
+	uploadID, err := core.NewMultipartUpload(context.Background(), session.Dir, session.File, opts)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.S3ChunkStore.Init] NewMultipartUpload error: %w", err)
+	}
+	session.MultipartID = uploadID
+	return nil
+}
+
+// PutChunk implements ChunkStore interface
+func (s *S3ChunkStore) PutChunk(session *UploadSession, chunk *UploadChunk, reader io.Reader) error {
+	core, err := s.client()
+	if err != nil {
+		return err
+	}
+	// S3 will verify SHA-256 of the part on its side
+	opts := minio.PutObjectPartOptions{Sha256Hex: chunk.SHA256}
+	part, err := core.PutObjectPart(context.Background(), session.Dir, session.File,
+		session.MultipartID, chunk.Number, reader, chunk.Size, opts)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.S3ChunkStore.PutChunk] PutObjectPart error: %w", err)
+	}
+	chunk.ETag = part.ETag
+	return nil
+}
+
+// Complete implements ChunkStore interface
+func (s *S3ChunkStore) Complete(session *UploadSession, chunks []UploadChunk, expect map[string]string) (map[string]string, error) {
+	core, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+	var parts []minio.CompletePart
+	for _, chunk := range chunks {
+		parts = append(parts, minio.CompletePart{PartNumber: chunk.Number, ETag: chunk.ETag})
+	}
+	_, err = core.CompleteMultipartUpload(context.Background(), session.Dir, session.File,
+		session.MultipartID, parts, minio.PutObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.S3ChunkStore.Complete] CompleteMultipartUpload error: %w", err)
+	}
+	return s.Backend.StoreChecksums(session.Dir, session.File, session.ContentType, expect)
+}
+
+// Abort implements ChunkStore interface
+func (s *S3ChunkStore) Abort(session *UploadSession) error {
+	core, err := s.client()
+	if err != nil {
+		return err
+	}
+	err = core.AbortMultipartUpload(context.Background(), session.Dir, session.File, session.MultipartID)
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.S3ChunkStore.Abort] AbortMultipartUpload error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+// uploads tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// helper function to create upload manager of file-system storage area
+func testUploadManager(t *testing.T, staging string, client *LocalFsClient) *UploadManager {
+	t.Helper()
+	stores := map[string]ChunkStore{"raw": &FsChunkStore{Area: staging, Client: client}}
+	mgr, err := NewUploadManager(staging, time.Hour, 1024, stores)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mgr
+}
+
+// helper function to return hex encoded SHA-256 digest of given content
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// helper function to upload chunk of given content
+func putChunk(mgr *UploadManager, id string, number int, content string) error {
+	_, err := mgr.PutChunk(id, number, sha256Hex(content), strings.NewReader(content), int64(len(content)))
+	return err
+}
+
+// TestUploadSession tests that file is assembled from chunks received in
+// any order once all of them are received
+func TestUploadSession(t *testing.T) {
+	client := NewLocalFsClient(t.TempDir())
+	mgr := testUploadManager(t, t.TempDir(), client)
+	content := "0123456789"
+	session, err := mgr.Create("alice", "raw", "data", "file.txt", "text/plain", int64(len(content)), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(session.Missing, []int{1, 2, 3}) {
+		t.Fatalf("expected missing chunks [1 2 3], got %v", session.Missing)
+	}
+	for _, number := range []int{3, 1} {
+		start := (number - 1) * 4
+		if err := putChunk(mgr, session.ID, number, content[start:min(start+4, len(content))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(session.Missing, []int{2}) || session.Received != 6 {
+		t.Fatalf("expected missing chunk 2 and 6 received bytes, got %v and %d", session.Missing, session.Received)
+	}
+	if _, err := mgr.Complete(session.ID, nil); !errors.Is(err, ErrUploadConflict) {
+		t.Fatalf("expected conflict of incomplete session, got %v", err)
+	}
+	if err := putChunk(mgr, session.ID, 2, content[4:8]); err != nil {
+		t.Fatal(err)
+	}
+	session, err = mgr.Complete(session.ID, map[string]string{ChecksumSHA256: sha256Hex(content)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Checksums[ChecksumSHA256] != sha256Hex(content) {
+		t.Fatalf("expected checksum of assembled file, got %v", session.Checksums)
+	}
+	if data := readContent(t, client, "data", "file.txt"); data != content {
+		t.Fatalf("expected assembled content %q, got %q", content, data)
+	}
+	if _, err := mgr.Session(session.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("expected removed session, got %v", err)
+	}
+}
+
+// TestUploadChunkValidation tests that invalid chunks are rejected
+func TestUploadChunkValidation(t *testing.T) {
+	mgr := testUploadManager(t, t.TempDir(), NewLocalFsClient(t.TempDir()))
+	session, err := mgr.Create("", "raw", "data", "file.txt", "", 10, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		number  int
+		content string
+		digest  string
+	}{
+		{"zero chunk number", 0, "0123", ""},
+		{"chunk number beyond size", 4, "0123", ""},
+		{"short chunk", 1, "012", ""},
+		{"wrong size of last chunk", 3, "0123", ""},
+		{"digest mismatch", 1, "0123", sha256Hex("3210")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digest := tt.digest
+			if digest == "" {
+				digest = sha256Hex(tt.content)
+			}
+			if _, err := mgr.PutChunk(session.ID, tt.number, digest, strings.NewReader(tt.content), int64(len(tt.content))); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+	if len(session.Chunks) != 0 {
+		t.Fatalf("expected no received chunks, got %+v", session.Chunks)
+	}
+	if _, err := mgr.Create("", "raw", "data", "file.txt", "", 10, 2048); err == nil {
+		t.Fatal("expected error of chunk size above maximum")
+	}
+	if _, err := mgr.Create("", "s3", "data", "file.txt", "", 10, 4); err == nil {
+		t.Fatal("expected error of unknown storage area")
+	}
+}
+
+// TestUploadOwner tests that upload session is accessible only by its owner
+func TestUploadOwner(t *testing.T) {
+	mgr := testUploadManager(t, t.TempDir(), NewLocalFsClient(t.TempDir()))
+	owned, err := mgr.Create("alice", "raw", "data", "file.txt", "", 10, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := mgr.Create("", "raw", "data", "other.txt", "", 10, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.Owned(owned.ID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.Owned(owned.ID, "bob"); !errors.Is(err, ErrUploadOwner) {
+		t.Fatalf("expected owner error, got %v", err)
+	}
+	if _, err := mgr.Owned(shared.ID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestUploadResume tests that upload sessions are resumed after restart of
+// the service and aborted sessions are removed
+func TestUploadResume(t *testing.T) {
+	staging := t.TempDir()
+	client := NewLocalFsClient(t.TempDir())
+	mgr := testUploadManager(t, staging, client)
+	session, err := mgr.Create("", "raw", "data", "file.txt", "", 6, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aborted, err := mgr.Create("", "raw", "data", "other.txt", "", 6, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := putChunk(mgr, session.ID, 1, "0123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.Abort(aborted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr = testUploadManager(t, staging, client)
+	if _, err := mgr.Session(aborted.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("expected removed session, got %v", err)
+	}
+	resumed, err := mgr.Session(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(resumed.Missing, []int{2}) {
+		t.Fatalf("expected missing chunk 2, got %v", resumed.Missing)
+	}
+	if err := putChunk(mgr, session.ID, 2, "45"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.Complete(session.ID, map[string]string{ChecksumSHA256: sha256Hex("012345")}); err != nil {
+		t.Fatal(err)
+	}
+	if data := readContent(t, client, "data", "file.txt"); data != "012345" {
+		t.Fatalf("expected assembled content, got %q", data)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(staging, session.ID)); len(matches) != 0 {
+		t.Fatalf("expected removed staging area of session, got %v", matches)
+	}
+}
+
+// TestUploadChecksumMismatch tests that assembled file is rejected if its
+// checksum does not match expected one while the session can be completed
+// again
+func TestUploadChecksumMismatch(t *testing.T) {
+	client := NewLocalFsClient(t.TempDir())
+	mgr := testUploadManager(t, t.TempDir(), client)
+	session, err := mgr.Create("", "raw", "data", "file.txt", "", 4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := putChunk(mgr, session.ID, 1, "0123"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.Complete(session.ID, map[string]string{ChecksumSHA256: sha256Hex("3210")}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	if _, err := client.Stat("data", "file.txt"); err == nil {
+		t.Fatal("expected no assembled file")
+	}
+	if _, err := mgr.Complete(session.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,125 +1,223 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	authz "github.com/CHESSComputing/golib/authz"
 	srvConfig "github.com/CHESSComputing/golib/config"
-	services "github.com/CHESSComputing/golib/services"
+	"github.com/gin-gonic/gin"
 )
 
+// tokenUser provides user of access token of HTTP request, empty string is
+// returned if request does not have valid token
+func tokenUser(r *http.Request) string {
+	token := authz.RequestToken(r)
+	if token == "" || srvConfig.Config == nil {
+		return ""
+	}
+	claims, err := authz.TokenClaims(token, srvConfig.Config.Authz.ClientID)
+	if err != nil {
+		return ""
+	}
+	if claims.CustomClaims.User != "" {
+		return claims.CustomClaims.User
+	}
+	return claims.Subject
+}
+
+// tokenScope checks if access token of HTTP request has given scope, the
+// scope is matched in the same way as by authorization middleware
+func tokenScope(r *http.Request, scope string) bool {
+	token := authz.RequestToken(r)
+	if token == "" || srvConfig.Config == nil {
+		return false
+	}
+	claims, err := authz.TokenClaims(token, srvConfig.Config.Authz.ClientID)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(claims.CustomClaims.Scope, scope)
+}
+
 // FileEntry represents a directory entry
 type FileEntry struct {
-	Did    string `json:"did"`
-	EscDid string `json:"esc_did"`
-	Name   string `json:"name"`
-	IsDir  bool   `json:"is_dir"`
-	Path   string `json:"path"` // path here correspond to sub-path within raw location area
+	Did     string    `json:"did"`
+	EscDid  string    `json:"esc_did"`
+	Name    string    `json:"name"`
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Path    string    `json:"path"` // path here correspond to sub-path within raw location area
+
+	Attribute   string            `json:"attribute,omitempty"` // data location attribute of meta-data record
+	ContentType string            `json:"content_type,omitempty"`
+	Checksums   map[string]string `json:"checksums,omitempty"`
 }
 
-// getFileList returns a list of files and directories in the given path
-func getFileList(did, path, spath string) ([]FileEntry, error) {
+// getFileList returns a list of files and directories in the given sub-path
+// of data location according to given listing options along with the cursor
+// of the next page and flag which indicates that listing was truncated due
+// to walk limits
+func getFileList(ctx context.Context, did, location, spath string, opts ListOptions) ([]FileEntry, string, bool, error) {
 	var entries []FileEntry
 
-	files, err := os.ReadDir(path)
+	files, truncated, err := listLocation(ctx, location, spath, opts.Depth)
 	if err != nil {
-		return nil, fmt.Errorf("[DataManagement.main.getFileList] os.ReadDir error: %w", err)
+		return nil, "", false, fmt.Errorf("[DataManagement.main.getFileList] List error: %w", err)
+	}
+	files, cursor, err := opts.Apply(files)
+	if err != nil {
+		return nil, "", false, err
 	}
 
 	for _, file := range files {
 		entry := FileEntry{
-			Did:    did,
-			EscDid: url.QueryEscape(did),
-			Name:   file.Name(),
-			IsDir:  file.IsDir(),
-			Path:   filepath.Join(spath, file.Name()),
+			Did:     did,
+			EscDid:  url.QueryEscape(did),
+			Name:    file.Name,
+			IsDir:   file.IsDirectory,
+			Size:    file.Size,
+			ModTime: file.ModTime,
+			Path:    filepath.Join(spath, file.Name),
 			//             Path:   filepath.Join(path, file.Name()),
+			ContentType: file.ContentType,
+			Checksums:   file.Checksums,
 		}
 		entries = append(entries, entry)
 	}
 
-	return entries, nil
+	return entries, cursor, truncated, nil
 }
 
-// helper function to find meta-data record for given did
-func findMetaDataRecord(did string) (map[string]any, error) {
-	var rec map[string]any
-	query := fmt.Sprintf("{\"did\":\"%s\"}", did)
-	var skeys []string
-	var sorder, idx int
-	limit := 1
-	records, err := services.MetaDataRecords(query, skeys, sorder, idx, limit)
+// searchHit represents file found in data location of a DID
+type searchHit struct {
+	Attribute string
+	Meta      Metadata
+}
+
+// searchFiles searches files within given sub-path of data locations which
+// match given pattern (regular expression of file name) and listing options,
+// it returns requested page of files along with the cursor of the next page
+// and flag which indicates that search was truncated due to walk limits.
+// The paths of found files are relative to their data locations.
+func searchFiles(ctx context.Context, did string, locations []DataLocation, spath string, pattern *regexp.Regexp, opts ListOptions) ([]FileEntry, string, bool, error) {
+	var hits []searchHit
+	var truncated bool
+	for _, loc := range locations {
+		client := NewLocalFsClient(loc.Path)
+		if _, err := client.Stat(spath, ""); err != nil {
+			var perr *ForbiddenPathError
+			if errors.As(err, &perr) {
+				return nil, "", false, err
+			}
+			// requested path does not exist in this data location
+			continue
+		}
+		files, partial, err := listLocation(ctx, loc.Path, spath, opts.Depth)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("[DataManagement.main.searchFiles] List error: %w", err)
+		}
+		truncated = truncated || partial
+		for _, file := range files {
+			if pattern != nil && !pattern.MatchString(filepath.Base(file.Name)) {
+				continue
+			}
+			hits = append(hits, searchHit{Attribute: loc.Attribute, Meta: file})
+		}
+	}
+	hits, cursor, err := applyListOptions(opts, hits, func(hit searchHit) Metadata { return hit.Meta })
 	if err != nil {
-		return rec, fmt.Errorf("[DataManagement.main.findMetaDataRecord] services.MetaDataRecords error: %w", err)
+		return nil, "", false, err
 	}
-	if len(records) != 1 {
-		msg := fmt.Sprintf("multiple records found for did=%s, records=%v", did, records)
-		return rec, errors.New(msg)
+	entries := []FileEntry{}
+	for _, hit := range hits {
+		entries = append(entries, FileEntry{
+			Did:         did,
+			EscDid:      url.QueryEscape(did),
+			Name:        filepath.Base(hit.Meta.Name),
+			IsDir:       hit.Meta.IsDirectory,
+			Size:        hit.Meta.Size,
+			ModTime:     hit.Meta.ModTime,
+			Path:        filepath.Join(spath, hit.Meta.Name),
+			Attribute:   hit.Attribute,
+			ContentType: hit.Meta.ContentType,
+			Checksums:   hit.Meta.Checksums,
+		})
 	}
-	return records[0], nil
+	return entries, cursor, truncated, nil
 }
 
-// findFiles recursively finds all files in idir matching the given pattern pat.
-func findFiles(idir string, pat string) ([]string, error) {
-	if !strings.HasSuffix(idir, "/") {
-		idir += "/"
+// helper function to find meta-data record for given did
+func findMetaDataRecord(did string) (map[string]any, error) {
+	var rec map[string]any
+	if err := validateDID(did); err != nil {
+		return rec, err
 	}
-	var files []string
-
-	// Compile the regex pattern
-	re, err := regexp.Compile(pat)
+	records, err := metaDataClient.Records(did)
 	if err != nil {
-		return nil, fmt.Errorf("invalid regex pattern: %v", err)
+		return rec, fmt.Errorf("[DataManagement.main.findMetaDataRecord] metaDataClient.Records error: %w", err)
 	}
-
-	// Walk through the directory
-	err = filepath.Walk(idir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Println("WARNING:", err)
-		}
-
-		if pat == "all" {
-			// get all files
-			if !info.IsDir() {
-				files = append(files, path)
-			}
-		} else {
-			// Check if it's a regular file and matches the pattern
-			if !info.IsDir() && re.MatchString(info.Name()) {
-				files = append(files, path)
+	if len(records) == 0 {
+		return rec, fmt.Errorf("%w for did=%s", ErrRecordNotFound, did)
+	}
+	if len(records) > 1 {
+		aerr := &AmbiguousDIDError{DID: did}
+		for _, r := range records {
+			if val, ok := r["did"].(string); ok {
+				aerr.Candidates = append(aerr.Candidates, val)
 			}
 		}
-		return nil
-	})
-	if err != nil {
-		return files, fmt.Errorf("[DataManagement.main.findFiles] filepath.Walk error: %w", err)
+		return rec, aerr
 	}
+	return records[0], nil
+}
 
-	return files, nil
+// helper function to report error of meta-data record lookup to HTTP client,
+// the ambiguous DID error contains list of candidate DIDs
+func metaDataError(c *gin.Context, err error) {
+	resp := gin.H{"status": "fail", "error": err.Error()}
+	var aerr *AmbiguousDIDError
+	if errors.As(err, &aerr) {
+		resp["candidates"] = aerr.Candidates
+	}
+	c.JSON(errorStatus(err, http.StatusInternalServerError), resp)
 }
 
-// fileExtensions finds all unique file extensions in the given directory and subdirectories.
-func fileExtensions(idir string) []string {
-	if !strings.HasSuffix(idir, "/") {
-		idir += "/"
+// fileExtensions finds all unique file extensions in the given sub-path of
+// data location and its subdirectories.
+func fileExtensions(ctx context.Context, location, spath string) []string {
+	if fileCatalog != nil {
+		extensions, err := fileCatalog.Extensions(ctx, location, spath)
+		if err == nil {
+			return extensions
+		}
+		log.Println("WARNING: catalog", err.Error())
+	}
+	idir, err := resolvePath(location, spath)
+	if err != nil {
+		log.Println("WARNING: resolvePath", err.Error())
+		return nil
 	}
 	extMap := make(map[string]bool)
 
 	// Walk through the directory
-	err := filepath.Walk(idir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Println("WARNING: filepath.Walk", err.Error())
-		}
-
+	_, err = walkDir(ctx, idir, -1, func(path, rel string, entry fs.DirEntry) error {
 		// Check if it's a file
-		if !info.IsDir() {
-			ext := filepath.Ext(info.Name()) // Extract file extension
+		if !entry.IsDir() {
+			ext := filepath.Ext(entry.Name()) // Extract file extension
 			if ext != "" {
 				extMap[ext] = true // Store unique extensions
 			}
@@ -128,7 +226,7 @@ func fileExtensions(idir string) []string {
 	})
 
 	if err != nil {
-		log.Println("WARNING: filepath.Walk", err.Error())
+		log.Println("WARNING: walkDir", err.Error())
 		// return default list of file extensions
 		if len(srvConfig.Config.DataManagement.FileExtensions) > 0 {
 			return srvConfig.Config.DataManagement.FileExtensions
@@ -141,6 +239,106 @@ func fileExtensions(idir string) []string {
 	for ext := range extMap {
 		extensions = append(extensions, ext)
 	}
+	sort.Strings(extensions)
 
 	return extensions
 }
+
+// fileETag builds strong ETag value from file modification time and size
+func fileETag(modTime time.Time, size int64) string {
+	return fmt.Sprintf("\"%x-%x\"", modTime.UnixNano(), size)
+}
+
+// serveContent streams content of given reader to HTTP client. It relies on
+// http.ServeContent which handles Range, If-Range, If-Match, If-None-Match,
+// If-Modified-Since and If-Unmodified-Since HTTP headers, therefore clients
+// may request partial content and resume interrupted downloads.
+func serveContent(c *gin.Context, name string, meta Metadata, reader io.ReadSeeker) {
+	header := fmt.Sprintf("attachment; filename=%s", name)
+	c.Header("Content-Disposition", header)
+	ctype := meta.ContentType
+	if ctype == "" {
+		ctype = contentTypeByExtension(name)
+	}
+	c.Header("Content-Type", ctype)
+	c.Header("Accept-Ranges", "bytes")
+	if meta.ETag != "" {
+		c.Header("ETag", meta.ETag)
+	}
+	http.ServeContent(c.Writer, c.Request, name, meta.ModTime, reader)
+}
+
+// isStatRequest checks if HTTP request asks only for metadata of a file or a
+// directory, i.e. it is HEAD request or GET request with stat=true parameter
+func isStatRequest(c *gin.Context) bool {
+	if c.Request.Method == http.MethodHead {
+		return true
+	}
+	stat, _ := strconv.ParseBool(c.Query("stat"))
+	return stat
+}
+
+// statResponse writes metadata of a file or a directory to HTTP response
+// without its content. The ETag, Last-Modified and checksums are provided via
+// HTTP headers, HEAD response has Content-Type and Content-Length headers of
+// the file while GET response contains metadata in JSON format.
+func statResponse(c *gin.Context, meta Metadata) {
+	if meta.ETag != "" {
+		c.Header("ETag", meta.ETag)
+	}
+	if !meta.ModTime.IsZero() {
+		c.Header("Last-Modified", meta.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if sum, ok := meta.Checksums[ChecksumSHA256]; ok {
+		c.Header("X-Checksum-SHA256", sum)
+	}
+	if digest := digestHeader(meta.Checksums); digest != "" {
+		c.Header("Digest", digest)
+	}
+	if c.Request.Method != http.MethodHead {
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "data": meta})
+		return
+	}
+	if !meta.IsDirectory {
+		ctype := meta.ContentType
+		if ctype == "" {
+			ctype = contentTypeByExtension(meta.Name)
+		}
+		c.Header("Content-Type", ctype)
+		c.Header("Content-Length", strconv.FormatInt(meta.Size, 10))
+		c.Header("Accept-Ranges", "bytes")
+	}
+	c.Status(http.StatusOK)
+}
+
+// errorStatus returns HTTP status code for given error, the default status
+// is used for errors which do not have specific mapping
+func errorStatus(err error, defaultStatus int) int {
+	var perr *ForbiddenPathError
+	if errors.Is(err, ErrInvalidDID) {
+		return http.StatusBadRequest
+	}
+	if errors.As(err, &perr) || errors.Is(err, ErrReadOnly) || errors.Is(err, ErrRetained) || errors.Is(err, ErrUploadOwner) ||
+		errors.Is(err, ErrSignatureInvalid) || errors.Is(err, ErrSignatureExpired) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, ErrUploadNotFound) || errors.Is(err, ErrAreaNotFound) || errors.Is(err, ErrRecordNotFound) ||
+		errors.Is(err, fs.ErrNotExist) {
+		return http.StatusNotFound
+	}
+	var aerr *AmbiguousDIDError
+	if errors.Is(err, ErrUploadConflict) || errors.Is(err, ErrTransferConflict) || errors.Is(err, ErrNotEmpty) ||
+		errors.As(err, &aerr) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, ErrMetaDataUnavailable) {
+		return http.StatusBadGateway
+	}
+	if errors.Is(err, ErrMetaDataTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	if errors.Is(err, ErrNotSupported) {
+		return http.StatusNotImplemented
+	}
+	return defaultStatus
+}
@@ -0,0 +1,196 @@
+package main
+
+// version handlers module provides access to versions of files (S3 objects)
+// of storage areas
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VersioningParams represents versioning state of a directory (S3 bucket)
+type VersioningParams struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// RestoreParams represents version of a file to restore
+type RestoreParams struct {
+	VersionID string `json:"version_id" binding:"required"`
+}
+
+// helper function to lookup storage backend of storage area of HTTP request
+// which supports versioning
+func areaVersioner(c *gin.Context) (Versioner, bool) {
+	storage, ok := areaBackend(c)
+	if !ok {
+		return nil, false
+	}
+	return storageVersioner(c, storage)
+}
+
+// helper function to check if storage backend supports versioning
+func storageVersioner(c *gin.Context, storage StorageBackend) (Versioner, bool) {
+	versioner, ok := storage.(Versioner)
+	if !ok {
+		err := fmt.Errorf("%w: versioning of %s storage", ErrNotSupported, storage.Type())
+		c.JSON(http.StatusNotImplemented, gin.H{"status": "fail", "error": err.Error()})
+		return nil, false
+	}
+	return versioner, true
+}
+
+// VersioningHandler provides access to GET /versions/:area/:dir end-point
+/*
+```
+# check if versioning of dir (S3 bucket) is enabled
+curl http://localhost:8340/versions/raw/dir
+```
+*/
+func VersioningHandler(c *gin.Context) {
+	versioner, ok := areaVersioner(c)
+	if !ok {
+		return
+	}
+	var params StorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	enabled, err := versioner.Versioning(params.Dir)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": gin.H{"dir": params.Dir, "enabled": enabled}})
+}
+
+// VersioningPutHandler provides access to PUT /versions/:area/:dir end-point
+/*
+```
+# enable versioning of dir (S3 bucket)
+curl -X PUT http://localhost:8340/versions/raw/dir \
+     -H "Content-Type: application/json" \
+     -d '{"enabled":true}'
+```
+*/
+func VersioningPutHandler(c *gin.Context) {
+	versioner, ok := areaVersioner(c)
+	if !ok {
+		return
+	}
+	var params StorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	var state VersioningParams
+	if err := c.ShouldBindJSON(&state); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	if err := versioner.SetVersioning(params.Dir, *state.Enabled); err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": gin.H{"dir": params.Dir, "enabled": *state.Enabled}})
+}
+
+// VersionsHandler provides access to GET /versions/:area/:dir/:file end-point
+/*
+```
+# list versions of the file (S3 object) from the latest to the oldest one
+curl http://localhost:8340/versions/raw/dir/scan.h5
+```
+*/
+func VersionsHandler(c *gin.Context) {
+	versioner, ok := areaVersioner(c)
+	if !ok {
+		return
+	}
+	var params FileStorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	versions, err := versioner.Versions(params.Dir, params.File)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": versions})
+}
+
+// VersionRestoreHandler provides access to POST /versions/:area/:dir/:file end-point
+/*
+```
+# restore prior version of the file (S3 object), it becomes the latest version
+curl -X POST http://localhost:8340/versions/raw/dir/scan.h5 \
+     -H "Content-Type: application/json" \
+     -d '{"version_id":"<version_id>"}'
+```
+*/
+func VersionRestoreHandler(c *gin.Context) {
+	versioner, ok := areaVersioner(c)
+	if !ok {
+		return
+	}
+	var params FileStorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	var restore RestoreParams
+	if err := c.ShouldBindJSON(&restore); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	meta, err := versioner.RestoreVersion(params.Dir, params.File, restore.VersionID)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	auditMeta(c, meta.Size, meta.Checksums)
+	msg := fmt.Sprintf("Version %s of file %s/%s restored successfully", restore.VersionID, params.Dir, params.File)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "msg": msg, "data": meta})
+}
+
+// helper function to serve content or metadata of given version of a file
+func storageVersion(c *gin.Context, storage StorageBackend, dir, file, vid string) {
+	versioner, ok := storageVersioner(c, storage)
+	if !ok {
+		return
+	}
+	reader, meta, err := versioner.OpenVersion(dir, file, vid)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	defer reader.Close()
+	if isStatRequest(c) {
+		statResponse(c, meta)
+		return
+	}
+	serveContent(c, file, meta, reader)
+}
+
+// helper function to delete given version of a file, the versions of
+// retained files are kept
+func storageDeleteVersion(c *gin.Context, storage StorageBackend, dir, file, vid string) {
+	versioner, ok := storageVersioner(c, storage)
+	if !ok {
+		return
+	}
+	if !retentionGuard(c, c.Param("area"), dir, file) {
+		return
+	}
+	if err := versioner.DeleteVersion(dir, file, vid); err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"status": "fail", "error": err.Error()})
+		return
+	}
+	msg := fmt.Sprintf("Version %s of file %s/%s deleted successfully", vid, dir, file)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "msg": msg})
+}
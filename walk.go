@@ -0,0 +1,179 @@
+package main
+
+// walk module provides cancellable and bounded traversal of file-system trees
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// walkFunc is called for every entry of walked tree, the rel is path of the
+// entry relative to the root of the tree
+type walkFunc func(path, rel string, entry fs.DirEntry) error
+
+// walkDir walks file-system tree rooted at root up to given depth (1 walks
+// only direct entries of the root, negative depth means unlimited depth).
+// The walk stops when given context is cancelled, e.g. HTTP client is
+// disconnected, and it is bounded by configured time and number of entries,
+// in the latter case the walk returns partial results and truncated flag.
+// Unreadable entries (e.g. due to permission errors) are skipped.
+func walkDir(ctx context.Context, root string, depth int, fn walkFunc) (bool, error) {
+	wctx := ctx
+	if dmConfig.Walk.Timeout > 0 {
+		var cancel context.CancelFunc
+		wctx, cancel = context.WithTimeout(ctx, time.Duration(dmConfig.Walk.Timeout)*time.Second)
+		defer cancel()
+	}
+	var count int
+	var truncated bool
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if cerr := wctx.Err(); cerr != nil {
+			return cerr
+		}
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// skip unreadable entries
+			log.Printf("WARNING: unable to read %s: %v", path, err)
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		level := strings.Count(rel, string(filepath.Separator)) + 1
+		if depth > 0 && level > depth {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if limit := dmConfig.Walk.MaxEntries; limit > 0 && count >= limit {
+			truncated = true
+			return filepath.SkipAll
+		}
+		count++
+		return fn(path, rel, entry)
+	})
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		// our own time limit is reached, return partial results
+		log.Printf("WARNING: walk of %s is truncated after %d entries due to time limit", root, count)
+		return true, nil
+	}
+	if truncated {
+		log.Printf("WARNING: walk of %s is truncated after %d entries", root, count)
+	}
+	return truncated, err
+}
+
+// walkAfter walks file-system tree rooted at root up to given depth in
+// ascending order of relative paths of entries, the paths of directories
+// are ordered with trailing slash. Entries up to and including given path
+// (after) are skipped along with sub-trees which contain only such entries.
+// The fn may return filepath.SkipDir to skip directory and filepath.SkipAll
+// to stop the walk, and the walk is bounded like walkDir.
+func walkAfter(ctx context.Context, root string, depth int, after string, fn walkFunc) (bool, error) {
+	wctx := ctx
+	if dmConfig.Walk.Timeout > 0 {
+		var cancel context.CancelFunc
+		wctx, cancel = context.WithTimeout(ctx, time.Duration(dmConfig.Walk.Timeout)*time.Second)
+		defer cancel()
+	}
+	queue := &walkQueue{}
+	if err := queue.read(root, "", 1); err != nil {
+		return false, err
+	}
+	var count int
+	for queue.Len() > 0 {
+		if err := wctx.Err(); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				// our own time limit is reached, return partial results
+				log.Printf("WARNING: walk of %s is truncated after %d entries due to time limit", root, count)
+				return true, nil
+			}
+			return false, err
+		}
+		item := heap.Pop(queue).(walkItem)
+		path := filepath.Join(root, filepath.FromSlash(item.rel))
+		descend := item.entry.IsDir() && (depth < 0 || item.level < depth)
+		if item.key > after {
+			if limit := dmConfig.Walk.MaxEntries; limit > 0 && count >= limit {
+				log.Printf("WARNING: walk of %s is truncated after %d entries", root, count)
+				return true, nil
+			}
+			count++
+			if err := fn(path, filepath.FromSlash(item.rel), item.entry); err == filepath.SkipAll {
+				return false, nil
+			} else if err == filepath.SkipDir {
+				descend = false
+			} else if err != nil {
+				return false, err
+			}
+		} else if !strings.HasPrefix(after, item.key) {
+			// entire sub-tree precedes the cursor
+			descend = false
+		}
+		if descend {
+			if err := queue.read(path, item.rel, item.level+1); err != nil {
+				// skip unreadable directories
+				log.Printf("WARNING: unable to read %s: %v", path, err)
+			}
+		}
+	}
+	return false, nil
+}
+
+// walkItem represents entry of file-system tree pending to be walked
+type walkItem struct {
+	key   string // relative path of entry, paths of directories have trailing slash
+	rel   string // relative path of entry
+	level int    // level of entry within the tree
+	entry fs.DirEntry
+}
+
+// walkQueue represents priority queue of entries ordered by their keys
+type walkQueue []walkItem
+
+func (q walkQueue) Len() int           { return len(q) }
+func (q walkQueue) Less(i, j int) bool { return q[i].key < q[j].key }
+func (q walkQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *walkQueue) Push(x any)        { *q = append(*q, x.(walkItem)) }
+func (q *walkQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// helper function to add entries of given directory to the queue
+func (q *walkQueue) read(path, rel string, level int) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if rel != "" {
+			name = rel + "/" + name
+		}
+		key := name
+		if entry.IsDir() {
+			key += "/"
+		}
+		heap.Push(q, walkItem{key: key, rel: name, level: level, entry: entry})
+	}
+	return nil
+}
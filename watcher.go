@@ -0,0 +1,413 @@
+package main
+
+// watcher module provides file-system change notifications of storage areas
+// and DID data locations
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ErrTooManyWatches represents error of exceeded number of watched directories
+var ErrTooManyWatches = errors.New("too many watched directories")
+
+// event types
+const (
+	EventCreate = "create"
+	EventModify = "modify"
+	EventDelete = "delete"
+)
+
+// modifyInterval defines minimal interval between modify events of the same
+// file, e.g. detector frame is written by many write calls. The writes within
+// the interval are reported by trailing modify event once the file is not
+// modified for the interval.
+const modifyInterval = time.Second
+
+// modifyState represents state of modify events of a file
+type modifyState struct {
+	published time.Time   // time of last published modify event
+	trailing  *time.Timer // timer of pending trailing modify event
+}
+
+// Event represents file-system change event
+type Event struct {
+	Type     string    `json:"type"`               // create, modify or delete
+	Area     string    `json:"area,omitempty"`     // storage area of changed file
+	Location string    `json:"location,omitempty"` // DID data location of changed file
+	Path     string    `json:"path"`               // path of changed file relative to storage area or data location
+	IsDir    bool      `json:"is_dir,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// EventBus delivers events to their subscribers, events are dropped for
+// subscribers which do not keep up with the events
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]bool
+}
+
+// NewEventBus creates new event bus
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[chan Event]bool)}
+}
+
+// Subscribe creates new subscription of events, the returned function
+// should be called to cancel subscription
+func (b *EventBus) Subscribe(size int) (<-chan Event, func()) {
+	ch := make(chan Event, size)
+	b.mu.Lock()
+	b.subscribers[ch] = true
+	b.mu.Unlock()
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.subscribers[ch] {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// Publish sends event to all subscribers
+func (b *EventBus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// slow subscriber, drop the event
+		}
+	}
+}
+
+// watchRoot represents watched storage area or DID data location
+type watchRoot struct {
+	Area     string
+	Location string
+}
+
+// Watcher watches file-system trees of storage areas and DID data locations
+// and publishes their changes to event bus. It also keeps file catalog of
+// DID data locations fresh.
+type Watcher struct {
+	Bus        *EventBus
+	MaxWatches int // maximum number of watched directories
+
+	watcher  *fsnotify.Watcher
+	mu       sync.Mutex
+	roots    map[string]watchRoot    // watched roots
+	pending  map[string]bool         // roots which are being registered
+	dirs     map[string]string       // watched directories and their roots
+	modified map[string]*modifyState // modify events of files
+}
+
+// fsWatcher represents file-system watcher of the service, nil value means
+// that watcher is disabled
+var fsWatcher *Watcher
+
+// NewWatcher creates new file-system watcher
+func NewWatcher(maxWatches int) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("[DataManagement.main.NewWatcher] fsnotify.NewWatcher error: %w", err)
+	}
+	w := &Watcher{
+		Bus:        NewEventBus(),
+		MaxWatches: maxWatches,
+		watcher:    watcher,
+		roots:      make(map[string]watchRoot),
+		pending:    make(map[string]bool),
+		dirs:       make(map[string]string),
+		modified:   make(map[string]*modifyState),
+	}
+	return w, nil
+}
+
+// WatchArea registers root of storage area in the watcher
+func (w *Watcher) WatchArea(area, root string) error {
+	return w.watch(root, watchRoot{Area: area})
+}
+
+// WatchLocation registers DID data location in the watcher, the directories
+// of data location are registered in background and registration which
+// failed, e.g. due to limit of watches, is retried on next call
+func (w *Watcher) WatchLocation(location string) {
+	root := filepath.Clean(location)
+	w.mu.Lock()
+	if _, ok := w.roots[root]; ok || w.pending[root] {
+		w.mu.Unlock()
+		return
+	}
+	w.pending[root] = true
+	w.mu.Unlock()
+	go func() {
+		if err := w.watch(root, watchRoot{Location: location}); err != nil {
+			log.Printf("WARNING: unable to watch data location %s: %v", location, err)
+		}
+		w.mu.Lock()
+		delete(w.pending, root)
+		w.mu.Unlock()
+	}()
+}
+
+// helper function to register root in the watcher, the root is registered
+// once all its directories are watched and watches of partially registered
+// root are removed
+func (w *Watcher) watch(root string, wroot watchRoot) error {
+	root = filepath.Clean(root)
+	w.mu.Lock()
+	_, ok := w.roots[root]
+	w.mu.Unlock()
+	if ok {
+		return nil
+	}
+	if err := w.addTree(root, root); err != nil {
+		w.removeTree(root)
+		return err
+	}
+	w.mu.Lock()
+	w.roots[root] = wroot
+	w.mu.Unlock()
+	return nil
+}
+
+// helper function to remove watches of directories of given root
+func (w *Watcher) removeTree(root string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for dir, droot := range w.dirs {
+		if droot == root {
+			w.watcher.Remove(dir)
+			delete(w.dirs, dir)
+		}
+	}
+}
+
+// helper function to add watches for directory tree, fsnotify watches are
+// not recursive therefore every directory should be watched separately
+func (w *Watcher) addTree(root, dir string) error {
+	_, err := walkDir(context.Background(), dir, -1, func(path, rel string, entry fs.DirEntry) error {
+		if !entry.IsDir() {
+			return nil
+		}
+		if entry.Name() == metaArea {
+			return filepath.SkipDir
+		}
+		return w.add(root, path)
+	})
+	if err != nil {
+		return fmt.Errorf("[DataManagement.main.Watcher.addTree] walkDir error: %w", err)
+	}
+	return w.add(root, dir)
+}
+
+// helper function to add watch for single directory
+func (w *Watcher) add(root, dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.dirs[dir]; ok {
+		return nil
+	}
+	if w.MaxWatches > 0 && len(w.dirs) >= w.MaxWatches {
+		return fmt.Errorf("%w: unable to watch %s, limit is %d directories", ErrTooManyWatches, dir, w.MaxWatches)
+	}
+	if err := w.watcher.Add(dir); err != nil {
+		return err
+	}
+	w.dirs[dir] = root
+	return nil
+}
+
+// Run processes file-system notifications until the watcher is closed
+func (w *Watcher) Run() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("WARNING: watcher", err)
+		}
+	}
+}
+
+// Close stops the watcher
+func (w *Watcher) Close() error {
+	return w.watcher.Close()
+}
+
+// helper function to handle file-system notification, the changed file may
+// belong to several watched roots, e.g. DID data location within storage area
+func (w *Watcher) handle(nevent fsnotify.Event) {
+	var etype string
+	var isDir bool
+	switch {
+	case nevent.Has(fsnotify.Create):
+		etype = EventCreate
+		if info, err := os.Stat(nevent.Name); err == nil && info.IsDir() {
+			isDir = true
+			w.mu.Lock()
+			root := w.dirs[filepath.Dir(nevent.Name)]
+			w.mu.Unlock()
+			if err := w.addTree(root, nevent.Name); err != nil {
+				log.Println("WARNING: watcher", err)
+			}
+		}
+	case nevent.Has(fsnotify.Write):
+		if !w.debounce(nevent.Name) {
+			return
+		}
+		etype = EventModify
+	case nevent.Has(fsnotify.Remove), nevent.Has(fsnotify.Rename):
+		// renamed file is reported as removed and new name is reported as created
+		etype = EventDelete
+		w.forget(nevent.Name)
+	default:
+		return
+	}
+	w.publish(etype, nevent.Name, isDir)
+}
+
+// helper function to publish event of changed file to all its watched roots
+// and to update file catalog of DID data locations
+func (w *Watcher) publish(etype, name string, isDir bool) {
+	for root, wroot := range w.owners(name) {
+		rel, err := filepath.Rel(root, name)
+		if err != nil || rel == metaArea || strings.HasPrefix(rel, metaArea+string(filepath.Separator)) {
+			continue
+		}
+		event := Event{
+			Type:     etype,
+			Area:     wroot.Area,
+			Location: wroot.Location,
+			Path:     filepath.ToSlash(rel),
+			IsDir:    isDir,
+			Time:     time.Now(),
+		}
+		if wroot.Location != "" && fileCatalog != nil {
+			if err := fileCatalog.Touch(root, event.Path); err != nil {
+				log.Println("WARNING: watcher", err)
+			}
+		}
+		w.Bus.Publish(event)
+	}
+}
+
+// helper function to find watched roots which contain given file
+func (w *Watcher) owners(name string) map[string]watchRoot {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	roots := make(map[string]watchRoot)
+	for root, wroot := range w.roots {
+		if strings.HasPrefix(name, root+string(filepath.Separator)) {
+			roots[root] = wroot
+		}
+	}
+	return roots
+}
+
+// helper function to limit rate of modify events of the same file, the
+// first write is reported immediately while subsequent writes within modify
+// interval are reported by single trailing event after the last of them,
+// i.e. the final size and content of the file are always reported
+func (w *Watcher) debounce(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	state, ok := w.modified[name]
+	if !ok {
+		if len(w.modified) > 10000 {
+			// forget files which are not modified anymore
+			for fname, s := range w.modified {
+				if s.trailing == nil && now.Sub(s.published) >= modifyInterval {
+					delete(w.modified, fname)
+				}
+			}
+		}
+		state = &modifyState{}
+		w.modified[name] = state
+	}
+	if state.trailing == nil && now.Sub(state.published) >= modifyInterval {
+		state.published = now
+		return true
+	}
+	if state.trailing != nil {
+		state.trailing.Reset(modifyInterval)
+	} else {
+		state.trailing = time.AfterFunc(modifyInterval, func() { w.flush(name, state) })
+	}
+	return false
+}
+
+// helper function to publish trailing modify event of a file
+func (w *Watcher) flush(name string, state *modifyState) {
+	w.mu.Lock()
+	if w.modified[name] != state {
+		// file was removed in a meantime
+		w.mu.Unlock()
+		return
+	}
+	state.trailing = nil
+	state.published = time.Now()
+	w.mu.Unlock()
+	w.publish(EventModify, name, false)
+}
+
+// helper function to forget removed file or directory, fsnotify removes
+// watches of removed directories itself
+func (w *Watcher) forget(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if state, ok := w.modified[name]; ok && state.trailing != nil {
+		state.trailing.Stop()
+	}
+	delete(w.modified, name)
+	prefix := name + string(filepath.Separator)
+	for dir := range w.dirs {
+		if dir == name || strings.HasPrefix(dir, prefix) {
+			delete(w.dirs, dir)
+		}
+	}
+}
+
+// initWatcher initializes file-system watcher of the service according to
+// configuration and registers storage areas backed by local file-system
+func initWatcher() error {
+	if !dmConfig.Watcher.Enabled {
+		return nil
+	}
+	watcher, err := NewWatcher(dmConfig.Watcher.MaxWatches)
+	if err != nil {
+		return err
+	}
+	for _, area := range storageAreas {
+		if client, ok := area.Backend.(*LocalFsClient); ok {
+			if err := watcher.WatchArea(area.Name, client.Storage); err != nil {
+				log.Printf("WARNING: unable to watch storage area %s: %v", area.Name, err)
+			}
+		}
+	}
+	fsWatcher = watcher
+	go watcher.Run()
+	return nil
+}